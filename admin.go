@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/pkg/errors"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+const adminTokenHeader = "X-Admin-Token"
+
+// adminToken токен для служебных ручек; пустой -- служебные ручки выключены
+var adminToken string
+
+// loadAdminToken чтение токена служебных ручек из vault.
+// Без ключа warscript-bots/admin сервис работает, но служебные ручки недоступны
+func loadAdminToken(vault *vaultapi.Client) {
+	adminConf, err := vault.Logical().Read("warscript-bots/admin")
+	if err != nil || adminConf == nil {
+		logger.Warnf("can not read warscript-bots/admin key, admin handlers are disabled: %v", err)
+		return
+	}
+
+	token, ok := adminConf.Data["token"].(string)
+	if !ok || token == "" {
+		logger.Warn("warscript-bots/admin key has no token, admin handlers are disabled")
+		return
+	}
+	adminToken = token
+}
+
+// WithAdminToken пропускает только запросы с токеном служебных ручек в заголовке X-Admin-Token
+func WithAdminToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := utils.GetLogger(r, logger, "WithAdminToken")
+		errWriter := utils.NewErrorResponseWriter(w, logger)
+
+		token := r.Header.Get(adminTokenHeader)
+		if adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			errWriter.WriteWarn(http.StatusForbidden, errors.New("wrong admin token"))
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// testerMaxRunning сколько задач всех игр может быть у тестеров одновременно
+	testerMaxRunning = int64(200)
+	// testerMaxQueued глубина очередей тестеров, при которой рейтинговые матчи не отправляются
+	testerMaxQueued = int64(100)
+	// gameMaxRunning сколько задач одной игры может быть у тестеров, если в настройках игры не задано
+	gameMaxRunning = int64(50)
+)
+
+var (
+	testerRunningJobs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tester_running_jobs",
+		Help: "Number of unfinished tester jobs",
+	}, []string{"game"})
+	testerQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "tester_queue_depth",
+		Help: "Number of tasks waiting in tester queues",
+	})
+	matchmakingThrottled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "matchmaking_throttled_total",
+		Help: "Number of matchmaking cycles skipped or shrunk because testers are saturated",
+	}, []string{"game", "reason"})
+)
+
+func init() {
+	prometheus.MustRegister(testerRunningJobs, testerQueued, matchmakingThrottled)
+}
+
+// testerLoad нагрузка на тестеров в начале цикла матчмейкинга
+type testerLoad struct {
+	// Running незавершённые задачи по играм
+	Running map[string]int64
+	// Total незавершённые задачи всех игр
+	Total int64
+	// Queued задачи, которые ещё не взял ни один тестер
+	Queued int64
+}
+
+// loadTesterLoad текущая нагрузка: задачи в работе из jobs и глубина очередей тестеров
+func loadTesterLoad() (*testerLoad, error) {
+	running, err := Jobs.CountRunning()
+	if err != nil {
+		return nil, errors.Wrap(err, "can not count running jobs")
+	}
+
+	load := &testerLoad{Running: running}
+	for game, count := range running {
+		load.Total += count
+		testerRunningJobs.WithLabelValues(game).Set(float64(count))
+	}
+
+	for _, queueName := range testerQueues() {
+		depth, err := queueDepth(queueName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can not inspect queue %s", queueName)
+		}
+		load.Queued += depth
+	}
+	testerQueued.Set(float64(load.Queued))
+
+	return load, nil
+}
+
+// queueDepth число задач в очереди тестеров. Если очереди нет, брокер закрывает канал,
+// поэтому у каждой проверки свой канал, а не общий rabbitChannel. Нет очереди -- нет задач
+func queueDepth(queueName string) (int64, error) {
+	ch, err := rabbitConn.Channel()
+	if err != nil {
+		return 0, errors.Wrap(err, "can not open channel")
+	}
+	//nolint: errcheck
+	defer ch.Close()
+
+	q, err := ch.QueueInspect(queueName)
+	if err != nil {
+		if amqpErr, ok := err.(*amqp.Error); ok && amqpErr.Code == amqp.NotFound {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	return int64(q.Messages), nil
+}
+
+// matchBudget сколько рейтинговых матчей игры можно отправить сейчас.
+// Пока очереди тестеров не разобраны, новые матчи только удлинят ожидание проверок
+func (l *testerLoad) matchBudget(game *GameConfig) int64 {
+	if l.Queued >= testerMaxQueued {
+		return 0
+	}
+
+	budget := testerMaxRunning - l.Total
+	if gameBudget := game.maxRunning() - l.Running[game.Slug]; gameBudget < budget {
+		budget = gameBudget
+	}
+	if budget < 0 {
+		return 0
+	}
+
+	return budget
+}
+
+// dispatched учёт отправленных в этом цикле матчей
+func (l *testerLoad) dispatched(gameSlug string, n int64) {
+	l.Running[gameSlug] += n
+	l.Total += n
+}
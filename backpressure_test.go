@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestMatchBudget(t *testing.T) {
+	game := &GameConfig{Slug: "pong", MaxRunning: 10}
+	cases := []struct {
+		load     *testerLoad
+		expected int64
+	}{
+		{&testerLoad{Running: map[string]int64{}}, 10},
+		{&testerLoad{Running: map[string]int64{"pong": 7}, Total: 7}, 3},
+		{&testerLoad{Running: map[string]int64{"pong": 12}, Total: 12}, 0},
+		{&testerLoad{Running: map[string]int64{"snake": 198}, Total: 198}, 2},
+		{&testerLoad{Running: map[string]int64{}, Queued: testerMaxQueued}, 0},
+	}
+
+	for i, c := range cases {
+		if budget := c.load.matchBudget(game); budget != c.expected {
+			t.Errorf("TestMatchBudget case %d got %d, expected %d", i, budget, c.expected)
+		}
+	}
+
+	load := &testerLoad{Running: map[string]int64{}}
+	load.dispatched("pong", 4)
+	if budget := load.matchBudget(game); budget != 6 {
+		t.Errorf("TestMatchBudget after dispatch got %d, expected 6", budget)
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/HotCodeGroup/warscript-utils/middlewares"
 	"github.com/HotCodeGroup/warscript-utils/models"
 	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 )
 
@@ -22,6 +24,143 @@ func SessionInfo(r *http.Request) *models.SessionPayload {
 	return nil
 }
 
+// OptionalSessionInfo достаёт инфу о юзере по куке, если она есть.
+// Используется в ручках, которые доступны без авторизации
+func OptionalSessionInfo(r *http.Request) (*models.SessionPayload, error) {
+	cookie, err := r.Cookie("JSESSIONID")
+	if err != nil || cookie == nil {
+		return nil, nil
+	}
+
+	return authGPRC.GetSessionInfo(r.Context(), &models.SessionToken{Token: cookie.Value})
+}
+
+// getAuthorBot достаёт бота по bot_id из URL и проверяет, что его автор -- владелец сессии.
+// Если что-то пошло не так, пишет ошибку в ответ и возвращает nil
+func getAuthorBot(r *http.Request, errWriter *utils.ErrorResponseWriter,
+	info *models.SessionPayload) *BotModel {
+	botID, err := strconv.ParseInt(mux.Vars(r)["bot_id"], 10, 64)
+	if err != nil {
+		errWriter.WriteWarn(http.StatusNotFound, errors.Wrap(err, "wrong format bot_id"))
+		return nil
+	}
+
+	bot, err := Bots.GetBotByID(botID)
+	if err != nil {
+		if errors.Cause(err) == utils.ErrNotExists {
+			errWriter.WriteWarn(http.StatusNotFound, errors.Wrap(err, "bot not exists"))
+		} else {
+			errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get bot method error"))
+		}
+		return nil
+	}
+
+	if bot.AuthorID != info.ID {
+		errWriter.WriteWarn(http.StatusForbidden, errors.New("bot belongs to another user"))
+		return nil
+	}
+
+	return bot
+}
+
+// newBot публичная информация о боте
+func newBot(bot *BotModel, author *AuthorInfo) Bot {
+	low, high := bot.Rating().Interval()
+
+	return Bot{
+		Author:         author,
+		ID:             bot.ID,
+		GameSlug:       bot.GameSlug,
+		IsActive:       bot.IsActive,
+		IsVerified:     bot.IsVerified,
+		IsArchived:     bot.IsArchived,
+		Score:          roundScore(bot.Score),
+		ScoreDeviation: roundScore(bot.Deviation),
+		ScoreInterval:  [2]int64{roundScore(low), roundScore(high)},
+		Version:        bot.Version,
+		GamesPlayed:    bot.GamesPlayed,
+		Wins:           bot.Wins,
+		Losses:         bot.Losses,
+		Draws:          bot.Draws,
+	}
+}
+
+// writeAuthorBot отдаёт автору полную информацию о его боте
+func writeAuthorBot(w http.ResponseWriter, errWriter *utils.ErrorResponseWriter, bot *BotModel) {
+	userInfo, err := authGPRC.GetUserByID(context.Background(), &models.UserID{ID: bot.AuthorID})
+	if err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "can not find user by id"))
+		return
+	}
+
+	utils.WriteApplicationJSON(w, http.StatusOK, &BotFull{
+		Bot: newBot(bot, &AuthorInfo{
+			ID:        userInfo.ID,
+			Username:  userInfo.Username,
+			PhotoUUID: userInfo.PhotoUUID,
+			Active:    userInfo.Active,
+		}),
+		Code:     bot.Code,
+		Language: Lang(bot.Language),
+	})
+}
+
+// GetBot получение информации о боте по его ID.
+// Автору бота дополнительно отдаётся код и язык
+func GetBot(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger(r, logger, "GetBot")
+	errWriter := utils.NewErrorResponseWriter(w, logger)
+	vars := mux.Vars(r)
+
+	botID, err := strconv.ParseInt(vars["bot_id"], 10, 64)
+	if err != nil {
+		errWriter.WriteWarn(http.StatusNotFound, errors.Wrap(err, "wrong format bot_id"))
+		return
+	}
+
+	bot, err := Bots.GetBotByID(botID)
+	if err != nil {
+		if errors.Cause(err) == utils.ErrNotExists {
+			errWriter.WriteWarn(http.StatusNotFound, errors.Wrap(err, "bot not exists"))
+		} else {
+			errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get bot method error"))
+		}
+		return
+	}
+
+	var ai *AuthorInfo
+	authorInfo, err := authGPRC.GetUserByID(context.Background(), &models.UserID{ID: bot.AuthorID})
+	if err != nil {
+		logger.Warnf("can not get author info: %v", err)
+	} else {
+		ai = &AuthorInfo{
+			ID:        authorInfo.ID,
+			Username:  authorInfo.Username,
+			PhotoUUID: authorInfo.PhotoUUID,
+			Active:    authorInfo.Active,
+		}
+	}
+
+	respBot := newBot(bot, ai)
+
+	session, err := OptionalSessionInfo(r)
+	if err != nil {
+		logger.Warnf("can't get session by token: %v", err)
+	}
+
+	// код видит только автор
+	if session != nil && session.ID == bot.AuthorID {
+		utils.WriteApplicationJSON(w, http.StatusOK, &BotFull{
+			Bot:      respBot,
+			Code:     bot.Code,
+			Language: Lang(bot.Language),
+		})
+		return
+	}
+
+	utils.WriteApplicationJSON(w, http.StatusOK, &respBot)
+}
+
 // CreateBot создание бота в базе данных + отправка его на проверку
 func CreateBot(w http.ResponseWriter, r *http.Request) {
 	logger := utils.GetLogger(r, logger, "CreateBot")
@@ -86,40 +225,177 @@ func CreateBot(w http.ResponseWriter, r *http.Request) {
 	}
 
 	botFull := BotFull{
-		Bot: Bot{
-			Author: &AuthorInfo{
-				ID:        userInfo.ID,
-				Username:  userInfo.Username,
-				PhotoUUID: userInfo.PhotoUUID,
-				Active:    userInfo.Active,
-			},
-			ID:         bot.ID,
-			IsActive:   bot.IsActive,
-			IsVerified: bot.IsVerified,
-			GameSlug:   bot.GameSlug,
-			Score:      bot.Score,
-		},
+		Bot: newBot(bot, &AuthorInfo{
+			ID:        userInfo.ID,
+			Username:  userInfo.Username,
+			PhotoUUID: userInfo.PhotoUUID,
+			Active:    userInfo.Active,
+		}),
 		Code:     form.Code,
 		Language: form.Language,
 	}
 
-	// делаем RPC запрос
-	events, err := sendForVerifyRPC(&TestTask{
-		Code1:    form.Code,
-		Code2:    gameInfo.BotCode,
-		GameSlug: gameInfo.Slug, // так как citext, то ориджинал слаг в gameInfo
-		Language: form.Language,
-	})
+	// так как citext, то ориджинал слаг в gameInfo
+	verification, jobID, err := startVerification(&VerificationModel{
+		BotID:    bot.ID,
+		Version:  bot.Version,
+		AuthorID: info.ID,
+		GameSlug: gameInfo.Slug,
+	}, &TestPlayer{Code: form.Code, Lang: form.Language}, gameInfo.BotCode)
 	if err != nil {
-		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "can not call verify rpc"))
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "can not start verification"))
 		return
 	}
-	// запускаем обработчик ответа RPC
-	go processVerifyingStatus(bot.ID, info.ID, bot.GameSlug, h.broadcast, events)
+	go checkSimilarity(bot)
+	botFull.JobID = jobID
+	botFull.VerificationID = verification.ID
 	utils.WriteApplicationJSON(w, http.StatusOK, botFull)
 }
 
-// GetBotsList получение списка ботов
+// UpdateBot изменение состояния бота автором. Пока можно только
+// активировать бота: активный бот у автора в игре может быть только один
+func UpdateBot(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger(r, logger, "UpdateBot")
+	errWriter := utils.NewErrorResponseWriter(w, logger)
+	info := SessionInfo(r)
+	if info == nil {
+		errWriter.WriteWarn(http.StatusUnauthorized, errors.New("session info is not presented"))
+		return
+	}
+
+	form := &BotUpdate{}
+	err := utils.DecodeBodyJSON(r.Body, form)
+	if err != nil {
+		errWriter.WriteWarn(http.StatusBadRequest, errors.Wrap(err, "decode body error"))
+		return
+	}
+
+	bot := getAuthorBot(r, errWriter, info)
+	if bot == nil {
+		return
+	}
+
+	if form.IsActive != nil {
+		if err = Bots.SetBotActiveByID(bot.ID, *form.IsActive); err != nil {
+			if errors.Cause(err) == utils.ErrInvalid {
+				errWriter.WriteValidationError(&utils.ValidationError{
+					"is_active": utils.ErrInvalid.Error(),
+				})
+				return
+			}
+
+			errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "set bot active method error"))
+			return
+		}
+
+		bot.IsActive = *form.IsActive
+	}
+
+	writeAuthorBot(w, errWriter, bot)
+}
+
+// ArchiveBot отправка бота в архив: он пропадает из матчмейкинга и чужих списков,
+// но остаётся в истории матчей
+func ArchiveBot(w http.ResponseWriter, r *http.Request) {
+	setBotArchived(w, r, "ArchiveBot", true)
+}
+
+// RestoreBot восстановление бота из архива
+func RestoreBot(w http.ResponseWriter, r *http.Request) {
+	setBotArchived(w, r, "RestoreBot", false)
+}
+
+func setBotArchived(w http.ResponseWriter, r *http.Request, method string, isArchived bool) {
+	logger := utils.GetLogger(r, logger, method)
+	errWriter := utils.NewErrorResponseWriter(w, logger)
+	info := SessionInfo(r)
+	if info == nil {
+		errWriter.WriteWarn(http.StatusUnauthorized, errors.New("session info is not presented"))
+		return
+	}
+
+	bot := getAuthorBot(r, errWriter, info)
+	if bot == nil {
+		return
+	}
+
+	if err := Bots.SetBotArchivedByID(bot.ID, isArchived); err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "set bot archived method error"))
+		return
+	}
+
+	bot.IsArchived = isArchived
+	bot.IsActive = bot.IsActive && !isArchived
+	writeAuthorBot(w, errWriter, bot)
+}
+
+// getLeaderboard боты для GetBotsList: текущая таблица, либо, если передан season,
+// архив закрытого сезона игры с местами ботов. Ошибку getLeaderboard пишет сама.
+// withArchived -- список своих ботов автора, в нём есть и архивные
+func getLeaderboard(r *http.Request, errWriter *utils.ErrorResponseWriter, authorID int64,
+	gameSlug string, limit, since int64, withArchived bool) ([]*BotModel, map[int64]int64, error) {
+	// hide_inactive=true скрывает ботов, которые давно не играли рейтинговых матчей
+	var activeSince time.Time
+	if hide, _ := strconv.ParseBool(r.URL.Query().Get("hide_inactive")); hide {
+		activeSince = inactiveSince(gameSlug, time.Now())
+	}
+
+	seasonS := r.URL.Query().Get("season")
+	if seasonS == "" {
+		bots, err := Bots.GetBotsByGameSlugAndAuthorID(authorID, gameSlug, limit, since, activeSince, withArchived)
+		if err != nil {
+			errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get bot method error"))
+		}
+
+		return bots, nil, err
+	}
+
+	number, err := strconv.ParseInt(seasonS, 10, 64)
+	if err != nil || gameSlug == "" {
+		errWriter.WriteValidationError(&utils.ValidationError{
+			"season": utils.ErrInvalid.Error(),
+		})
+		return nil, nil, errors.New("wrong season or game_slug")
+	}
+
+	season, err := Seasons.GetSeason(gameSlug, number)
+	if err != nil {
+		if errors.Cause(err) == utils.ErrNotExists {
+			errWriter.WriteWarn(http.StatusNotFound, errors.Wrap(err, "season not exists"))
+		} else {
+			errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get season method error"))
+		}
+		return nil, nil, err
+	}
+
+	// у текущего сезона архива ещё нет
+	if !season.EndedAt.Valid {
+		bots, err := Bots.GetBotsByGameSlugAndAuthorID(authorID, gameSlug, limit, since, activeSince, withArchived)
+		if err != nil {
+			errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get bot method error"))
+		}
+
+		return bots, nil, err
+	}
+
+	standings, err := Seasons.GetStandings(gameSlug, number, authorID, limit, since)
+	if err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get season standings method error"))
+		return nil, nil, err
+	}
+
+	bots := make([]*BotModel, len(standings))
+	ranks := make(map[int64]int64, len(standings))
+	for i, st := range standings {
+		bots[i] = st.Bot
+		ranks[st.Bot.ID] = st.Rank
+	}
+
+	return bots, ranks, nil
+}
+
+// GetBotsList получение списка ботов.
+// С параметрами game_slug и season -- итоговая таблица сезона
 func GetBotsList(w http.ResponseWriter, r *http.Request) {
 	logger := utils.GetLogger(r, logger, "GetBotsList")
 	errWriter := utils.NewErrorResponseWriter(w, logger)
@@ -157,10 +433,19 @@ func GetBotsList(w http.ResponseWriter, r *http.Request) {
 		since = 0
 	}
 
+	// автор видит в своём списке и архивные боты, чтобы их можно было восстановить
+	withArchived := false
+	if authorID > 0 {
+		session, err := OptionalSessionInfo(r)
+		if err != nil {
+			logger.Warnf("can't get session by token: %v", err)
+		}
+		withArchived = session != nil && session.ID == authorID
+	}
+
 	gameSlug := r.URL.Query().Get("game_slug")
-	bots, err := Bots.GetBotsByGameSlugAndAuthorID(authorID, gameSlug, limit, since)
+	bots, ranks, err := getLeaderboard(r, errWriter, authorID, gameSlug, limit, since, withArchived)
 	if err != nil {
-		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get bot method error"))
 		return
 	}
 
@@ -220,14 +505,9 @@ func GetBotsList(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		respBots[i] = &Bot{
-			Author:     ai,
-			ID:         bot.ID,
-			GameSlug:   bot.GameSlug,
-			IsActive:   bot.IsActive,
-			IsVerified: bot.IsVerified,
-			Score:      bot.Score,
-		}
+		respBot := newBot(bot, ai)
+		respBot.Rank = ranks[bot.ID]
+		respBots[i] = &respBot
 	}
 
 	utils.WriteApplicationJSON(w, http.StatusOK, respBots)
@@ -3,6 +3,7 @@ package main
 import (
 	"database/sql"
 	"strconv"
+	"time"
 
 	"github.com/HotCodeGroup/warscript-utils/utils"
 	"github.com/pkg/errors"
@@ -14,10 +15,22 @@ import (
 type BotAccessObject interface {
 	Create(b *BotModel) error
 	SetBotVerifiedByID(botID int64, isActive bool) error
-	SetBotScoreByID(botID int64, newScore int64) error
+	SetBotScoreByID(botID int64, newScore float64) error
+	UpdateIdleRatings(game string, playedIDs []int64, activeSince time.Time, idle func(Rating) Rating) error
+	DecayInactiveBots(game string, inactiveSince, decayedSince time.Time, decay func(Rating) Rating) (int64, error)
+	SetBotActiveByID(botID int64, isActive bool) error
+	SetBotArchivedByID(botID int64, isArchived bool) error
 	GetBotByID(botID int64) (*BotModel, error)
-	GetBotsByGameSlugAndAuthorID(authorID int64, game string, limit, since int64) ([]*BotModel, error)
-	GetBotsForTesting(N int64, game string) ([]*BotModel, error)
+	GetBotsByGameSlugAndAuthorID(authorID int64, game string, limit, since int64,
+		activeSince time.Time, withArchived bool) ([]*BotModel, error)
+	GetBotsForTesting(N int64, game string, since time.Time) ([]*BotModel, error)
+	GetGameSlugs() ([]string, error)
+
+	CreateVersion(v *BotVersionModel) error
+	GetVersion(botID, version int64) (*BotVersionModel, error)
+	GetVersionsByBotID(botID int64) ([]*BotVersionModel, error)
+	SetVersionVerified(botID, version int64, isVerified bool, initial Rating) error
+	SetActiveVersion(botID, version int64) error
 }
 
 // AccessObject implementation of BotAccessObject
@@ -37,10 +50,67 @@ type BotModel struct {
 	Language    string
 	IsActive    bool
 	IsVerified  bool
+	IsArchived  bool
 	AuthorID    int64
 	GameSlug    string
-	Score       int64
+	Score       float64
+	Deviation   float64
+	Volatility  float64
 	GamesPlayed int64
+	Wins        int64
+	Losses      int64
+	Draws       int64
+	Version     int64
+	// RecentGames матчи за окно справедливости, заполняется только GetBotsForTesting
+	RecentGames int64
+}
+
+// BotVersionModel model for bot_versions table
+type BotVersionModel struct {
+	BotID      int64
+	Version    int64
+	Code       string
+	Language   string
+	IsVerified bool
+	Created    time.Time
+}
+
+// botFields поля бота в порядке, в котором их ожидает scanBot
+const botFields = `b.id, b.code, b.language, b.is_active, b.is_verified, b.is_archived,
+	b.author_id, b.game_slug, b.score, b.score_deviation, b.score_volatility,
+	b.games_played, b.wins, b.losses, b.draws, b.version`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// extraScanner дописывает к полям бота дополнительные колонки запроса
+type extraScanner struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (s *extraScanner) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
+
+func scanBot(row rowScanner) (*BotModel, error) {
+	bot := &BotModel{}
+	err := row.Scan(&bot.ID, &bot.Code,
+		&bot.Language, &bot.IsActive, &bot.IsVerified, &bot.IsArchived,
+		&bot.AuthorID, &bot.GameSlug, &bot.Score, &bot.Deviation, &bot.Volatility, &bot.GamesPlayed,
+		&bot.Wins, &bot.Losses, &bot.Draws, &bot.Version)
+
+	return bot, err
+}
+
+// Rating текущий рейтинг бота
+func (b *BotModel) Rating() Rating {
+	return Rating{
+		Score:      b.Score,
+		Deviation:  b.Deviation,
+		Volatility: b.Volatility,
+	}
 }
 
 // Create создание записи о боте в базе данных
@@ -68,6 +138,14 @@ func (bd *AccessObject) Create(b *BotModel) error {
 		return errors.Wrapf(utils.ErrInternal, "create bot row error: %v", pgErr)
 	}
 
+	// первая версия кода бота
+	b.Version = 1
+	_, err = tx.Exec(`INSERT INTO bot_versions (bot_id, version, code, language)
+		VALUES ($1, $2, $3, $4)`, &b.ID, &b.Version, &b.Code, &b.Language)
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "create bot version row error: %v", err)
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return errors.Wrapf(utils.ErrInternal, "can not commit bot create transaction: %v", err)
@@ -94,7 +172,7 @@ func (bd *AccessObject) SetBotVerifiedByID(botID int64, isVerified bool) error {
 }
 
 // SetBotScoreByID установка очков для бота по ID
-func (bd *AccessObject) SetBotScoreByID(botID, newScore int64) error {
+func (bd *AccessObject) SetBotScoreByID(botID int64, newScore float64) error {
 	_, err := pqConn.Exec(`UPDATE bots SET score = $1 
 									WHERE bots.id = $2;`, newScore, botID)
 	if err != nil {
@@ -104,16 +182,208 @@ func (bd *AccessObject) SetBotScoreByID(botID, newScore int64) error {
 	return nil
 }
 
+// UpdateIdleRatings конец рейтингового периода: рейтинг активных ботов игры,
+// которые в нём не играли, пересчитывается функцией idle.
+// Если activeSince задан, боты без матчей с activeSince пропускаются: ими занимается затухание
+func (bd *AccessObject) UpdateIdleRatings(game string, playedIDs []int64, activeSince time.Time,
+	idle func(Rating) Rating) error {
+	tx, err := pqConn.Begin()
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not open idle ratings transaction: %s", err.Error())
+	}
+	//nolint: errcheck
+	defer tx.Rollback()
+
+	query := `SELECT b.id, b.score, b.score_deviation, b.score_volatility FROM bots b
+		WHERE b.game_slug = $1 AND b.is_active = true AND b.is_verified = true AND b.is_archived = false
+		AND NOT (b.id = ANY($2))`
+	args := []interface{}{game, pq.Array(playedIDs)}
+	if !activeSince.IsZero() {
+		query += ` AND EXISTS (SELECT 1 FROM rating_history h WHERE h.bot_id = b.id
+			AND h.reason = ANY($3) AND h.time > $4)`
+		args = append(args, pq.Array([]string{ratingReasonMatch, ratingReasonVerification}), activeSince)
+	}
+
+	rows, err := tx.Query(query+` FOR UPDATE OF b`, args...)
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "get idle bots error: %v", err)
+	}
+
+	changed := make(map[int64]Rating)
+	for rows.Next() {
+		var id int64
+		r := Rating{}
+		if err = rows.Scan(&id, &r.Score, &r.Deviation, &r.Volatility); err != nil {
+			rows.Close()
+			return errors.Wrapf(utils.ErrInternal, "get idle bots scan error: %v", err)
+		}
+
+		if newRating := idle(r); newRating != r {
+			changed[id] = newRating
+		}
+	}
+	rows.Close()
+
+	for id, r := range changed {
+		_, err = tx.Exec(`UPDATE bots SET score = $1, score_deviation = $2, score_volatility = $3
+			WHERE bots.id = $4;`, r.Score, r.Deviation, r.Volatility, id)
+		if err != nil {
+			return errors.Wrapf(utils.ErrInternal, "can not update idle bot rating: %v", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not commit idle ratings transaction: %v", err)
+	}
+
+	return nil
+}
+
+// DecayInactiveBots затухание рейтинга активных ботов игры, у которых не было рейтинговых
+// матчей с inactiveSince и затухания с decayedSince. Изменения пишутся в историю рейтинга
+// с причиной decay. Возвращает число ботов, чей рейтинг изменился
+func (bd *AccessObject) DecayInactiveBots(game string, inactiveSince, decayedSince time.Time,
+	decay func(Rating) Rating) (int64, error) {
+	tx, err := pqConn.Begin()
+	if err != nil {
+		return 0, errors.Wrapf(utils.ErrInternal, "can not open decay transaction: %s", err.Error())
+	}
+	//nolint: errcheck
+	defer tx.Rollback()
+
+	// проверку бот тоже считаем активностью, иначе только что проверенный бот затухнет
+	rows, err := tx.Query(`SELECT b.id, b.version, b.score, b.score_deviation, b.score_volatility FROM bots b
+		WHERE b.game_slug = $1 AND b.is_active = true AND b.is_verified = true AND b.is_archived = false
+		AND NOT EXISTS (SELECT 1 FROM rating_history h WHERE h.bot_id = b.id
+			AND ((h.reason = ANY($2) AND h.time > $3) OR (h.reason = $4 AND h.time > $5)))
+		FOR UPDATE OF b`, game, pq.Array([]string{ratingReasonMatch, ratingReasonVerification}),
+		inactiveSince, ratingReasonDecay, decayedSince)
+	if err != nil {
+		return 0, errors.Wrapf(utils.ErrInternal, "get inactive bots error: %v", err)
+	}
+
+	changed := make(map[int64]Rating)
+	versions := make(map[int64]int64)
+	for rows.Next() {
+		var id, version int64
+		r := Rating{}
+		if err = rows.Scan(&id, &version, &r.Score, &r.Deviation, &r.Volatility); err != nil {
+			rows.Close()
+			return 0, errors.Wrapf(utils.ErrInternal, "get inactive bots scan error: %v", err)
+		}
+
+		if newRating := decay(r); newRating != r {
+			changed[id] = newRating
+			versions[id] = version
+		}
+	}
+	rows.Close()
+
+	for id, r := range changed {
+		_, err = tx.Exec(`UPDATE bots SET score = $1, score_deviation = $2, score_volatility = $3
+			WHERE bots.id = $4;`, r.Score, r.Deviation, r.Volatility, id)
+		if err != nil {
+			return 0, errors.Wrapf(utils.ErrInternal, "can not update inactive bot rating: %v", err)
+		}
+
+		if err = insertRatingHistory(tx, &RatingHistoryModel{BotID: id, Version: versions[id],
+			Score: r.Score, Deviation: r.Deviation, Reason: ratingReasonDecay}); err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, errors.Wrapf(utils.ErrInternal, "can not commit decay transaction: %v", err)
+	}
+
+	return int64(len(changed)), nil
+}
+
+// GetGameSlugs игры, в которых есть активные проверенные боты
+func (bd *AccessObject) GetGameSlugs() ([]string, error) {
+	rows, err := pqConn.Query(`SELECT DISTINCT b.game_slug FROM bots b
+		WHERE b.is_active = true AND b.is_verified = true AND b.is_archived = false ORDER BY b.game_slug;`)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "get bot games error: %v", err)
+	}
+	defer rows.Close()
+
+	slugs := make([]string, 0)
+	for rows.Next() {
+		var slug string
+		if err = rows.Scan(&slug); err != nil {
+			return nil, errors.Wrapf(utils.ErrInternal, "get bot games scan error: %v", err)
+		}
+		slugs = append(slugs, slug)
+	}
+
+	return slugs, nil
+}
+
+// SetBotActiveByID активация или деактивация бота по ID.
+// При активации остальные боты автора в этой игре деактивируются
+func (bd *AccessObject) SetBotActiveByID(botID int64, isActive bool) error {
+	tx, err := pqConn.Begin()
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not open bot activate transaction: %s", err.Error())
+	}
+	//nolint: errcheck
+	defer tx.Rollback()
+
+	if isActive {
+		_, err = tx.Exec(`UPDATE bots SET is_active = false FROM bots b
+			WHERE b.id = $1 AND bots.author_id = b.author_id AND bots.game_slug = b.game_slug
+			AND bots.id <> b.id AND bots.is_active = true;`, botID)
+		if err != nil {
+			return errors.Wrapf(utils.ErrInternal, "can not deactivate other bots: %v", err)
+		}
+	}
+
+	// активировать можно только проверенного бота не из архива
+	row := tx.QueryRow(`UPDATE bots SET is_active = $1 WHERE bots.id = $2
+		AND ((bots.is_verified = true AND bots.is_archived = false) OR $1 = false) RETURNING bots.id;`, isActive, botID)
+	var id int64
+	if err = row.Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return errors.Wrapf(utils.ErrInvalid, "bot does not exist, is not verified or archived: %v", err)
+		}
+
+		return errors.Wrapf(utils.ErrInternal, "can not update bot row: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not commit bot activate transaction: %v", err)
+	}
+
+	return nil
+}
+
+// SetBotArchivedByID архивация или восстановление бота по ID.
+// Архивный бот не участвует в матчах, поэтому сразу деактивируется
+func (bd *AccessObject) SetBotArchivedByID(botID int64, isArchived bool) error {
+	row := pqConn.QueryRow(`UPDATE bots SET is_archived = $1, is_active = bots.is_active AND NOT $1
+									WHERE bots.id = $2 RETURNING bots.id;`, isArchived, botID)
+
+	var id int64
+	if err := row.Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return errors.Wrapf(utils.ErrNotExists, "now row to update: %v", err)
+		}
+
+		return errors.Wrapf(utils.ErrInternal, "can not update bot row: %v", err)
+	}
+
+	return nil
+}
+
 // GetBotByID получение бота по его идентификатору
 func (bd *AccessObject) GetBotByID(botID int64) (*BotModel, error) {
-	row := pqConn.QueryRow(`SELECT b.id, b.code, b.language,
-	b.is_active, b.is_verified, b.author_id, b.game_slug, b.score, b.games_played 
-	FROM bots b WHERE b.id=$1`, botID)
+	row := pqConn.QueryRow(`SELECT `+botFields+` FROM bots b WHERE b.id=$1`, botID)
 
-	bot := &BotModel{}
-	err := row.Scan(&bot.ID, &bot.Code,
-		&bot.Language, &bot.IsActive, &bot.IsVerified,
-		&bot.AuthorID, &bot.GameSlug, &bot.Score, &bot.GamesPlayed)
+	bot, err := scanBot(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.Wrapf(utils.ErrNotExists, "bot with this id does not exist: %v", err)
@@ -125,28 +395,39 @@ func (bd *AccessObject) GetBotByID(botID int64) (*BotModel, error) {
 	return bot, nil
 }
 
-// GetBotsByGameSlugAndAuthorID получение спика ботов для какой-либо игры и/или пользователя
+// GetBotsByGameSlugAndAuthorID получение спика ботов для какой-либо игры и/или пользователя.
+// Без автора это лидерборд, поэтому в нём только активные боты. Архивные боты автора
+// отдаются только при withArchived: их видит сам автор, чтобы было что восстановить.
+// Если задан activeSince, то остаются только боты, игравшие рейтинговые матчи после него
 func (bd *AccessObject) GetBotsByGameSlugAndAuthorID(authorID int64, game string,
-	limit, since int64) ([]*BotModel, error) {
+	limit, since int64, activeSince time.Time, withArchived bool) ([]*BotModel, error) {
 	args := []interface{}{}
-	query := `SELECT b.id, b.code, b.language,
-	b.is_active, b.is_verified, b.author_id, b.game_slug, b.score, b.games_played 
-	FROM bots b`
+	query := `SELECT ` + botFields + ` FROM bots b WHERE `
 	if authorID > 0 {
-		query += ` WHERE b.author_id = $1`
+		query += `b.author_id = $1`
 		args = append(args, authorID)
+		if !withArchived {
+			query += ` AND b.is_archived = false`
+		}
+	} else {
+		query += `b.is_active = true AND b.is_archived = false`
 	}
 
 	if game != "" {
-		if len(args) == 0 {
-			query += ` WHERE`
-		} else {
-			query += ` AND`
-		}
-		query += ` b.game_slug = $`
+		query += ` AND b.game_slug = $`
 		query += strconv.Itoa(len(args) + 1)
 		args = append(args, game)
 	}
+
+	if !activeSince.IsZero() {
+		query += ` AND EXISTS (SELECT 1 FROM rating_history h WHERE h.bot_id = b.id
+			AND h.reason = ANY($`
+		query += strconv.Itoa(len(args) + 1)
+		query += `) AND h.time > $`
+		query += strconv.Itoa(len(args) + 2)
+		query += `)`
+		args = append(args, pq.Array([]string{ratingReasonMatch, ratingReasonVerification}), activeSince)
+	}
 	query += " ORDER BY b.score DESC LIMIT $"
 	query += strconv.Itoa(len(args) + 1)
 	args = append(args, limit)
@@ -163,10 +444,7 @@ func (bd *AccessObject) GetBotsByGameSlugAndAuthorID(authorID int64, game string
 
 	bots := make([]*BotModel, 0)
 	for rows.Next() {
-		bot := &BotModel{}
-		err = rows.Scan(&bot.ID, &bot.Code,
-			&bot.Language, &bot.IsActive, &bot.IsVerified,
-			&bot.AuthorID, &bot.GameSlug, &bot.Score, &bot.GamesPlayed)
+		bot, err := scanBot(rows)
 		if err != nil {
 			return nil, errors.Wrapf(utils.ErrInternal, "get bots by game slug and author id scan bot error: %v", err)
 		}
@@ -176,17 +454,21 @@ func (bd *AccessObject) GetBotsByGameSlugAndAuthorID(authorID int64, game string
 	return bots, nil
 }
 
-// GetBotsForTesting выборка ботов для новой серии матчев
-func (bd *AccessObject) GetBotsForTesting(n int64, game string) ([]*BotModel, error) {
-	query := `(SELECT distinct * FROM (SELECT b.id, b.code, b.language,
-	b.is_active, b.is_verified, b.author_id, b.game_slug, b.score, b.games_played
-	FROM bots b WHERE b.is_verified = true AND b.game_slug = $1 AND b.games_played > 0 ORDER BY random() LIMIT $2) l) 
-	UNION
-	(SELECT b.id, b.code, b.language,
-	b.is_active, b.is_verified, b.author_id, b.game_slug, b.score, b.games_played
-	FROM bots b WHERE b.is_verified = true AND b.game_slug = $1 AND b.games_played = 0)`
-
-	rows, err := pqConn.Query(query, game, n)
+// GetBotsForTesting выборка ботов для новой серии матчев: первыми идут те,
+// кто меньше всех играл с момента since, среди равных -- случайные.
+// Считаются матчи между ботами на любых местах, матчи проверки с одним ботом -- нет
+func (bd *AccessObject) GetBotsForTesting(n int64, game string, since time.Time) ([]*BotModel, error) {
+	query := `SELECT ` + botFields + `, coalesce(r.recent, 0) AS recent
+	FROM bots b LEFT JOIN (
+		SELECT mp.bot_id, count(*) AS recent
+		FROM match_participants mp JOIN matches m ON m.id = mp.match_id
+		WHERE m.game_slug = $1 AND m.bot_2 IS NOT NULL AND m.time > $3
+		GROUP BY mp.bot_id
+	) r ON r.bot_id = b.id
+	WHERE b.is_verified = true AND b.is_active = true AND b.game_slug = $1
+	ORDER BY recent, random() LIMIT $2;`
+
+	rows, err := pqConn.Query(query, game, n, since)
 	if err != nil {
 		return nil, errors.Wrapf(utils.ErrInternal, "get bots for testing error: %v", err)
 	}
@@ -194,15 +476,175 @@ func (bd *AccessObject) GetBotsForTesting(n int64, game string) ([]*BotModel, er
 
 	bots := make([]*BotModel, 0)
 	for rows.Next() {
-		bot := &BotModel{}
-		err = rows.Scan(&bot.ID, &bot.Code,
-			&bot.Language, &bot.IsActive, &bot.IsVerified,
-			&bot.AuthorID, &bot.GameSlug, &bot.Score, &bot.GamesPlayed)
+		var recent int64
+		bot, err := scanBot(&extraScanner{row: rows, extra: []interface{}{&recent}})
 		if err != nil {
 			return nil, errors.Wrapf(utils.ErrInternal, "get bots for testing scan bot error: %v", err)
 		}
+		bot.RecentGames = recent
 		bots = append(bots, bot)
 	}
 
 	return bots, nil
 }
+
+// CreateVersion создание новой версии кода для существующего бота
+func (bd *AccessObject) CreateVersion(v *BotVersionModel) error {
+	tx, err := pqConn.Begin()
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not open bot version create transaction: %s", err.Error())
+	}
+	//nolint: errcheck
+	defer tx.Rollback()
+
+	// блокируем бота, чтобы номера версий не пересеклись
+	row := tx.QueryRow(`SELECT b.id FROM bots b WHERE b.id = $1 FOR UPDATE`, v.BotID)
+	var id int64
+	if err = row.Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return errors.Wrapf(utils.ErrNotExists, "bot with this id does not exist: %v", err)
+		}
+
+		return errors.Wrapf(utils.ErrInternal, "can not lock bot row: %v", err)
+	}
+
+	row = tx.QueryRow(`INSERT INTO bot_versions (bot_id, version, code, language)
+		SELECT $1, COALESCE(MAX(v.version), 0) + 1, $2, $3 FROM bot_versions v WHERE v.bot_id = $1
+		RETURNING version, created`, &v.BotID, &v.Code, &v.Language)
+	if err = row.Scan(&v.Version, &v.Created); err != nil {
+		pgErr, ok := err.(*pq.Error)
+		if ok && pgErr.Code == "23505" {
+			return errors.Wrapf(utils.ErrTaken, "code duplication: %v", err)
+		}
+
+		return errors.Wrapf(utils.ErrInternal, "create bot version row error: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not commit bot version create transaction: %v", err)
+	}
+
+	return nil
+}
+
+// GetVersion получение конкретной версии кода бота
+func (bd *AccessObject) GetVersion(botID, version int64) (*BotVersionModel, error) {
+	row := pqConn.QueryRow(`SELECT v.bot_id, v.version, v.code, v.language, v.is_verified, v.created
+	FROM bot_versions v WHERE v.bot_id = $1 AND v.version = $2`, botID, version)
+
+	v := &BotVersionModel{}
+	err := row.Scan(&v.BotID, &v.Version, &v.Code, &v.Language, &v.IsVerified, &v.Created)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.Wrapf(utils.ErrNotExists, "bot version does not exist: %v", err)
+		}
+
+		return nil, errors.Wrapf(utils.ErrInternal, "can not get bot version: %v", err)
+	}
+
+	return v, nil
+}
+
+// GetVersionsByBotID получение истории версий бота, начиная с последней
+func (bd *AccessObject) GetVersionsByBotID(botID int64) ([]*BotVersionModel, error) {
+	rows, err := pqConn.Query(`SELECT v.bot_id, v.version, v.code, v.language, v.is_verified, v.created
+	FROM bot_versions v WHERE v.bot_id = $1 ORDER BY v.version DESC`, botID)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "get bot versions error: %v", err)
+	}
+	defer rows.Close()
+
+	versions := make([]*BotVersionModel, 0)
+	for rows.Next() {
+		v := &BotVersionModel{}
+		err = rows.Scan(&v.BotID, &v.Version, &v.Code, &v.Language, &v.IsVerified, &v.Created)
+		if err != nil {
+			return nil, errors.Wrapf(utils.ErrInternal, "get bot versions scan error: %v", err)
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, nil
+}
+
+// SetVersionVerified установка флага проверки для версии бота.
+// Прошедшая проверку версия становится активной, а бот, который
+// проверяется впервые, получает начальный рейтинг. Если код версии уже есть у другого
+// бота автора или другой бот автора стал активным одновременно с этим, возвращается ErrTaken
+func (bd *AccessObject) SetVersionVerified(botID, version int64, isVerified bool, initial Rating) error {
+	tx, err := pqConn.Begin()
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not open bot verify transaction: %s", err.Error())
+	}
+	//nolint: errcheck
+	defer tx.Rollback()
+
+	row := tx.QueryRow(`UPDATE bot_versions SET is_verified = $1
+		WHERE bot_id = $2 AND version = $3 RETURNING version;`, isVerified, botID, version)
+	var v int64
+	if err = row.Scan(&v); err != nil {
+		if err == sql.ErrNoRows {
+			return errors.Wrapf(utils.ErrNotExists, "now row to update: %v", err)
+		}
+
+		return errors.Wrapf(utils.ErrInternal, "can not update bot version row: %v", err)
+	}
+
+	if isVerified {
+		// отпечаток старого кода больше не годится, он пересчитается при следующей проверке сходства
+		_, err = tx.Exec(`UPDATE bots b SET version = v.version, code = v.code, language = v.language,
+			fingerprints = NULL,
+			score = CASE WHEN b.is_verified OR b.games_played > 0 THEN b.score ELSE $3 END,
+			score_deviation = CASE WHEN b.is_verified OR b.games_played > 0 THEN b.score_deviation ELSE $4 END,
+			score_volatility = CASE WHEN b.is_verified OR b.games_played > 0 THEN b.score_volatility ELSE $5 END,
+			is_active = b.is_active OR (b.is_archived = false AND NOT EXISTS (SELECT 1 FROM bots o
+				WHERE o.author_id = b.author_id AND o.game_slug = b.game_slug AND o.is_active = true AND o.id <> b.id)),
+			is_verified = true
+			FROM bot_versions v WHERE b.id = $1 AND v.bot_id = b.id AND v.version = $2;`,
+			botID, version, initial.Score, initial.Deviation, initial.Volatility)
+		if err != nil {
+			if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+				return errors.Wrapf(utils.ErrTaken, "code duplication or another active bot: %v", err)
+			}
+
+			return errors.Wrapf(utils.ErrInternal, "can not activate bot version: %v", err)
+		}
+
+		_, err = tx.Exec(`INSERT INTO rating_history (bot_id, version, score, score_deviation, reason)
+			SELECT b.id, b.version, b.score, b.score_deviation, $2 FROM bots b WHERE b.id = $1;`,
+			botID, ratingReasonVerification)
+		if err != nil {
+			return errors.Wrapf(utils.ErrInternal, "can not insert rating history row: %v", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not commit bot verify transaction: %v", err)
+	}
+
+	return nil
+}
+
+// SetActiveVersion откат бота на одну из проверенных версий
+func (bd *AccessObject) SetActiveVersion(botID, version int64) error {
+	row := pqConn.QueryRow(`UPDATE bots b SET version = v.version, code = v.code, language = v.language,
+		fingerprints = NULL FROM bot_versions v WHERE b.id = $1 AND v.bot_id = b.id AND v.version = $2 AND v.is_verified = true
+		RETURNING b.id;`, botID, version)
+
+	var id int64
+	if err := row.Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return errors.Wrapf(utils.ErrNotExists, "no verified version to activate: %v", err)
+		}
+
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			return errors.Wrapf(utils.ErrTaken, "code duplication: %v", err)
+		}
+
+		return errors.Wrapf(utils.ErrInternal, "can not activate bot version: %v", err)
+	}
+
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/HotCodeGroup/warscript-utils/utils"
@@ -22,6 +23,9 @@ func TestCreateOK(t *testing.T) {
 	mock.ExpectQuery("INSERT INTO bots").
 		WithArgs("111", "JS", 123, "pong").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("INSERT INTO bot_versions").
+		WithArgs(1, 1, "111", "JS").
+		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
 	pqConn = db
@@ -102,7 +106,7 @@ func TestBotCreateTakenError(t *testing.T) {
 	mock.ExpectBegin()
 	mock.ExpectQuery("INSERT INTO bots").
 		WithArgs("111", "JS", 123, "pong").
-		WillReturnError(pq.Error{Code: "23505"})
+		WillReturnError(&pq.Error{Code: "23505"})
 	mock.ExpectRollback()
 
 	botCreateError(t, db, mock, utils.ErrTaken)
@@ -118,7 +122,7 @@ func TestBotCreateInternalPQError(t *testing.T) {
 	mock.ExpectBegin()
 	mock.ExpectQuery("INSERT INTO bots").
 		WithArgs("111", "JS", 123, "pong").
-		WillReturnError(pq.Error{Code: "1337"})
+		WillReturnError(&pq.Error{Code: "1337"})
 	mock.ExpectRollback()
 
 	botCreateError(t, db, mock, utils.ErrInternal)
@@ -135,6 +139,9 @@ func TestBotCreateCommitError(t *testing.T) {
 	mock.ExpectQuery("INSERT INTO bots").
 		WithArgs("111", "JS", 123, "pong").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("INSERT INTO bot_versions").
+		WithArgs(1, 1, "111", "JS").
+		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit().WillReturnError(sql.ErrConnDone)
 
 	botCreateError(t, db, mock, utils.ErrInternal)
@@ -212,7 +219,7 @@ func TestSetBotScoreByIDok(t *testing.T) {
 	defer db.Close()
 
 	mock.ExpectExec("UPDATE bots").
-		WithArgs(15, 1).
+		WithArgs(15.0, 1).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	pqConn = db
@@ -235,7 +242,7 @@ func TestSetBotScoreByIDInternal(t *testing.T) {
 	defer db.Close()
 
 	mock.ExpectExec("UPDATE bots").
-		WithArgs(15, 1).
+		WithArgs(15.0, 1).
 		WillReturnError(sql.ErrConnDone)
 
 	pqConn = db
@@ -259,15 +266,15 @@ func TestGetBotsByGameSlugAndAuthorIDok(t *testing.T) {
 	defer db.Close()
 
 	mock.ExpectQuery("SELECT").
-		WithArgs(1, "pong").
+		WithArgs(1, "pong", 10, 0).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "language",
-			"is_active", "is_verified", "author_id", "game_slug", "score", "games_played"}).
-			AddRow(1, "a=5;", "JS", true, true, 1, "pong", 500, 1))
+			"is_active", "is_verified", "is_archived", "author_id", "game_slug", "score", "score_deviation", "score_volatility", "games_played", "wins", "losses", "draws", "version"}).
+			AddRow(1, "a=5;", "JS", true, true, false, 1, "pong", 500.0, 350.0, 0.06, 1, 1, 0, 0, 1))
 
 	pqConn = db
 	Bots = &AccessObject{}
 
-	botModel, err := Bots.GetBotsByGameSlugAndAuthorID(1, "pong", 10, 0)
+	botModel, err := Bots.GetBotsByGameSlugAndAuthorID(1, "pong", 10, 0, time.Time{}, false)
 	if err != nil {
 		t.Errorf("GetBotsByGameSlugAndAuthorID got unexpected error: %v", err)
 	}
@@ -282,7 +289,11 @@ func TestGetBotsByGameSlugAndAuthorIDok(t *testing.T) {
 			AuthorID:    1,
 			GameSlug:    "pong",
 			Score:       500,
+			Deviation:   350,
+			Volatility:  0.06,
 			GamesPlayed: 1,
+			Wins:        1,
+			Version:     1,
 		},
 	}
 
@@ -303,13 +314,13 @@ func TestGetBotsByGameSlugAndAuthorIDInternal(t *testing.T) {
 	defer db.Close()
 
 	mock.ExpectQuery("SELECT").
-		WithArgs(1, "pong").
+		WithArgs(1, "pong", 10, 0).
 		WillReturnError(sql.ErrConnDone)
 
 	pqConn = db
 	Bots = &AccessObject{}
 
-	_, err = Bots.GetBotsByGameSlugAndAuthorID(1, "pong", 10, 0)
+	_, err = Bots.GetBotsByGameSlugAndAuthorID(1, "pong", 10, 0, time.Time{}, false)
 	if errors.Cause(err) != utils.ErrInternal {
 		t.Errorf("TestGetBotsByGameSlugAndAuthorIDInternal got unexpected error: %v", err)
 	}
@@ -327,15 +338,15 @@ func TestGetBotsByGameSlugAndAuthorIDScanInternal(t *testing.T) {
 	defer db.Close()
 
 	mock.ExpectQuery("SELECT").
-		WithArgs("pong").
+		WithArgs("pong", 10, 0).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "language",
-			"is_active", "is_verified", "author_id", "game_slug", "score", "games_played"}).
-			AddRow("kek", "a=5;", "JS", true, true, 1, "pong", 500, 1))
+			"is_active", "is_verified", "is_archived", "author_id", "game_slug", "score", "score_deviation", "score_volatility", "games_played", "wins", "losses", "draws", "version"}).
+			AddRow("kek", "a=5;", "JS", true, true, false, 1, "pong", 500.0, 350.0, 0.06, 1, 1, 0, 0, 1))
 
 	pqConn = db
 	Bots = &AccessObject{}
 
-	_, err = Bots.GetBotsByGameSlugAndAuthorID(0, "pong", 10, 0)
+	_, err = Bots.GetBotsByGameSlugAndAuthorID(0, "pong", 10, 0, time.Time{}, false)
 	if errors.Cause(err) != utils.ErrInternal {
 		t.Errorf("TestGetBotsByGameSlugAndAuthorIDInternal got unexpected error: %v", err)
 	}
@@ -345,6 +356,155 @@ func TestGetBotsByGameSlugAndAuthorIDScanInternal(t *testing.T) {
 	}
 }
 
+func TestGetBotsByGameSlugAndAuthorIDActiveSince(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	activeSince := time.Now()
+	mock.ExpectQuery("EXISTS").
+		WithArgs("pong", pq.Array([]string{"match", "verification"}), activeSince, 10, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "language",
+			"is_active", "is_verified", "is_archived", "author_id", "game_slug", "score", "score_deviation", "score_volatility", "games_played", "wins", "losses", "draws", "version"}))
+
+	pqConn = db
+	Bots = &AccessObject{}
+
+	if _, err = Bots.GetBotsByGameSlugAndAuthorID(0, "pong", 10, 0, activeSince, false); err != nil {
+		t.Errorf("TestGetBotsByGameSlugAndAuthorIDActiveSince got unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestGetBotsByGameSlugAndAuthorIDActiveSince there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetBotsByGameSlugAndAuthorIDWithArchived(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	// автору в его списке отдаются и архивные боты
+	mock.ExpectQuery(`WHERE b.author_id = \$1 AND b.game_slug = \$2 ORDER BY`).
+		WithArgs(1, "pong", 10, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "language",
+			"is_active", "is_verified", "is_archived", "author_id", "game_slug", "score", "score_deviation", "score_volatility", "games_played", "wins", "losses", "draws", "version"}).
+			AddRow(1, "a=5;", "JS", false, true, true, 1, "pong", 500.0, 350.0, 0.06, 1, 1, 0, 0, 1))
+
+	pqConn = db
+	Bots = &AccessObject{}
+
+	bots, err := Bots.GetBotsByGameSlugAndAuthorID(1, "pong", 10, 0, time.Time{}, true)
+	if err != nil || len(bots) != 1 || !bots[0].IsArchived {
+		t.Errorf("TestGetBotsByGameSlugAndAuthorIDWithArchived got unexpected result: %v, %v", bots, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestGetBotsByGameSlugAndAuthorIDWithArchived there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetGameSlugsOK(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT DISTINCT b.game_slug").
+		WillReturnRows(sqlmock.NewRows([]string{"game_slug"}).AddRow("2atod").AddRow("pong"))
+
+	pqConn = db
+	Bots = &AccessObject{}
+
+	slugs, err := Bots.GetGameSlugs()
+	if err != nil || !reflect.DeepEqual(slugs, []string{"2atod", "pong"}) {
+		t.Errorf("TestGetGameSlugsOK got unexpected result: %v, %v", slugs, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestGetGameSlugsOK there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDecayInactiveBotsOK(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	inactive, decayed := time.Now().Add(-7*24*time.Hour), time.Now().Add(-24*time.Hour)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT").
+		WithArgs("pong", pq.Array([]string{"match", "verification"}), inactive, "decay", decayed).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version", "score", "score_deviation", "score_volatility"}).
+			AddRow(1, 2, 900.0, 0.0, 0.0).
+			AddRow(2, 1, 400.0, 0.0, 0.0))
+	mock.ExpectExec("UPDATE bots").
+		WithArgs(890.0, 0.0, 0.0, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO rating_history").
+		WithArgs(1, nil, 2, 890.0, 0.0, "decay").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	pqConn = db
+	Bots = &AccessObject{}
+
+	n, err := Bots.DecayInactiveBots("pong", inactive, decayed, func(r Rating) Rating {
+		if r.Score > 400 {
+			r.Score -= 10
+		}
+		return r
+	})
+	if err != nil || n != 1 {
+		t.Errorf("TestDecayInactiveBotsOK got unexpected result: %d, %v", n, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestDecayInactiveBotsOK there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUpdateIdleRatingsSkipsInactive(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	activeSince := time.Now().Add(-14 * 24 * time.Hour)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .* AND NOT .* AND EXISTS .* FOR UPDATE OF b").
+		WithArgs("pong", pq.Array([]int64{2, 3}), pq.Array([]string{"match", "verification"}), activeSince).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "score", "score_deviation", "score_volatility"}).
+			AddRow(1, 1500.0, 50.0, 0.06))
+	mock.ExpectExec("UPDATE bots").
+		WithArgs(1500.0, 60.0, 0.06, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	pqConn = db
+	Bots = &AccessObject{}
+
+	err = Bots.UpdateIdleRatings("pong", []int64{2, 3}, activeSince, func(r Rating) Rating {
+		r.Deviation += 10
+		return r
+	})
+	if err != nil {
+		t.Errorf("TestUpdateIdleRatingsSkipsInactive got unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestUpdateIdleRatingsSkipsInactive there were unfulfilled expectations: %s", err)
+	}
+}
+
 //nolint: dupl
 func TestGetBotsForTestingOK(t *testing.T) {
 	db, mock, err := sqlmock.New()
@@ -353,16 +513,18 @@ func TestGetBotsForTestingOK(t *testing.T) {
 	}
 	defer db.Close()
 
+	since := time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)
+
 	mock.ExpectQuery("SELECT").
-		WithArgs("pong", 2).
+		WithArgs("pong", 2, since).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "language",
-			"is_active", "is_verified", "author_id", "game_slug", "score", "games_played"}).
-			AddRow(1, "a=5;", "JS", true, true, 1, "pong", 500, 1))
+			"is_active", "is_verified", "is_archived", "author_id", "game_slug", "score", "score_deviation", "score_volatility", "games_played", "wins", "losses", "draws", "version", "recent"}).
+			AddRow(1, "a=5;", "JS", true, true, false, 1, "pong", 500.0, 350.0, 0.06, 1, 1, 0, 0, 1, 3))
 
 	pqConn = db
 	Bots = &AccessObject{}
 
-	botModel, err := Bots.GetBotsForTesting(2, "pong")
+	botModel, err := Bots.GetBotsForTesting(2, "pong", since)
 	if err != nil {
 		t.Errorf("GetBotsByGameSlugAndAuthorID got unexpected error: %v", err)
 	}
@@ -377,7 +539,12 @@ func TestGetBotsForTestingOK(t *testing.T) {
 			AuthorID:    1,
 			GameSlug:    "pong",
 			Score:       500,
+			Deviation:   350,
+			Volatility:  0.06,
 			GamesPlayed: 1,
+			Wins:        1,
+			Version:     1,
+			RecentGames: 3,
 		},
 	}
 
@@ -398,13 +565,13 @@ func TestGetBotsForTestingInternal(t *testing.T) {
 	defer db.Close()
 
 	mock.ExpectQuery("SELECT").
-		WithArgs("pong", 2).
+		WithArgs("pong", 2, sqlmock.AnyArg()).
 		WillReturnError(sql.ErrConnDone)
 
 	pqConn = db
 	Bots = &AccessObject{}
 
-	_, err = Bots.GetBotsForTesting(2, "pong")
+	_, err = Bots.GetBotsForTesting(2, "pong", time.Now())
 	if errors.Cause(err) != utils.ErrInternal {
 		t.Errorf("TestGetBotsByGameSlugAndAuthorIDInternal got unexpected error: %v", err)
 	}
@@ -422,15 +589,15 @@ func TestGetBotsForTestingScanInternal(t *testing.T) {
 	defer db.Close()
 
 	mock.ExpectQuery("SELECT").
-		WithArgs("pong", 2).
+		WithArgs("pong", 2, sqlmock.AnyArg()).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "language",
-			"is_active", "is_verified", "author_id", "game_slug", "score", "games_played"}).
-			AddRow("kek", "a=5;", "JS", true, true, 1, "pong", 500, 1))
+			"is_active", "is_verified", "is_archived", "author_id", "game_slug", "score", "score_deviation", "score_volatility", "games_played", "wins", "losses", "draws", "version", "recent"}).
+			AddRow("kek", "a=5;", "JS", true, true, false, 1, "pong", 500.0, 350.0, 0.06, 1, 1, 0, 0, 1, 0))
 
 	pqConn = db
 	Bots = &AccessObject{}
 
-	_, err = Bots.GetBotsForTesting(2, "pong")
+	_, err = Bots.GetBotsForTesting(2, "pong", time.Now())
 	if errors.Cause(err) != utils.ErrInternal {
 		t.Errorf("TestGetBotsByGameSlugAndAuthorIDInternal got unexpected error: %v", err)
 	}
@@ -439,3 +606,308 @@ func TestGetBotsForTestingScanInternal(t *testing.T) {
 		t.Errorf("TestGetBotsByGameSlugAndAuthorIDInternal there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestCreateVersionOK(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT b.id FROM bots").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("INSERT INTO bot_versions").
+		WithArgs(1, "222", "JS").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "created"}).AddRow(2, time.Time{}))
+	mock.ExpectCommit()
+
+	pqConn = db
+	Bots = &AccessObject{}
+
+	v := &BotVersionModel{
+		BotID:    1,
+		Code:     "222",
+		Language: "JS",
+	}
+
+	if err = Bots.CreateVersion(v); err != nil {
+		t.Errorf("TestCreateVersionOK got unexpected error: %v", err)
+	}
+
+	if v.Version != 2 {
+		t.Errorf("TestCreateVersionOK got unexpected version: %d, expected: 2", v.Version)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestCreateVersionOK there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionNotExists(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT b.id FROM bots").
+		WithArgs(1).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	pqConn = db
+	Bots = &AccessObject{}
+
+	err = Bots.CreateVersion(&BotVersionModel{BotID: 1, Code: "222", Language: "JS"})
+	if errors.Cause(err) != utils.ErrNotExists {
+		t.Errorf("TestCreateVersionNotExists got unexpected error: %v, expected: %v", err, utils.ErrNotExists)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestCreateVersionNotExists there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionTaken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT b.id FROM bots").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("INSERT INTO bot_versions").
+		WithArgs(1, "222", "JS").
+		WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectRollback()
+
+	pqConn = db
+	Bots = &AccessObject{}
+
+	err = Bots.CreateVersion(&BotVersionModel{BotID: 1, Code: "222", Language: "JS"})
+	if errors.Cause(err) != utils.ErrTaken {
+		t.Errorf("TestCreateVersionTaken got unexpected error: %v, expected: %v", err, utils.ErrTaken)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestCreateVersionTaken there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetVersionVerifiedOK(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE bot_versions").
+		WithArgs(true, 1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+	mock.ExpectExec("UPDATE bots").
+		WithArgs(1, 2, 400.0, 350.0, 0.06).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO rating_history").
+		WithArgs(1, "verification").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	pqConn = db
+	Bots = &AccessObject{}
+
+	initial := Rating{Score: 400, Deviation: 350, Volatility: 0.06}
+	if err = Bots.SetVersionVerified(1, 2, true, initial); err != nil {
+		t.Errorf("TestSetVersionVerifiedOK got unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestSetVersionVerifiedOK there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetVersionVerifiedFailed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	// непрошедшая проверку версия не трогает активную
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE bot_versions").
+		WithArgs(false, 1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+	mock.ExpectCommit()
+
+	pqConn = db
+	Bots = &AccessObject{}
+
+	if err = Bots.SetVersionVerified(1, 2, false, Rating{}); err != nil {
+		t.Errorf("TestSetVersionVerifiedFailed got unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestSetVersionVerifiedFailed there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetVersionVerifiedCodeTaken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE bot_versions").
+		WithArgs(true, 1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+	mock.ExpectExec("UPDATE bots").
+		WithArgs(1, 2, 400.0, 350.0, 0.06).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "unique_code"})
+	mock.ExpectRollback()
+
+	pqConn = db
+	Bots = &AccessObject{}
+
+	initial := Rating{Score: 400, Deviation: 350, Volatility: 0.06}
+	if err = Bots.SetVersionVerified(1, 2, true, initial); errors.Cause(err) != utils.ErrTaken {
+		t.Errorf("TestSetVersionVerifiedCodeTaken got unexpected error: %v, expected: %v", err, utils.ErrTaken)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestSetVersionVerifiedCodeTaken there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetActiveVersionNotVerified(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("UPDATE bots").
+		WithArgs(1, 3).
+		WillReturnError(sql.ErrNoRows)
+
+	pqConn = db
+	Bots = &AccessObject{}
+
+	if err = Bots.SetActiveVersion(1, 3); errors.Cause(err) != utils.ErrNotExists {
+		t.Errorf("TestSetActiveVersionNotVerified got unexpected error: %v, expected: %v", err, utils.ErrNotExists)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestSetActiveVersionNotVerified there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetBotActiveByIDOK(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE bots SET is_active = false").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("UPDATE bots SET is_active").
+		WithArgs(true, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	pqConn = db
+	Bots = &AccessObject{}
+
+	if err = Bots.SetBotActiveByID(1, true); err != nil {
+		t.Errorf("TestSetBotActiveByIDOK got unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestSetBotActiveByIDOK there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetBotActiveByIDNotVerified(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE bots SET is_active = false").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("UPDATE bots SET is_active").
+		WithArgs(true, 1).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	pqConn = db
+	Bots = &AccessObject{}
+
+	if err = Bots.SetBotActiveByID(1, true); errors.Cause(err) != utils.ErrInvalid {
+		t.Errorf("TestSetBotActiveByIDNotVerified got unexpected error: %v, expected: %v", err, utils.ErrInvalid)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestSetBotActiveByIDNotVerified there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetBotArchivedByIDOK(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("UPDATE bots SET is_archived").
+		WithArgs(true, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	pqConn = db
+	Bots = &AccessObject{}
+
+	if err = Bots.SetBotArchivedByID(1, true); err != nil {
+		t.Errorf("TestSetBotArchivedByIDOK got unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestSetBotArchivedByIDOK there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetBotArchivedByIDNotExists(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("UPDATE bots SET is_archived").
+		WithArgs(false, 1).
+		WillReturnError(sql.ErrNoRows)
+
+	pqConn = db
+	Bots = &AccessObject{}
+
+	if err = Bots.SetBotArchivedByID(1, false); errors.Cause(err) != utils.ErrNotExists {
+		t.Errorf("TestSetBotArchivedByIDNotExists got unexpected error: %v, expected: %v", err, utils.ErrNotExists)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestSetBotArchivedByIDNotExists there were unfulfilled expectations: %s", err)
+	}
+}
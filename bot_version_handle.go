@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/HotCodeGroup/warscript-utils/models"
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// CreateBotVersion загрузка новой версии кода бота + отправка её на проверку.
+// Активной версия станет только после успешной проверки
+func CreateBotVersion(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger(r, logger, "CreateBotVersion")
+	errWriter := utils.NewErrorResponseWriter(w, logger)
+	info := SessionInfo(r)
+	if info == nil {
+		errWriter.WriteWarn(http.StatusUnauthorized, errors.New("session info is not presented"))
+		return
+	}
+
+	form := &BotVersionUpload{}
+	err := utils.DecodeBodyJSON(r.Body, form)
+	if err != nil {
+		errWriter.WriteWarn(http.StatusBadRequest, errors.Wrap(err, "decode body error"))
+		return
+	}
+
+	if err = form.Validate(); err != nil {
+		// уверены в преобразовании
+		errWriter.WriteValidationError(err.(*utils.ValidationError))
+		return
+	}
+
+	bot := getAuthorBot(r, errWriter, info)
+	if bot == nil {
+		return
+	}
+
+	if bot.IsArchived {
+		errWriter.WriteWarn(http.StatusConflict, errors.New("bot is archived"))
+		return
+	}
+
+	gameInfo, err := gamesGPRC.GetGameBySlug(context.Background(), &models.GameSlug{Slug: bot.GameSlug})
+	if err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "can not get bot game"))
+		return
+	}
+
+	version := &BotVersionModel{
+		BotID:    bot.ID,
+		Code:     form.Code,
+		Language: string(form.Language),
+	}
+	if err = Bots.CreateVersion(version); err != nil {
+		if errors.Cause(err) == utils.ErrTaken {
+			errWriter.WriteValidationError(&utils.ValidationError{
+				"code": utils.ErrTaken.Error(),
+			})
+			return
+		}
+
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "bot version create error"))
+		return
+	}
+
+	verification, jobID, err := startVerification(&VerificationModel{
+		BotID:    bot.ID,
+		Version:  version.Version,
+		AuthorID: info.ID,
+		GameSlug: gameInfo.Slug,
+	}, &TestPlayer{Code: form.Code, Lang: form.Language}, gameInfo.BotCode)
+	if err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "can not start verification"))
+		return
+	}
+	utils.WriteApplicationJSON(w, http.StatusOK, &BotVersion{
+		Version:        version.Version,
+		Language:       form.Language,
+		IsVerified:     version.IsVerified,
+		IsActive:       false,
+		Created:        version.Created,
+		Code:           version.Code,
+		JobID:          jobID,
+		VerificationID: verification.ID,
+	})
+}
+
+// GetBotVersions получение истории версий бота.
+// Код версий видит только автор
+func GetBotVersions(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger(r, logger, "GetBotVersions")
+	errWriter := utils.NewErrorResponseWriter(w, logger)
+
+	botID, err := strconv.ParseInt(mux.Vars(r)["bot_id"], 10, 64)
+	if err != nil {
+		errWriter.WriteWarn(http.StatusNotFound, errors.Wrap(err, "wrong format bot_id"))
+		return
+	}
+
+	bot, err := Bots.GetBotByID(botID)
+	if err != nil {
+		if errors.Cause(err) == utils.ErrNotExists {
+			errWriter.WriteWarn(http.StatusNotFound, errors.Wrap(err, "bot not exists"))
+		} else {
+			errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get bot method error"))
+		}
+		return
+	}
+
+	versions, err := Bots.GetVersionsByBotID(bot.ID)
+	if err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get bot versions method error"))
+		return
+	}
+
+	session, err := OptionalSessionInfo(r)
+	if err != nil {
+		logger.Warnf("can't get session by token: %v", err)
+	}
+	isAuthor := session != nil && session.ID == bot.AuthorID
+
+	respVersions := make([]*BotVersion, len(versions))
+	for i, v := range versions {
+		respVersions[i] = &BotVersion{
+			Version:    v.Version,
+			Language:   Lang(v.Language),
+			IsVerified: v.IsVerified,
+			IsActive:   v.Version == bot.Version,
+			Created:    v.Created,
+		}
+
+		if isAuthor {
+			respVersions[i].Code = v.Code
+		}
+	}
+
+	utils.WriteApplicationJSON(w, http.StatusOK, respVersions)
+}
+
+// RollbackBot смена активной версии бота на одну из ранее проверенных
+func RollbackBot(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger(r, logger, "RollbackBot")
+	errWriter := utils.NewErrorResponseWriter(w, logger)
+	info := SessionInfo(r)
+	if info == nil {
+		errWriter.WriteWarn(http.StatusUnauthorized, errors.New("session info is not presented"))
+		return
+	}
+
+	form := &BotRollback{}
+	err := utils.DecodeBodyJSON(r.Body, form)
+	if err != nil {
+		errWriter.WriteWarn(http.StatusBadRequest, errors.Wrap(err, "decode body error"))
+		return
+	}
+
+	bot := getAuthorBot(r, errWriter, info)
+	if bot == nil {
+		return
+	}
+
+	if err = Bots.SetActiveVersion(bot.ID, form.Version); err != nil {
+		switch errors.Cause(err) {
+		case utils.ErrNotExists:
+			errWriter.WriteValidationError(&utils.ValidationError{
+				"version": utils.ErrInvalid.Error(),
+			})
+		case utils.ErrTaken:
+			errWriter.WriteValidationError(&utils.ValidationError{
+				"code": utils.ErrTaken.Error(),
+			})
+		default:
+			errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "set active version method error"))
+		}
+		return
+	}
+
+	bot, err = Bots.GetBotByID(bot.ID)
+	if err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get bot method error"))
+		return
+	}
+	go checkSimilarity(bot)
+
+	writeAuthorBot(w, errWriter, bot)
+}
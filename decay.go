@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// decayInterval как часто проверяются неактивные боты
+	decayInterval = time.Hour
+	// decayPeriod затухание одного бота не чаще раза в сутки
+	decayPeriod = 24 * time.Hour
+	// defaultInactiveDays после скольких дней без матчей бот скрывается
+	// из лидерборда игры без настроек затухания
+	defaultInactiveDays = 14
+	// defaultDecayScore сколько очков в сутки теряет неактивный бот в Elo
+	defaultDecayScore = 10
+	// defaultDecayDeviationShare какую долю начального отклонения в сутки
+	// набирает неактивный бот в системах с отклонением
+	defaultDecayDeviationShare = 0.1
+)
+
+var ratingDecayed = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "rating_decayed_bots_total",
+	Help: "Number of rating decays applied to inactive bots",
+}, []string{"game"})
+
+func init() {
+	prometheus.MustRegister(ratingDecayed)
+}
+
+// DecayConfig затухание рейтинга ботов, которые давно не играли рейтинговых матчей.
+// Если не заданы ни Score, ни Deviation, то Elo теряет очки, а Glicko-2 и TrueSkill
+// набирают неуверенность
+type DecayConfig struct {
+	// InactiveDays через сколько дней без рейтинговых матчей начинается затухание
+	InactiveDays int64 `json:"inactive_days"`
+	// Score сколько очков бот теряет за сутки
+	Score float64 `json:"score"`
+	// Deviation на сколько за сутки растёт отклонение рейтинга, но не выше начального
+	Deviation float64 `json:"deviation"`
+	// Floor ниже скольких очков затухание не опускает; по умолчанию начальные очки
+	Floor *float64 `json:"floor"`
+}
+
+// decayRating рейтинг бота после одних суток затухания
+func decayRating(system RatingSystem, config *DecayConfig, r Rating) Rating {
+	initial := system.Initial()
+	scoreLoss, deviationGrowth := config.Score, config.Deviation
+	if scoreLoss == 0 && deviationGrowth == 0 {
+		if initial.Deviation > 0 {
+			deviationGrowth = initial.Deviation * defaultDecayDeviationShare
+		} else {
+			scoreLoss = defaultDecayScore
+		}
+	}
+
+	floor := initial.Score
+	if config.Floor != nil {
+		floor = *config.Floor
+	}
+
+	if scoreLoss > 0 && r.Score > floor {
+		r.Score = math.Max(r.Score-scoreLoss, floor)
+	}
+	if deviationGrowth > 0 && r.Deviation < initial.Deviation {
+		r.Deviation = math.Min(r.Deviation+deviationGrowth, initial.Deviation)
+	}
+
+	return r
+}
+
+// inactiveSince с какого момента бот без рейтинговых матчей считается неактивным
+func inactiveSince(gameSlug string, now time.Time) time.Time {
+	days := int64(defaultInactiveDays)
+	if games != nil {
+		if game, ok := games.Get(gameSlug); ok && game.Decay != nil && game.Decay.InactiveDays > 0 {
+			days = game.Decay.InactiveDays
+		}
+	}
+
+	return now.Add(-time.Duration(days) * 24 * time.Hour)
+}
+
+// startDecay фоновое затухание рейтинга неактивных ботов, выполняется только лидером
+func startDecay(stop <-chan struct{}) {
+	for {
+		timer := time.NewTimer(decayInterval)
+		for _, game := range games.Enabled() {
+			decayGame(game, time.Now())
+		}
+
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func decayGame(game *GameConfig, now time.Time) {
+	if game.Decay == nil || game.Decay.InactiveDays <= 0 {
+		return
+	}
+
+	system := ratingSystemFor(game.Slug)
+	decayed, err := Bots.DecayInactiveBots(game.Slug, inactiveSince(game.Slug, now), now.Add(-decayPeriod),
+		func(r Rating) Rating {
+			return decayRating(system, game.Decay, r)
+		})
+	if err != nil {
+		logger.Error(errors.Wrapf(err, "can not decay ratings for game %s", game.Slug))
+		return
+	}
+
+	if decayed > 0 {
+		ratingDecayed.WithLabelValues(game.Slug).Add(float64(decayed))
+		logger.WithFields(logrus.Fields{
+			"game":   game.Slug,
+			"method": "decayGame",
+		}).Infof("decayed rating of %d inactive bots", decayed)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestDecayRatingElo(t *testing.T) {
+	rs, err := newRatingSystem(&RatingConfig{System: ratingSystemElo})
+	if err != nil {
+		t.Fatalf("TestDecayRatingElo got unexpected error: %v", err)
+	}
+
+	r := decayRating(rs, &DecayConfig{InactiveDays: 7}, Rating{Score: 900})
+	if r.Score != 900-defaultDecayScore {
+		t.Errorf("TestDecayRatingElo got unexpected score: %f", r.Score)
+	}
+
+	// ниже начальных очков затухание не опускает
+	r = decayRating(rs, &DecayConfig{InactiveDays: 7, Score: 50}, Rating{Score: 420})
+	if r.Score != defaultInitialScore {
+		t.Errorf("TestDecayRatingElo went below floor: %f", r.Score)
+	}
+}
+
+func TestDecayRatingGlicko(t *testing.T) {
+	rs, err := newRatingSystem(&RatingConfig{System: ratingSystemGlicko2})
+	if err != nil {
+		t.Fatalf("TestDecayRatingGlicko got unexpected error: %v", err)
+	}
+
+	init := rs.Initial()
+	r := decayRating(rs, &DecayConfig{InactiveDays: 7}, Rating{Score: 900, Deviation: 60})
+	if r.Score != 900 || r.Deviation <= 60 {
+		t.Errorf("TestDecayRatingGlicko got unexpected rating: %+v", r)
+	}
+
+	r = decayRating(rs, &DecayConfig{InactiveDays: 7, Deviation: 1000}, Rating{Score: 900, Deviation: 60})
+	if r.Deviation != init.Deviation {
+		t.Errorf("TestDecayRatingGlicko deviation exceeded initial: %f", r.Deviation)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// fingerprintK длина k-граммы в токенах
+	fingerprintK = 5
+	// fingerprintWindow окно winnowing: из каждых стольких подряд k-грамм
+	// в отпечаток попадает хотя бы одна
+	fingerprintWindow = 4
+
+	tokenIdent  = "I"
+	tokenNumber = "N"
+	tokenString = "S"
+)
+
+// langKeywords ключевые слова языков; остальные идентификаторы при нормализации
+// заменяются одной меткой, чтобы переименование переменных не меняло отпечаток
+var langKeywords = map[Lang]map[string]bool{
+	"JS": wordSet(`break case catch class const continue debugger default delete do else export
+		extends false finally for function if import in instanceof let new null return super switch
+		this throw true try typeof undefined var void while with yield async await of`),
+	"PY": wordSet(`False None True and as assert async await break class continue def del elif else
+		except finally for from global if import in is lambda nonlocal not or pass raise return try
+		while with yield`),
+	"LUA": wordSet(`and break do else elseif end false for function goto if in local nil not or
+		repeat return then true until while`),
+}
+
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+
+	return set
+}
+
+// lineComment начало однострочного комментария в языке
+func lineComment(lang Lang) string {
+	switch lang {
+	case "PY":
+		return "#"
+	case "LUA":
+		return "--"
+	}
+
+	return "//"
+}
+
+// normalizeTokens разбивает код на токены, выбрасывая пробелы и комментарии.
+// Идентификаторы, числа и строки заменяются метками, ключевые слова и операторы остаются
+func normalizeTokens(lang Lang, code string) []string {
+	keywords := langKeywords[lang]
+	comment := lineComment(lang)
+	src := []rune(code)
+
+	tokens := make([]string, 0, len(src)/4)
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case lang == "LUA" && hasPrefixAt(src, i, "--[["):
+			i = skipUntil(src, i+4, "]]")
+		case lang == "JS" && hasPrefixAt(src, i, "/*"):
+			i = skipUntil(src, i+2, "*/")
+		case hasPrefixAt(src, i, comment):
+			i = skipUntil(src, i+len(comment), "\n")
+		case c == '"' || c == '\'' || (lang == "JS" && c == '`'):
+			i++
+			for i < len(src) && src[i] != c {
+				if src[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i++
+			tokens = append(tokens, tokenString)
+		case unicode.IsDigit(c):
+			for i < len(src) && (unicode.IsLetter(src[i]) || unicode.IsDigit(src[i]) || src[i] == '.' || src[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, tokenNumber)
+		case unicode.IsLetter(c) || c == '_' || c == '$':
+			start := i
+			for i < len(src) && (unicode.IsLetter(src[i]) || unicode.IsDigit(src[i]) || src[i] == '_' || src[i] == '$') {
+				i++
+			}
+			if word := string(src[start:i]); keywords[word] {
+				tokens = append(tokens, word)
+			} else {
+				tokens = append(tokens, tokenIdent)
+			}
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+
+	return tokens
+}
+
+// hasPrefixAt начинается ли код с позиции i с prefix
+func hasPrefixAt(src []rune, i int, prefix string) bool {
+	p := []rune(prefix)
+	return i+len(p) <= len(src) && string(src[i:i+len(p)]) == prefix
+}
+
+// skipUntil позиция сразу после ближайшего end, начиная с from, или конец кода
+func skipUntil(src []rune, from int, end string) int {
+	for i := from; i < len(src); i++ {
+		if hasPrefixAt(src, i, end) {
+			return i + len([]rune(end))
+		}
+	}
+
+	return len(src)
+}
+
+// fingerprint отпечаток кода бота методом winnowing: хеши k-грамм нормализованных
+// токенов, из каждого окна которых берётся минимальный. Результат отсортирован и без повторов
+func fingerprint(lang Lang, code string) []int64 {
+	tokens := normalizeTokens(lang, code)
+	if len(tokens) == 0 {
+		return []int64{}
+	}
+
+	k := fingerprintK
+	if len(tokens) < k {
+		k = len(tokens)
+	}
+	hashes := make([]int64, 0, len(tokens)-k+1)
+	for i := 0; i+k <= len(tokens); i++ {
+		h := fnv.New64a()
+		//nolint: errcheck
+		h.Write([]byte(strings.Join(tokens[i:i+k], "\x00")))
+		hashes = append(hashes, int64(h.Sum64()))
+	}
+
+	w := fingerprintWindow
+	if len(hashes) < w {
+		w = len(hashes)
+	}
+	selected := make(map[int64]bool)
+	for i := 0; i+w <= len(hashes); i++ {
+		minimum := hashes[i]
+		for _, h := range hashes[i+1 : i+w] {
+			if h < minimum {
+				minimum = h
+			}
+		}
+		selected[minimum] = true
+	}
+
+	fp := make([]int64, 0, len(selected))
+	for h := range selected {
+		fp = append(fp, h)
+	}
+	sort.Slice(fp, func(i, j int) bool { return fp[i] < fp[j] })
+
+	return fp
+}
+
+// similarity доля общих хешей в меньшем из двух отпечатков: 1, если один код
+// целиком содержится в другом. Отпечатки должны быть отсортированы
+func similarity(a, b []int64) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	common := 0
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			common++
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	smaller := len(a)
+	if len(b) < smaller {
+		smaller = len(b)
+	}
+
+	return float64(common) / float64(smaller)
+}
@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+const fingerprintSample = `function move(state) {
+	// держимся ближе к мячу
+	var target = state.ball.y - state.me.height / 2;
+	if (target > state.me.y) {
+		return {dy: 1};
+	} else if (target < state.me.y) {
+		return {dy: -1};
+	}
+	return {dy: 0};
+}`
+
+func TestFingerprintIgnoresRenamesAndFormatting(t *testing.T) {
+	copied := `function step(s){var t=s.ball.y-s.me.height/2;/* copy */
+if(t>s.me.y){return {dy:1};}else if(t<s.me.y){return {dy:-1};} return {dy:0};}`
+
+	a, b := fingerprint("JS", fingerprintSample), fingerprint("JS", copied)
+	if len(a) < similarityMinFingerprints {
+		t.Fatalf("TestFingerprintIgnoresRenamesAndFormatting got too short fingerprint: %d", len(a))
+	}
+	if s := similarity(a, b); s != 1 {
+		t.Errorf("TestFingerprintIgnoresRenamesAndFormatting got similarity %f, expected 1", s)
+	}
+}
+
+func TestFingerprintDifferentCode(t *testing.T) {
+	other := `function move(state) {
+	for (let i = 0; i < state.enemies.length; i++) {
+		while (state.enemies[i].hp > 0) {
+			state.enemies[i].hp -= shoot(state.enemies[i]);
+		}
+	}
+	try { return state.history.pop(); } catch (e) { return null; }
+}`
+
+	if s := similarity(fingerprint("JS", fingerprintSample), fingerprint("JS", other)); s > 0.5 {
+		t.Errorf("TestFingerprintDifferentCode got similarity %f for unrelated code", s)
+	}
+}
+
+func TestNormalizeTokensComments(t *testing.T) {
+	tokens := normalizeTokens("LUA", "--[[ long\ncomment ]] local x = 'a' -- tail\nreturn x")
+	expected := []string{"local", tokenIdent, "=", tokenString, "return", tokenIdent}
+	if len(tokens) != len(expected) {
+		t.Fatalf("TestNormalizeTokensComments got unexpected tokens: %v", tokens)
+	}
+	for i := range tokens {
+		if tokens[i] != expected[i] {
+			t.Errorf("TestNormalizeTokensComments got unexpected tokens: %v, expected: %v", tokens, expected)
+			break
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HotCodeGroup/warscript-utils/models"
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+const (
+	gamesKey           = "warscript-bots/games"
+	gamesRefreshPeriod = time.Minute
+
+	defaultMinDailyGames   = int64(5)
+	defaultRematchCooldown = 30 * time.Minute
+)
+
+// defaultGameSlugs игры с настройками по умолчанию, если в consul нет своего списка.
+// У сервиса игр есть только GetGameBySlug, списка всех игр он не отдаёт
+var defaultGameSlugs = []string{"pong", "2atod"}
+
+// GameConfig настройки рейтинговых матчей для игры
+type GameConfig struct {
+	Slug    string        `json:"slug"`
+	Enabled *bool         `json:"enabled"`
+	Rating  *RatingConfig `json:"rating"`
+	// MaxRunning сколько задач игры может быть у тестеров одновременно
+	MaxRunning int64 `json:"max_running"`
+	// MinDailyGames сколько матчей за сутки гарантируется активному боту
+	MinDailyGames *int64 `json:"min_daily_games"`
+	// RematchCooldown сколько секунд пара ботов не играет повторно
+	RematchCooldown *int64 `json:"rematch_cooldown"`
+	// Players сколько ботов играет в одном матче, по умолчанию двое
+	Players int `json:"players"`
+	// Decay затухание рейтинга неактивных ботов; без настроек рейтинг не затухает
+	Decay *DecayConfig `json:"decay"`
+	// SimilarityThreshold с какого сходства кода боты попадают в отчёт для модераторов
+	SimilarityThreshold float64 `json:"similarity_threshold"`
+	// Verification набор матчей для проверки новых версий ботов
+	Verification *VerificationConfig `json:"verification"`
+
+	ratingSystem RatingSystem
+}
+
+// IsEnabled участвует ли игра в матчмейкинге; по умолчанию участвует
+func (gc *GameConfig) IsEnabled() bool {
+	return gc.Enabled == nil || *gc.Enabled
+}
+
+// maxRunning ограничение задач игры у тестеров
+func (gc *GameConfig) maxRunning() int64 {
+	if gc.MaxRunning <= 0 {
+		return gameMaxRunning
+	}
+
+	return gc.MaxRunning
+}
+
+// players число ботов в рейтинговом матче
+func (gc *GameConfig) players() int {
+	if gc.Players < 2 {
+		return 2
+	}
+
+	return gc.Players
+}
+
+// minDailyGames гарантированный минимум матчей бота за сутки
+func (gc *GameConfig) minDailyGames() int64 {
+	if gc.MinDailyGames == nil {
+		return defaultMinDailyGames
+	}
+
+	return *gc.MinDailyGames
+}
+
+// rematchCooldown сколько пара ботов не играет повторно
+func (gc *GameConfig) rematchCooldown() time.Duration {
+	if gc.RematchCooldown == nil {
+		return defaultRematchCooldown
+	}
+
+	return time.Duration(*gc.RematchCooldown) * time.Second
+}
+
+// gameRegistry список игр, для которых идут рейтинговые матчи.
+// Сервис игр умеет только GetGameBySlug и не отдаёт список всех игр, поэтому
+// список слагов с флагами лежит в consul, а оригинальные слаги и само
+// существование игры проверяются через gamesGPRC. Новую игру нужно добавить
+// в consul вручную; об играх с активными ботами, которых там нет, пишется предупреждение
+type gameRegistry struct {
+	kv *consulapi.KV
+
+	mu    sync.RWMutex
+	games []*GameConfig
+
+	// warned игры не из списка, о которых уже предупредили
+	warned map[string]bool
+}
+
+var games *gameRegistry
+
+func newGameRegistry(consul *consulapi.Client) *gameRegistry {
+	return &gameRegistry{
+		kv:     consul.KV(),
+		warned: make(map[string]bool),
+	}
+}
+
+// Enabled игры, для которых сейчас нужно подбирать матчи
+func (gr *gameRegistry) Enabled() []*GameConfig {
+	gr.mu.RLock()
+	defer gr.mu.RUnlock()
+
+	enabled := make([]*GameConfig, 0, len(gr.games))
+	for _, game := range gr.games {
+		if game.IsEnabled() {
+			enabled = append(enabled, game)
+		}
+	}
+
+	return enabled
+}
+
+// Get настройки игры по слагу
+func (gr *gameRegistry) Get(slug string) (*GameConfig, bool) {
+	gr.mu.RLock()
+	defer gr.mu.RUnlock()
+
+	for _, game := range gr.games {
+		if game.Slug == slug {
+			return game, true
+		}
+	}
+
+	return nil, false
+}
+
+// refresh перечитывает список игр. При ошибке остаётся старый список,
+// без ключа в consul -- игры по умолчанию
+func (gr *gameRegistry) refresh() error {
+	pair, _, err := gr.kv.Get(gamesKey, nil)
+	if err != nil {
+		return errors.Wrap(err, "can not get games from consul")
+	}
+
+	configs := make([]*GameConfig, 0, len(defaultGameSlugs))
+	if pair == nil {
+		for _, slug := range defaultGameSlugs {
+			configs = append(configs, &GameConfig{Slug: slug})
+		}
+	} else if err = json.Unmarshal(pair.Value, &configs); err != nil {
+		return errors.Wrap(err, "can not unmarshal games")
+	}
+
+	loaded := make([]*GameConfig, 0, len(configs))
+	for _, config := range configs {
+		// так как citext, то ориджинал слаг в gameInfo
+		gameInfo, err := gamesGPRC.GetGameBySlug(context.Background(), &models.GameSlug{Slug: config.Slug})
+		if err != nil {
+			logger.Warnf("skipping game %q: %v", config.Slug, err)
+			continue
+		}
+
+		config.ratingSystem, err = newRatingSystem(config.Rating)
+		if err != nil {
+			logger.Warnf("skipping game %q: bad rating config: %v", config.Slug, err)
+			continue
+		}
+
+		if config.Verification != nil {
+			if err = config.Verification.validate(); err != nil {
+				logger.Warnf("skipping game %q: bad verification config: %v", config.Slug, err)
+				continue
+			}
+		}
+
+		config.Slug = gameInfo.Slug
+		loaded = append(loaded, config)
+	}
+
+	gr.mu.Lock()
+	gr.games = loaded
+	gr.mu.Unlock()
+
+	gr.warnUnlisted(loaded)
+
+	return nil
+}
+
+// warnUnlisted предупреждение об играх, в которых есть активные боты, но которых нет в списке:
+// рейтинговых матчей в них не будет. О каждой игре предупреждаем один раз
+func (gr *gameRegistry) warnUnlisted(loaded []*GameConfig) {
+	slugs, err := Bots.GetGameSlugs()
+	if err != nil {
+		logger.Error(errors.Wrap(err, "can not get games of active bots"))
+		return
+	}
+
+	for _, slug := range unlistedGames(slugs, loaded) {
+		if gr.warned[slug] {
+			continue
+		}
+		gr.warned[slug] = true
+		logger.Warnf("game %q has active bots but is not in %s, it gets no ranked matches", slug, gamesKey)
+	}
+}
+
+// unlistedGames слаги из slugs, которых нет среди игр; слаги сравниваются без учёта регистра, как citext
+func unlistedGames(slugs []string, games []*GameConfig) []string {
+	listed := make(map[string]bool, len(games))
+	for _, game := range games {
+		listed[strings.ToLower(game.Slug)] = true
+	}
+
+	unlisted := make([]string, 0)
+	for _, slug := range slugs {
+		if !listed[strings.ToLower(slug)] {
+			unlisted = append(unlisted, slug)
+		}
+	}
+
+	return unlisted
+}
+
+// watch периодически обновляет список игр
+func (gr *gameRegistry) watch() {
+	ticker := time.NewTicker(gamesRefreshPeriod)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := gr.refresh(); err != nil {
+			logger.Error(errors.Wrap(err, "can not refresh games"))
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnlistedGames(t *testing.T) {
+	listed := []*GameConfig{{Slug: "Pong"}, {Slug: "2atod"}}
+
+	got := unlistedGames([]string{"pong", "2atod", "snake"}, listed)
+	if !reflect.DeepEqual(got, []string{"snake"}) {
+		t.Errorf("TestUnlistedGames got %v, expected [snake]", got)
+	}
+}
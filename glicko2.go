@@ -0,0 +1,145 @@
+package main
+
+import (
+	"math"
+)
+
+// Параметры Glicko-2, см. http://www.glicko.net/glicko/glicko2.pdf
+const (
+	glickoScale  = 173.7178
+	glickoCenter = 1500
+	// glickoTau ограничивает изменение волатильности за период
+	glickoTau     = 0.5
+	glickoEpsilon = 0.000001
+
+	glickoInitialDeviation  = 350
+	glickoInitialVolatility = 0.06
+)
+
+// glickoResult результат одной игры за рейтинговый период: 1 -- победа, 0.5 -- ничья, 0 -- поражение
+type glickoResult struct {
+	Opponent Rating
+	Outcome  float64
+}
+
+func glickoG(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func glickoE(mu, muJ, phiJ float64) float64 {
+	return 1 / (1 + math.Exp(-glickoG(phiJ)*(mu-muJ)))
+}
+
+// glicko2System рейтинг Glicko-2. Каждый бот играет не больше одного матча
+// за цикл матчмейкинга, так что цикл -- это рейтинговый период с одной игрой
+type glicko2System struct {
+	initial    float64
+	deviation  float64
+	volatility float64
+	tau        float64
+}
+
+func (gs *glicko2System) Initial() Rating {
+	return Rating{
+		Score:      gs.initial,
+		Deviation:  gs.deviation,
+		Volatility: gs.volatility,
+	}
+}
+
+func (gs *glicko2System) Rate(r1, r2 Rating, winner int) (Rating, Rating) {
+	s1, ok := outcome(winner)
+	if !ok {
+		return r1, r2
+	}
+
+	return glicko2Update(r1, []glickoResult{{Opponent: r2, Outcome: s1}}, gs.tau, gs.deviation),
+		glicko2Update(r2, []glickoResult{{Opponent: r1, Outcome: 1 - s1}}, gs.tau, gs.deviation)
+}
+
+func (gs *glicko2System) Idle(r Rating) Rating {
+	return glicko2Idle(r, gs.deviation)
+}
+
+// glicko2Update новый рейтинг после рейтингового периода с играми results.
+// Отклонение не бывает больше maxDeviation
+func glicko2Update(r Rating, results []glickoResult, tau, maxDeviation float64) Rating {
+	mu := (r.Score - glickoCenter) / glickoScale
+	phi := r.Deviation / glickoScale
+	sigma := r.Volatility
+
+	if len(results) == 0 {
+		return glicko2Idle(r, maxDeviation)
+	}
+
+	var vInv, delta float64
+	for _, res := range results {
+		muJ := (res.Opponent.Score - glickoCenter) / glickoScale
+		phiJ := res.Opponent.Deviation / glickoScale
+		g := glickoG(phiJ)
+		e := glickoE(mu, muJ, phiJ)
+		vInv += g * g * e * (1 - e)
+		delta += g * (res.Outcome - e)
+	}
+	v := 1 / vInv
+	delta *= v
+
+	newSigma := glickoVolatility(phi, sigma, delta, v, tau)
+	phiStar := math.Sqrt(phi*phi + newSigma*newSigma)
+	newPhi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	newMu := mu + newPhi*newPhi*delta/v
+
+	return Rating{
+		Score:      newMu*glickoScale + glickoCenter,
+		Deviation:  math.Min(newPhi*glickoScale, maxDeviation),
+		Volatility: newSigma,
+	}
+}
+
+// glicko2Idle рейтинг после периода без игр: растёт только неуверенность
+func glicko2Idle(r Rating, maxDeviation float64) Rating {
+	phi := r.Deviation / glickoScale
+	newPhi := math.Sqrt(phi*phi + r.Volatility*r.Volatility)
+
+	return Rating{
+		Score:      r.Score,
+		Deviation:  math.Min(newPhi*glickoScale, maxDeviation),
+		Volatility: r.Volatility,
+	}
+}
+
+// glickoVolatility новая волатильность, шаг 5 из описания алгоритма (метод Иллинойса)
+func glickoVolatility(phi, sigma, delta, v, tau float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > glickoEpsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+
+	return math.Exp(A / 2)
+}
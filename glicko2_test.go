@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// пример из описания алгоритма Glicko-2
+func TestGlicko2UpdateExample(t *testing.T) {
+	r := Rating{Score: 1500, Deviation: 200, Volatility: 0.06}
+	got := glicko2Update(r, []glickoResult{
+		{Opponent: Rating{Score: 1400, Deviation: 30, Volatility: 0.06}, Outcome: 1},
+		{Opponent: Rating{Score: 1550, Deviation: 100, Volatility: 0.06}, Outcome: 0},
+		{Opponent: Rating{Score: 1700, Deviation: 300, Volatility: 0.06}, Outcome: 0},
+	}, glickoTau, glickoInitialDeviation)
+
+	if math.Abs(got.Score-1464.06) > 0.01 {
+		t.Errorf("TestGlicko2UpdateExample got unexpected score: %f, expected: 1464.06", got.Score)
+	}
+	if math.Abs(got.Deviation-151.52) > 0.01 {
+		t.Errorf("TestGlicko2UpdateExample got unexpected deviation: %f, expected: 151.52", got.Deviation)
+	}
+	if math.Abs(got.Volatility-0.05999) > 0.00001 {
+		t.Errorf("TestGlicko2UpdateExample got unexpected volatility: %f, expected: 0.05999", got.Volatility)
+	}
+}
+
+func TestGlicko2Idle(t *testing.T) {
+	r := Rating{Score: 1500, Deviation: 50, Volatility: 0.06}
+	got := glicko2Idle(r, glickoInitialDeviation)
+	if got.Score != r.Score || got.Deviation <= r.Deviation {
+		t.Errorf("TestGlicko2Idle got unexpected rating: %+v", got)
+	}
+
+	capped := glicko2Idle(Rating{Score: 1500, Deviation: 350, Volatility: 0.06}, glickoInitialDeviation)
+	if capped.Deviation > 350 {
+		t.Errorf("TestGlicko2Idle deviation is not capped: %f", capped.Deviation)
+	}
+}
+
+func TestGlicko2RateWinner(t *testing.T) {
+	gs := defaultRatingSystem
+	r := gs.Initial()
+	r1, r2 := gs.Rate(r, r, 1)
+	if r1.Score <= r.Score || r2.Score >= r.Score {
+		t.Errorf("TestGlicko2RateWinner got unexpected ratings: %+v, %+v", r1, r2)
+	}
+
+	if r1.Deviation >= r.Deviation || r2.Deviation >= r.Deviation {
+		t.Errorf("TestGlicko2RateWinner deviation did not shrink: %+v, %+v", r1, r2)
+	}
+
+	d1, d2 := gs.Rate(r, r, 0)
+	if math.Abs(d1.Score-r.Score) > 1e-9 || math.Abs(d2.Score-r.Score) > 1e-9 {
+		t.Errorf("TestGlicko2RateWinner draw of equal bots changed score: %+v, %+v", d1, d2)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+func newJob(j *JobModel) *Job {
+	return &Job{
+		ID:                j.ID,
+		Type:              j.Type,
+		GameSlug:          j.GameSlug,
+		Bot1ID:            j.Bot1,
+		Version1:          j.Version1,
+		Bot2ID:            j.Bot2.Int64,
+		TournamentMatchID: j.TournamentMatchID.Int64,
+		Status:            j.Status,
+		Attempts:          j.Attempts,
+		CorrelationID:     j.CorrelationID,
+		Error:             j.Error.String,
+		Created:           j.Created,
+		Updated:           j.Updated,
+	}
+}
+
+// GetJob состояние задачи тестерам
+func GetJob(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger(r, logger, "GetJob")
+	errWriter := utils.NewErrorResponseWriter(w, logger)
+
+	jobID, err := strconv.ParseInt(mux.Vars(r)["job_id"], 10, 64)
+	if err != nil {
+		errWriter.WriteWarn(http.StatusNotFound, errors.Wrap(err, "wrong format job_id"))
+		return
+	}
+
+	job, err := Jobs.GetJobByID(jobID)
+	if err != nil {
+		if errors.Cause(err) == utils.ErrNotExists {
+			errWriter.WriteWarn(http.StatusNotFound, errors.Wrap(err, "job not exists"))
+		} else {
+			errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get job method error"))
+		}
+		return
+	}
+
+	utils.WriteApplicationJSON(w, http.StatusOK, newJob(job))
+}
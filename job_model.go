@@ -0,0 +1,200 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const (
+	jobVerify     = "verify"
+	jobRanked     = "ranked"
+	jobTournament = "tournament"
+
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// JobAccessObject DAO for Job model
+type JobAccessObject interface {
+	Create(j *JobModel) error
+	GetJobByID(jobID int64) (*JobModel, error)
+	Touch(jobID int64) error
+	Finish(jobID int64, status, errText string) error
+	ClaimStale(staleAfter time.Duration, limit int64) ([]*JobModel, error)
+	CountRunning() (map[string]int64, error)
+}
+
+// JobObject implementation of JobAccessObject
+type JobObject struct{}
+
+// Jobs объект для обращения с моделью job
+var Jobs JobAccessObject
+
+func init() {
+	Jobs = &JobObject{}
+}
+
+// JobModel model for jobs table, задача тестерам
+type JobModel struct {
+	ID       int64
+	Type     string
+	GameSlug string
+	Bot1     int64
+	Version1 int64
+	Author1  int64
+	Bot2     sql.NullInt64
+	// Players все боты матча по порядку, для рейтинговых матчей
+	Players           pq.Int64Array
+	TournamentMatchID sql.NullInt64
+	// Task TestTask в том виде, в котором он ушёл тестерам
+	Task          []byte
+	Status        string
+	Attempts      int64
+	CorrelationID string
+	Error         sql.NullString
+	Created       time.Time
+	Updated       time.Time
+}
+
+const jobFields = `j.id, j.type, j.game_slug, j.bot_1, j.version_1, j.author_1, j.bot_2, j.players,
+	j.tournament_match_id, j.task, j.status, j.attempts, j.correlation_id, j.error, j.created, j.updated`
+
+func scanJob(row rowScanner) (*JobModel, error) {
+	j := &JobModel{}
+	err := row.Scan(&j.ID, &j.Type, &j.GameSlug, &j.Bot1, &j.Version1, &j.Author1, &j.Bot2, &j.Players,
+		&j.TournamentMatchID, &j.Task, &j.Status, &j.Attempts, &j.CorrelationID, &j.Error, &j.Created, &j.Updated)
+
+	return j, err
+}
+
+// Create запись задачи перед отправкой тестерам. Без номера попытки задача первая;
+// повторная задача матча проверки продолжает счёт попыток предыдущей
+func (o *JobObject) Create(j *JobModel) error {
+	j.Status = jobRunning
+	if j.Attempts == 0 {
+		j.Attempts = 1
+	}
+	row := pqConn.QueryRow(`INSERT INTO jobs (type, game_slug, bot_1, version_1, author_1, bot_2, players,
+		tournament_match_id, task, status, attempts, correlation_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id, created, updated;`,
+		j.Type, j.GameSlug, j.Bot1, j.Version1, j.Author1, j.Bot2, j.Players,
+		j.TournamentMatchID, j.Task, j.Status, j.Attempts, j.CorrelationID)
+	if err := row.Scan(&j.ID, &j.Created, &j.Updated); err != nil {
+		return errors.Wrapf(utils.ErrInternal, "create job row error: %v", err)
+	}
+
+	return nil
+}
+
+// GetJobByID получение задачи по её идентификатору
+func (o *JobObject) GetJobByID(jobID int64) (*JobModel, error) {
+	row := pqConn.QueryRow(`SELECT `+jobFields+` FROM jobs j WHERE j.id = $1;`, jobID)
+	j, err := scanJob(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.Wrapf(utils.ErrNotExists, "job with this id does not exist: %v", err)
+		}
+
+		return nil, errors.Wrapf(utils.ErrInternal, "can not get job by id: %v", err)
+	}
+
+	return j, nil
+}
+
+// Touch отметка, что по задаче пришло событие от тестера
+func (o *JobObject) Touch(jobID int64) error {
+	_, err := pqConn.Exec(`UPDATE jobs SET updated = now() WHERE id = $1;`, jobID)
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not touch job: %v", err)
+	}
+
+	return nil
+}
+
+// Finish завершение задачи; errText пишется только для неудачных
+func (o *JobObject) Finish(jobID int64, status, errText string) error {
+	_, err := pqConn.Exec(`UPDATE jobs SET status = $2, error = $3, updated = now() WHERE id = $1;`,
+		jobID, status, sql.NullString{String: errText, Valid: errText != ""})
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not finish job: %v", err)
+	}
+
+	return nil
+}
+
+// ClaimStale захват незавершённых задач, по которым ничего не происходило дольше staleAfter:
+// их обработчик умер вместе с репликой. Счётчик попыток захваченных задач увеличивается
+func (o *JobObject) ClaimStale(staleAfter time.Duration, limit int64) ([]*JobModel, error) {
+	tx, err := pqConn.Begin()
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "can not open job claim transaction: %s", err.Error())
+	}
+	//nolint: errcheck
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT `+jobFields+` FROM jobs j
+		WHERE j.status = $1 AND j.updated < now() - $2 * interval '1 second'
+		ORDER BY j.type = $3 DESC, j.id LIMIT $4 FOR UPDATE SKIP LOCKED;`,
+		jobRunning, int64(staleAfter/time.Second), jobVerify, limit)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "get stale jobs error: %v", err)
+	}
+
+	jobs := make([]*JobModel, 0)
+	ids := make([]int64, 0)
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			rows.Close()
+			return nil, errors.Wrapf(utils.ErrInternal, "get stale jobs scan error: %v", err)
+		}
+		j.Attempts++
+		jobs = append(jobs, j)
+		ids = append(ids, j.ID)
+	}
+	rows.Close()
+
+	if len(ids) == 0 {
+		return jobs, nil
+	}
+
+	_, err = tx.Exec(`UPDATE jobs SET attempts = attempts + 1, updated = now() WHERE id = ANY($1);`,
+		pq.Array(ids))
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "can not claim stale jobs: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "can not commit job claim transaction: %v", err)
+	}
+
+	return jobs, nil
+}
+
+// CountRunning число незавершённых задач по играм
+func (o *JobObject) CountRunning() (map[string]int64, error) {
+	rows, err := pqConn.Query(`SELECT j.game_slug, count(*) FROM jobs j
+		WHERE j.status = $1 GROUP BY j.game_slug;`, jobRunning)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "count running jobs error: %v", err)
+	}
+	defer rows.Close()
+
+	running := make(map[string]int64)
+	for rows.Next() {
+		var gameSlug string
+		var count int64
+		if err = rows.Scan(&gameSlug, &count); err != nil {
+			return nil, errors.Wrapf(utils.ErrInternal, "count running jobs scan error: %v", err)
+		}
+		running[gameSlug] = count
+	}
+
+	return running, nil
+}
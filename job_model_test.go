@@ -0,0 +1,140 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+var jobColumns = []string{"id", "type", "game_slug", "bot_1", "version_1", "author_1", "bot_2", "players",
+	"tournament_match_id", "task", "status", "attempts", "correlation_id", "error", "created", "updated"}
+
+func TestClaimStaleJobs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery("FOR UPDATE SKIP LOCKED").
+		WithArgs(jobRunning, 420, jobVerify, 50).
+		WillReturnRows(sqlmock.NewRows(jobColumns).
+			AddRow(1, jobVerify, "pong", 1, 2, 3, nil, nil, nil, []byte("{}"), jobRunning, 1, "corr-1", nil, now, now).
+			AddRow(2, jobRanked, "pong", 1, 2, 3, 4, "{1,4}", nil, []byte("{}"), jobRunning, 2, "corr-2", nil, now, now))
+	mock.ExpectExec("UPDATE jobs SET attempts").
+		WithArgs(pq.Array([]int64{1, 2})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	pqConn = db
+	Jobs = &JobObject{}
+
+	jobs, err := Jobs.ClaimStale(7*time.Minute, 50)
+	if err != nil {
+		t.Fatalf("TestClaimStaleJobs got unexpected error: %v", err)
+	}
+
+	if len(jobs) != 2 || jobs[0].Attempts != 2 || jobs[1].Attempts != 3 ||
+		jobs[1].Bot2 != (sql.NullInt64{Int64: 4, Valid: true}) {
+		t.Errorf("TestClaimStaleJobs got unexpected result: %+v", jobs)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestClaimStaleJobs there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestClaimStaleJobsEmpty(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FOR UPDATE SKIP LOCKED").
+		WillReturnRows(sqlmock.NewRows(jobColumns))
+	mock.ExpectRollback()
+
+	pqConn = db
+	Jobs = &JobObject{}
+
+	jobs, err := Jobs.ClaimStale(7*time.Minute, 50)
+	if err != nil || len(jobs) != 0 {
+		t.Errorf("TestClaimStaleJobsEmpty got unexpected result: %v, %v", jobs, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestClaimStaleJobsEmpty there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFinishJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE jobs SET status").
+		WithArgs(1, jobFailed, "tester timeout").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE jobs SET status").
+		WithArgs(2, jobDone, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	pqConn = db
+	Jobs = &JobObject{}
+
+	if err = Jobs.Finish(1, jobFailed, "tester timeout"); err != nil {
+		t.Errorf("TestFinishJob got unexpected error: %v", err)
+	}
+	if err = Jobs.Finish(2, jobDone, ""); err != nil {
+		t.Errorf("TestFinishJob got unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestFinishJob there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateJobKeepsAttempts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("INSERT INTO jobs").
+		WithArgs(jobVerify, "pong", 1, 2, 3, nil, nil, nil, []byte("{}"), jobRunning, 1, "corr-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created", "updated"}).AddRow(1, now, now))
+	mock.ExpectQuery("INSERT INTO jobs").
+		WithArgs(jobVerify, "pong", 1, 2, 3, nil, nil, nil, []byte("{}"), jobRunning, 3, "corr-2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created", "updated"}).AddRow(2, now, now))
+
+	pqConn = db
+	Jobs = &JobObject{}
+
+	first := &JobModel{Type: jobVerify, GameSlug: "pong", Bot1: 1, Version1: 2, Author1: 3,
+		Task: []byte("{}"), CorrelationID: "corr-1"}
+	if err = Jobs.Create(first); err != nil || first.Attempts != 1 {
+		t.Errorf("TestCreateJobKeepsAttempts got unexpected result: %d, %v", first.Attempts, err)
+	}
+
+	// повтор матча проверки после сбоя тестеров
+	retry := &JobModel{Type: jobVerify, GameSlug: "pong", Bot1: 1, Version1: 2, Author1: 3,
+		Task: []byte("{}"), CorrelationID: "corr-2", Attempts: 3}
+	if err = Jobs.Create(retry); err != nil || retry.Attempts != 3 {
+		t.Errorf("TestCreateJobKeepsAttempts got unexpected result: %d, %v", retry.Attempts, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestCreateJobKeepsAttempts there were unfulfilled expectations: %s", err)
+	}
+}
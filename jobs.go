@@ -0,0 +1,221 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// jobStaleAfter задача без событий дольше этого времени осталась без обработчика:
+	// живой обработчик к этому моменту получил бы ответ или timeout
+	jobStaleAfter = testerTaskTimeout*testerMaxAttempts + time.Minute
+	// jobMaxAttempts сколько раз задача может быть возобновлена после рестартов
+	jobMaxAttempts = 3
+	// jobResumeInterval как часто ищутся брошенные задачи
+	jobResumeInterval = time.Minute
+	// jobResumeBatch сколько задач возобновляется за один проход
+	jobResumeBatch = 50
+)
+
+// startJob запись задачи в jobs и отправка её тестерам. События проходят через
+// trackJob, который отмечает в таблице ход и итог задачи
+func startJob(job *JobModel, task *TestTask) (<-chan *TesterStatusQueue, error) {
+	body, err := json.Marshal(task)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not marshal task")
+	}
+	job.Task = body
+	job.CorrelationID = uuid.New().String()
+
+	if err = Jobs.Create(job); err != nil {
+		return nil, errors.Wrap(err, "can not create job")
+	}
+
+	return runJob(job, task)
+}
+
+// jobPriority приоритет задачи в очереди тестеров. Матчи турниров запускают
+// пользователи, поэтому они идут раньше фоновых рейтинговых
+func jobPriority(jobType string) uint8 {
+	switch jobType {
+	case jobVerify:
+		return testerPriorityVerify
+	case jobTournament:
+		return testerPriorityUser
+	default:
+		return testerPriorityLadder
+	}
+}
+
+// runJob отправка уже записанной задачи тестерам
+func runJob(job *JobModel, task *TestTask) (<-chan *TesterStatusQueue, error) {
+	events, err := sendForVerifyRPC(task, job.CorrelationID, jobPriority(job.Type))
+	if err != nil {
+		if ferr := Jobs.Finish(job.ID, jobFailed, err.Error()); ferr != nil {
+			logger.Error(errors.Wrap(ferr, "can not mark job failed"))
+		}
+		return nil, err
+	}
+
+	return trackJob(job.ID, events), nil
+}
+
+// trackJob пересылает события тестеров обработчику и отмечает задачу:
+// каждое событие продлевает её, result завершает успешно, error и timeout -- с ошибкой
+func trackJob(jobID int64, in <-chan *TesterStatusQueue) <-chan *TesterStatusQueue {
+	out := make(chan *TesterStatusQueue)
+	go func() {
+		defer close(out)
+		logger := logger.WithFields(logrus.Fields{
+			"method": "trackJob",
+			"job_id": jobID,
+		})
+
+		status, errText := jobFailed, "tester events stopped without result"
+		for event := range in {
+			switch event.Type {
+			case "result":
+				status, errText = jobDone, ""
+			case "error", "timeout":
+				res := &TesterStatusError{}
+				if err := json.Unmarshal(event.Body, res); err != nil || res.Error == "" {
+					res.Error = event.Type
+				}
+				status, errText = jobFailed, res.Error
+			default:
+				if err := Jobs.Touch(jobID); err != nil {
+					logger.Error(errors.Wrap(err, "can not touch job"))
+				}
+			}
+
+			out <- event
+		}
+
+		if err := Jobs.Finish(jobID, status, errText); err != nil {
+			logger.Error(errors.Wrap(err, "can not finish job"))
+		}
+	}()
+
+	return out
+}
+
+// resumeJobs фоновый поиск задач, обработчик которых умер вместе с репликой
+func resumeJobs(stop <-chan struct{}) {
+	for {
+		jobs, err := Jobs.ClaimStale(jobStaleAfter, jobResumeBatch)
+		if err != nil {
+			logger.Error(errors.Wrap(err, "can not claim stale jobs"))
+		}
+
+		for _, job := range jobs {
+			resumeJob(job)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(jobResumeInterval):
+		}
+	}
+}
+
+// resumeJob повторная отправка задачи тестерам. Матчи турниров не отправляются
+// заново: матч возвращается в очередь турнира и будет создан новой задачей.
+// Рейтинговая задача закрывается в одной транзакции с записью матча, так что
+// сюда попадают только несыгранные; повторно сыгранный матч не запишется второй раз
+func resumeJob(job *JobModel) {
+	logger := logger.WithFields(logrus.Fields{
+		"method":   "resumeJob",
+		"job_id":   job.ID,
+		"job_type": job.Type,
+		"attempts": job.Attempts,
+	})
+
+	if job.Type == jobTournament {
+		if err := Tournaments.SetMatchPending(job.TournamentMatchID.Int64); err != nil {
+			logger.Error(errors.Wrap(err, "can not return tournament match to pending"))
+		}
+		finishJob(logger, job.ID, "tournament match is rescheduled")
+		return
+	}
+
+	var verification *VerificationModel
+	var verificationMatch *VerificationMatchModel
+	if job.Type == jobVerify {
+		var err error
+		verification, verificationMatch, err = Verifications.GetVerificationByJob(job.ID)
+		if err != nil {
+			logger.Error(errors.Wrap(err, "can not get job verification"))
+			finishJob(logger, job.ID, "verification is not available")
+			return
+		}
+		// результат пришёл, но задачу не успели закрыть
+		if verificationMatch.Outcome != verificationPending {
+			if err = Jobs.Finish(job.ID, jobDone, ""); err != nil {
+				logger.Error(errors.Wrap(err, "can not mark job done"))
+			}
+			return
+		}
+	}
+
+	if job.Attempts > jobMaxAttempts {
+		finishJob(logger, job.ID, "too many attempts")
+		if verification != nil {
+			finishVerificationMatch(verification, verificationMatch, verificationError, sql.NullInt64{},
+				"too many attempts", h.broadcast)
+		}
+		return
+	}
+
+	task := &TestTask{}
+	if err := json.Unmarshal(job.Task, task); err != nil {
+		logger.Error(errors.Wrap(err, "can not unmarshal job task"))
+		finishJob(logger, job.ID, "broken task")
+		return
+	}
+
+	var bots []*BotModel
+	if job.Type == jobRanked {
+		ids := []int64(job.Players)
+		if len(ids) == 0 {
+			ids = []int64{job.Bot1, job.Bot2.Int64}
+		}
+
+		bots = make([]*BotModel, len(ids))
+		for i, id := range ids {
+			bot, err := Bots.GetBotByID(id)
+			if err != nil {
+				logger.Error(errors.Wrap(err, "can not get job bots"))
+				finishJob(logger, job.ID, "bot is not available")
+				return
+			}
+			bots[i] = bot
+		}
+	}
+
+	events, err := runJob(job, task)
+	if err != nil {
+		logger.Error(errors.Wrap(err, "can not resend job"))
+		return
+	}
+	logger.Info("job is resumed")
+
+	switch job.Type {
+	case jobVerify:
+		// попытки после рестарта расходуют тот же запас, что и повторы после сбоев тестеров
+		go processVerificationMatch(verification, verificationMatch, task, int(job.Attempts), h.broadcast, events)
+	case jobRanked:
+		go processRankedStatus(job.ID, bots, h.broadcast, events)
+	}
+}
+
+func finishJob(logger *logrus.Entry, jobID int64, errText string) {
+	if err := Jobs.Finish(jobID, jobFailed, errText); err != nil {
+		logger.Error(errors.Wrap(err, "can not mark job failed"))
+	}
+}
@@ -0,0 +1,13 @@
+package main
+
+import "testing"
+
+func TestJobPriority(t *testing.T) {
+	verify, user, ladder := jobPriority(jobVerify), jobPriority(jobTournament), jobPriority(jobRanked)
+	if !(verify > user && user > ladder) {
+		t.Errorf("TestJobPriority got unexpected order: verify %d, tournament %d, ranked %d", verify, user, ladder)
+	}
+	if verify > testerMaxPriority {
+		t.Errorf("TestJobPriority priority %d is above x-max-priority %d", verify, testerMaxPriority)
+	}
+}
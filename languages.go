@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+const languagesKey = "warscript-bots/languages"
+
+// LanguageInfo описание языка, на котором можно писать ботов
+type LanguageInfo struct {
+	Name    Lang   `json:"name"`
+	Title   string `json:"title"`
+	Runtime string `json:"runtime"`
+	// Queue очередь тестеров, в которых есть рантайм этого языка
+	Queue string `json:"-"`
+}
+
+// defaultLanguages языки по умолчанию: все значения типа LANG в базе.
+// Consul может только поменять их описание и очереди, но не добавить новые
+var defaultLanguages = []*LanguageInfo{
+	{Name: "JS", Title: "JavaScript", Runtime: "ES2017", Queue: testerQueueName},
+	{Name: "PY", Title: "Python", Runtime: "3.7", Queue: "tester_rpc_priority_queue_py"},
+	{Name: "LUA", Title: "Lua", Runtime: "5.3", Queue: "tester_rpc_priority_queue_lua"},
+}
+
+var availableLanguages map[Lang]*LanguageInfo
+
+// UnmarshalJSON разбор языка из consul: в отличие от API, в нём есть очередь тестеров
+func (l *LanguageInfo) UnmarshalJSON(data []byte) error {
+	type language LanguageInfo
+	v := struct {
+		*language
+		Queue string `json:"queue"`
+	}{language: (*language)(l)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	l.Queue = v.Queue
+
+	return nil
+}
+
+func init() {
+	setLanguages(defaultLanguages)
+}
+
+func setLanguages(langs []*LanguageInfo) {
+	availableLanguages = make(map[Lang]*LanguageInfo, len(langs))
+	for _, lang := range langs {
+		availableLanguages[lang.Name] = lang
+	}
+}
+
+// loadLanguages подгружает настройки языков из consul KV и накладывает их на дефолтные.
+// Формат значения: [{"name": "JS", "title": "JavaScript", "runtime": "ES2017", "queue": "tester_rpc_priority_queue"}];
+// незаданные поля и языки, которых нет в списке, остаются дефолтными
+func loadLanguages(consul *consulapi.Client) error {
+	pair, _, err := consul.KV().Get(languagesKey, nil)
+	if err != nil {
+		return errors.Wrap(err, "can not get languages from consul")
+	}
+
+	// своего списка нет -- работаем с дефолтным
+	if pair == nil {
+		return nil
+	}
+
+	langs := make([]*LanguageInfo, 0)
+	if err = json.Unmarshal(pair.Value, &langs); err != nil {
+		return errors.Wrap(err, "can not unmarshal languages")
+	}
+
+	merged, err := mergeLanguages(defaultLanguages, langs)
+	if err != nil {
+		return errors.Wrap(err, "bad languages config")
+	}
+	setLanguages(merged)
+
+	return nil
+}
+
+// mergeLanguages языки overrides поверх defaults по имени. Незнакомый язык -- ошибка:
+// ботов на нём нельзя сохранить, а опечатка в имени не должна тихо менять очереди
+func mergeLanguages(defaults, overrides []*LanguageInfo) ([]*LanguageInfo, error) {
+	merged := make([]*LanguageInfo, len(defaults))
+	byName := make(map[Lang]*LanguageInfo, len(defaults))
+	for i, lang := range defaults {
+		l := *lang
+		merged[i], byName[l.Name] = &l, &l
+	}
+
+	for _, o := range overrides {
+		lang, ok := byName[o.Name]
+		if !ok {
+			return nil, errors.Errorf("unknown language %q", o.Name)
+		}
+
+		if o.Title != "" {
+			lang.Title = o.Title
+		}
+		if o.Runtime != "" {
+			lang.Runtime = o.Runtime
+		}
+		if o.Queue != "" {
+			lang.Queue = o.Queue
+		}
+	}
+
+	return merged, nil
+}
+
+// testerQueue очередь тестеров для матча между ботами на этих языках.
+// Если языки разные, матч уходит тестерам, в которых есть все рантаймы
+func testerQueue(langs ...Lang) (string, error) {
+	queue := ""
+	for _, lang := range langs {
+		info, ok := availableLanguages[lang]
+		if !ok {
+			return "", errors.Errorf("unsupported language %q", lang)
+		}
+
+		if queue != "" && queue != info.Queue {
+			return mixedTesterQueueName, nil
+		}
+		queue = info.Queue
+	}
+
+	return queue, nil
+}
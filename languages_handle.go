@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/HotCodeGroup/warscript-utils/utils"
+)
+
+// GetLanguages список языков, на которых можно писать ботов
+func GetLanguages(w http.ResponseWriter, r *http.Request) {
+	langs := make([]*LanguageInfo, 0, len(availableLanguages))
+	for _, lang := range availableLanguages {
+		langs = append(langs, lang)
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		return langs[i].Name < langs[j].Name
+	})
+
+	utils.WriteApplicationJSON(w, http.StatusOK, langs)
+}
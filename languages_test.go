@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTesterQueue(t *testing.T) {
+	cases := []struct {
+		name  string
+		langs []Lang
+		queue string
+		err   bool
+	}{
+		{name: "js", langs: []Lang{"JS", "JS"}, queue: testerQueueName},
+		{name: "python", langs: []Lang{"PY", "PY"}, queue: "tester_rpc_priority_queue_py"},
+		{name: "single bot", langs: []Lang{"LUA"}, queue: "tester_rpc_priority_queue_lua"},
+		{name: "mixed", langs: []Lang{"JS", "PY"}, queue: mixedTesterQueueName},
+		{name: "mixed three", langs: []Lang{"LUA", "LUA", "JS"}, queue: mixedTesterQueueName},
+		{name: "unsupported", langs: []Lang{"JS", "GO"}, err: true},
+	}
+
+	for _, c := range cases {
+		queue, err := testerQueue(c.langs...)
+		if (err != nil) != c.err {
+			t.Errorf("TestTesterQueue %s got unexpected error: %v", c.name, err)
+			continue
+		}
+		if queue != c.queue {
+			t.Errorf("TestTesterQueue %s got queue %q, expected %q", c.name, queue, c.queue)
+		}
+	}
+}
+
+func TestMergeLanguages(t *testing.T) {
+	merged, err := mergeLanguages(defaultLanguages, []*LanguageInfo{
+		{Name: "PY", Runtime: "3.8", Queue: "tester_rpc_priority_queue_py38"},
+	})
+	if err != nil {
+		t.Fatalf("TestMergeLanguages got unexpected error: %v", err)
+	}
+	if len(merged) != len(defaultLanguages) {
+		t.Fatalf("TestMergeLanguages got %d languages, expected %d", len(merged), len(defaultLanguages))
+	}
+
+	py := merged[1]
+	if py.Title != "Python" || py.Runtime != "3.8" || py.Queue != "tester_rpc_priority_queue_py38" {
+		t.Errorf("TestMergeLanguages got unexpected language: %+v", py)
+	}
+	if defaultLanguages[1].Runtime != "3.7" {
+		t.Errorf("TestMergeLanguages changed default language: %+v", defaultLanguages[1])
+	}
+
+	// опечатка в имени не заменяет список языков
+	if _, err = mergeLanguages(defaultLanguages, []*LanguageInfo{{Name: "Py", Queue: "q"}}); err == nil {
+		t.Errorf("TestMergeLanguages accepted unknown language")
+	}
+}
+
+func TestLanguageInfoQueueHiddenFromAPI(t *testing.T) {
+	lang := &LanguageInfo{}
+	if err := json.Unmarshal([]byte(`{"name": "PY", "title": "Python", "runtime": "3.8",
+		"queue": "tester_rpc_priority_queue_py38"}`), lang); err != nil {
+		t.Fatalf("TestLanguageInfoQueueHiddenFromAPI got unexpected error: %v", err)
+	}
+	if lang.Name != "PY" || lang.Runtime != "3.8" || lang.Queue != "tester_rpc_priority_queue_py38" {
+		t.Errorf("TestLanguageInfoQueueHiddenFromAPI got unexpected language: %+v", lang)
+	}
+
+	data, err := json.Marshal(lang)
+	if err != nil {
+		t.Fatalf("TestLanguageInfoQueueHiddenFromAPI got unexpected error: %v", err)
+	}
+	if string(data) != `{"name":"PY","title":"Python","runtime":"3.8"}` {
+		t.Errorf("TestLanguageInfoQueueHiddenFromAPI got unexpected json: %s", data)
+	}
+}
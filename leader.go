@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// schedulerLockID ключ advisory lock, который держит реплика, проводящая матчи
+	schedulerLockID int64 = 0x77617273626f7473 // "warsbots"
+	// leaderCheckInterval как часто реплика пытается стать лидером и проверяет свою блокировку
+	leaderCheckInterval = 5 * time.Second
+)
+
+var schedulerLeader = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "scheduler_leader",
+	Help: "1 if the instance holds the lock and schedules matches, 0 otherwise",
+}, []string{"instance"})
+
+func init() {
+	prometheus.MustRegister(schedulerLeader)
+}
+
+// leaderTask фоновая задача, которую выполняет только лидер. Когда лидерство
+// потеряно, stop закрывается и задача должна завершиться
+type leaderTask func(stop <-chan struct{})
+
+// runAsLeader выборы лидера между репликами через pg_try_advisory_lock.
+// Блокировка сессионная и держится на отдельном соединении: если лидер умер
+// или потерял соединение, Postgres её отпускает и лидером становится другая реплика
+func runAsLeader(instanceID string, tasks ...leaderTask) {
+	gauge := schedulerLeader.WithLabelValues(instanceID)
+	gauge.Set(0)
+
+	var conn *sql.Conn
+	var stop chan struct{}
+	for {
+		if conn == nil {
+			var err error
+			conn, err = tryLock()
+			if err != nil {
+				logger.Error(errors.Wrap(err, "leader election error"))
+			}
+
+			if conn != nil {
+				logger.Infof("instance %s is the scheduler leader now", instanceID)
+				gauge.Set(1)
+
+				stop = make(chan struct{})
+				for _, task := range tasks {
+					go task(stop)
+				}
+			}
+		} else if err := checkLock(conn); err != nil {
+			logger.Error(errors.Wrapf(err, "instance %s lost scheduler leadership", instanceID))
+			gauge.Set(0)
+
+			close(stop)
+			// соединение может вернуться в пул живым -- блокировку на нём держать нельзя
+			//nolint: errcheck
+			conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock_all();`)
+			//nolint: errcheck
+			conn.Close()
+			conn = nil
+		}
+
+		time.Sleep(leaderCheckInterval)
+	}
+}
+
+// checkLock проверка, что соединение с блокировкой живо
+func checkLock(conn *sql.Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), leaderCheckInterval)
+	defer cancel()
+
+	var one int
+	return conn.QueryRowContext(ctx, `SELECT 1;`).Scan(&one)
+}
+
+// tryLock соединение с захваченной блокировкой, либо nil, если лидер уже есть
+func tryLock() (*sql.Conn, error) {
+	conn, err := pqConn.Conn(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, "can not get connection")
+	}
+
+	var locked bool
+	row := conn.QueryRowContext(context.Background(), `SELECT pg_try_advisory_lock($1);`, schedulerLockID)
+	if err = row.Scan(&locked); err != nil || !locked {
+		//nolint: errcheck
+		conn.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "can not try advisory lock")
+		}
+
+		return nil, nil
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestTryLockAcquired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT pg_try_advisory_lock").
+		WithArgs(schedulerLockID).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+
+	pqConn = db
+
+	conn, err := tryLock()
+	if err != nil || conn == nil {
+		t.Fatalf("TestTryLockAcquired got unexpected result: %v, %v", conn, err)
+	}
+	conn.Close()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestTryLockAcquired there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestTryLockHeldByOther(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT pg_try_advisory_lock").
+		WithArgs(schedulerLockID).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false))
+
+	pqConn = db
+
+	conn, err := tryLock()
+	if err != nil || conn != nil {
+		t.Errorf("TestTryLockHeldByOther got unexpected result: %v, %v", conn, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestTryLockHeldByOther there were unfulfilled expectations: %s", err)
+	}
+}
@@ -33,6 +33,7 @@ var (
 	authGPRC   models.AuthClient
 	notifyGRPC models.NotifyClient
 
+	rabbitConn    *amqp.Connection
 	rabbitChannel *amqp.Channel
 
 	pqConn *sql.DB
@@ -48,6 +49,11 @@ func deregisterService(consul *consulapi.Client, id string) {
 
 //nolint: gocyclo
 func main() {
+	// офлайн-прогон матчмейкинга, без сервисов и тестеров
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		os.Exit(runSimulation(os.Args[2:]))
+	}
+
 	var err error
 	logger, err = logging.NewLogger(os.Stdout, os.Getenv("LOGENTRIESRUS_TOKEN"))
 	if err != nil {
@@ -74,6 +80,13 @@ func main() {
 	}
 	vault.SetToken(os.Getenv("VAULT_TOKEN"))
 
+	loadAdminToken(vault)
+
+	if err = loadLanguages(consul); err != nil {
+		logger.Errorf("can not load languages: %s", err)
+		return
+	}
+
 	httpPort, _, err := balancer.GetPorts("warscript-bots/bounds", "warscript-bots", consul)
 	if err != nil {
 		logger.Errorf("can not find empry port: %s", err)
@@ -102,7 +115,7 @@ func main() {
 		return
 	}
 
-	rabbitConn, err := rabbitmq.Connect(rabbitConf.Data["user"].(string), rabbitConf.Data["pass"].(string),
+	rabbitConn, err = rabbitmq.Connect(rabbitConf.Data["user"].(string), rabbitConf.Data["pass"].(string),
 		rabbitConf.Data["host"].(string), rabbitConf.Data["port"].(string))
 	if err != nil {
 		logger.Errorf("can not connect to rabbitmq: %s", err.Error())
@@ -116,6 +129,10 @@ func main() {
 		return
 	}
 	defer rabbitChannel.Close()
+	if err = declareTesterQueues(rabbitConn); err != nil {
+		logger.Errorf("can not declare tester queues: %s", err.Error())
+		return
+	}
 
 	httpServiceID := fmt.Sprintf("warscript-bots-http:%d", httpPort)
 	err = consul.Agent().ServiceRegister(&consulapi.AgentServiceRegistration{
@@ -154,6 +171,13 @@ func main() {
 	defer notifyGRPCConn.Close()
 	notifyGRPC = models.NewNotifyClient(notifyGRPCConn)
 
+	games = newGameRegistry(consul)
+	if err = games.refresh(); err != nil {
+		logger.Errorf("can not load games: %s", err)
+		return
+	}
+	go games.watch()
+
 	h = &hub{
 		sessions:   make(map[int64]map[string]map[string]chan *BotStatusMessage),
 		broadcast:  make(chan *BotStatusMessage),
@@ -183,6 +207,35 @@ func main() {
 	r := mux.NewRouter().PathPrefix("/v1").Subrouter()
 	r.HandleFunc("/bots", middlewares.WithAuthentication(CreateBot, logger, authGPRC)).Methods("POST")
 	r.HandleFunc("/bots", GetBotsList).Methods("GET")
+	r.HandleFunc("/bots/{bot_id:[0-9]+}", GetBot).Methods("GET")
+	r.HandleFunc("/bots/{bot_id:[0-9]+}", middlewares.WithAuthentication(UpdateBot, logger, authGPRC)).Methods("PATCH")
+	r.HandleFunc("/bots/{bot_id:[0-9]+}", middlewares.WithAuthentication(ArchiveBot, logger, authGPRC)).Methods("DELETE")
+	r.HandleFunc("/bots/{bot_id:[0-9]+}/restore",
+		middlewares.WithAuthentication(RestoreBot, logger, authGPRC)).Methods("POST")
+	r.HandleFunc("/bots/{bot_id:[0-9]+}/versions",
+		middlewares.WithAuthentication(CreateBotVersion, logger, authGPRC)).Methods("POST")
+	r.HandleFunc("/bots/{bot_id:[0-9]+}/versions", GetBotVersions).Methods("GET")
+	r.HandleFunc("/bots/{bot_id:[0-9]+}/rollback",
+		middlewares.WithAuthentication(RollbackBot, logger, authGPRC)).Methods("POST")
+	r.HandleFunc("/bots/{bot_id:[0-9]+}/rating-history", GetBotRatingHistory).Methods("GET")
+
+	r.HandleFunc("/languages", GetLanguages).Methods("GET")
+
+	r.HandleFunc("/seasons", GetSeasons).Methods("GET")
+	r.HandleFunc("/seasons/close", WithAdminToken(CloseSeason)).Methods("POST")
+
+	r.HandleFunc("/similarity-reports", WithAdminToken(GetSimilarityReports)).Methods("GET")
+
+	r.HandleFunc("/tournaments", middlewares.WithAuthentication(CreateTournament, logger, authGPRC)).Methods("POST")
+	r.HandleFunc("/tournaments", GetTournaments).Methods("GET")
+	r.HandleFunc("/tournaments/{tournament_id:[0-9]+}", GetTournament).Methods("GET")
+	r.HandleFunc("/tournaments/{tournament_id:[0-9]+}/participants",
+		middlewares.WithAuthentication(RegisterTournamentBot, logger, authGPRC)).Methods("POST")
+	r.HandleFunc("/tournaments/{tournament_id:[0-9]+}/start",
+		middlewares.WithAuthentication(StartTournament, logger, authGPRC)).Methods("POST")
+
+	r.HandleFunc("/jobs/{job_id:[0-9]+}", GetJob).Methods("GET")
+	r.HandleFunc("/verifications/{verification_id:[0-9]+}", GetVerification).Methods("GET")
 
 	r.HandleFunc("/matches/connect", OpenWS).Methods("GET")
 	r.HandleFunc("/matches", GetMatchList).Methods("GET")
@@ -192,7 +245,8 @@ func main() {
 	http.Handle("/", middlewares.RecoverMiddleware(middlewares.AccessLogMiddleware(r, logger), logger))
 
 	logger.Infof("Bots HTTP service successfully started at port %d", httpPort)
-	go startMatchmaking()
+	// матчи проводит и брошенные задачи возобновляет только одна реплика
+	go runAsLeader(httpServiceID, startMatchmaking, startTournaments, resumeJobs, startDecay)
 	err = http.ListenAndServe(":"+strconv.Itoa(httpPort), nil)
 	if err != nil {
 		logger.Errorf("cant start main server. err: %s", err.Error())
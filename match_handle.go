@@ -81,20 +81,53 @@ func GetMatch(w http.ResponseWriter, r *http.Request) {
 
 	resp := MatchFullInfo{
 		MatchInfo: MatchInfo{
-			ID:       matchInfo.ID,
-			Result:   matchInfo.Result,
-			GameSlug: matchInfo.GameSlug,
-			Bot1ID:   matchInfo.Bot1,
-			Bot2ID:   matchInfo.GetBot2(),
-			Diff1:    matchInfo.Diff1,
-			Diff2:    matchInfo.GetDiff2(),
-			Author1:  ai1,
-			Author2:  ai2,
+			ID:        matchInfo.ID,
+			Result:    matchInfo.Result,
+			GameSlug:  matchInfo.GameSlug,
+			Bot1ID:    matchInfo.Bot1,
+			Bot2ID:    matchInfo.GetBot2(),
+			Version1:  matchInfo.Version1,
+			Version2:  matchInfo.GetVersion2(),
+			Archived1: matchInfo.Bot1Archived,
+			Archived2: matchInfo.Bot2Archived,
+			Diff1:     matchInfo.Diff1,
+			Diff2:     matchInfo.GetDiff2(),
+			Author1:   ai1,
+			Author2:   ai2,
 		},
 		Error:     matchInfo.GetError(),
 		Timestamp: matchInfo.Timestamp,
 	}
 
+	participants, err := Matches.GetParticipants(matchInfo.ID)
+	if err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get match participants error"))
+		return
+	}
+	if len(participants) > 0 {
+		authors := make(map[int64]*AuthorInfo, len(participants))
+		for _, ai := range []*AuthorInfo{ai1, ai2} {
+			if ai != nil {
+				authors[ai.ID] = ai
+			}
+		}
+		if len(participants) > 2 {
+			authorIDs := make([]int64, len(participants))
+			for i, p := range participants {
+				authorIDs[i] = p.AuthorID
+			}
+			if authors, err = getAuthors(authorIDs); err != nil {
+				errWriter.WriteWarn(http.StatusNotFound, errors.Wrap(err, "can't get users by grpc"))
+				return
+			}
+		}
+
+		resp.Participants = make([]*MatchParticipant, len(participants))
+		for i, p := range participants {
+			resp.Participants[i] = newMatchParticipant(p, authors)
+		}
+	}
+
 	if matchInfo.Result != 3 {
 		resp.Replay = &Replay{
 			Info:   matchInfo.Info,
@@ -115,9 +148,9 @@ func GetMatch(w http.ResponseWriter, r *http.Request) {
 	resp.Logs = json.RawMessage(`{}`)
 	if session != nil {
 		if resp.Author1 != nil && session.ID == resp.Author1.ID {
-			bot, err := Bots.GetBotByID(resp.Bot1ID)
+			bot, err := Bots.GetVersion(resp.Bot1ID, resp.Version1)
 			if err != nil {
-				logger.Errorf("can't get bot by id: %v", err)
+				logger.Errorf("can't get bot version: %v", err)
 			} else {
 				resp.Code = bot.Code
 			}
@@ -133,9 +166,9 @@ func GetMatch(w http.ResponseWriter, r *http.Request) {
 				resp.Logs = matchInfo.Log1
 			}
 		} else if resp.Author2 != nil && session.ID == resp.Author2.ID {
-			bot, err := Bots.GetBotByID(resp.Bot2ID)
+			bot, err := Bots.GetVersion(resp.Bot2ID, resp.Version2)
 			if err != nil {
-				logger.Errorf("can't get bot by id: %v", err)
+				logger.Errorf("can't get bot version: %v", err)
 			} else {
 				resp.Code = bot.Code
 			}
@@ -150,6 +183,27 @@ func GetMatch(w http.ResponseWriter, r *http.Request) {
 			if matchInfo.Log2 != nil {
 				resp.Logs = matchInfo.Log2
 			}
+		} else {
+			// остальные игроки матча на нескольких ботов
+			for _, p := range participants {
+				if p.Position <= 2 || session.ID != p.AuthorID {
+					continue
+				}
+
+				bot, err := Bots.GetVersion(p.BotID, p.Version)
+				if err != nil {
+					logger.Errorf("can't get bot version: %v", err)
+				} else {
+					resp.Code = bot.Code
+				}
+				if resp.Error == "" && p.Error.Valid {
+					resp.Error = p.Error.String
+				}
+				if p.Log != nil {
+					resp.Logs = p.Log
+				}
+				break
+			}
 		}
 	} else {
 		if resp.Error == "" {
@@ -268,15 +322,19 @@ func GetMatchList(w http.ResponseWriter, r *http.Request) {
 		}
 
 		respMatches[i] = &MatchInfo{
-			ID:       match.ID,
-			Result:   match.Result,
-			GameSlug: match.GameSlug,
-			Bot1ID:   match.Bot1,
-			Bot2ID:   match.GetBot2(),
-			Diff1:    match.Diff1,
-			Diff2:    match.GetDiff2(),
-			Author1:  ai1,
-			Author2:  ai2,
+			ID:        match.ID,
+			Result:    match.Result,
+			GameSlug:  match.GameSlug,
+			Bot1ID:    match.Bot1,
+			Bot2ID:    match.GetBot2(),
+			Version1:  match.Version1,
+			Version2:  match.GetVersion2(),
+			Archived1: match.Bot1Archived,
+			Archived2: match.Bot2Archived,
+			Diff1:     match.Diff1,
+			Diff2:     match.GetDiff2(),
+			Author1:   ai1,
+			Author2:   ai2,
 		}
 	}
 
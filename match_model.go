@@ -6,14 +6,19 @@ import (
 	"time"
 
 	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 )
 
 // MatchAccessObject DAO for Match model
 type MatchAccessObject interface {
 	Create(b *MatchModel) error
+	RecordMatchOutcome(m *MatchModel, delta1, delta2 Rating) (Rating, Rating, error)
+	RecordMultiMatchOutcome(m *MatchModel, deltas []Rating) ([]Rating, error)
 	GetMatchByID(matchID int64) (*MatchModel, error)
+	GetParticipants(matchID int64) ([]*MatchParticipantModel, error)
 	GetMatchesByGameSlugAndAuthorID(authorID int64, gameSlug string, limit int64, since int64) ([]*MatchModel, error)
+	GetRecentPairs(gameSlug string, since time.Time) (map[botPair]bool, error)
 }
 
 // MatchObject implementation of BotAccessObject
@@ -41,10 +46,133 @@ type MatchModel struct {
 	Author1   int64
 	Log1      []byte
 	Diff1     int64
+	Version1  int64
 	Bot2      sql.NullInt64
 	Author2   sql.NullInt64
 	Log2      []byte
 	Diff2     sql.NullInt64
+	Version2  sql.NullInt64
+
+	// боты могли быть отправлены в архив уже после матча
+	Bot1Archived bool
+	Bot2Archived bool
+
+	// JobID задача тестерам, которой сыгран рейтинговый матч
+	JobID sql.NullInt64
+
+	// Participants все игроки по порядку. Первые два дублируются в поля *1, *2,
+	// для матча на двоих участники строятся из них при записи
+	Participants []*MatchParticipantModel
+}
+
+// MatchParticipantModel model for match_participants table
+type MatchParticipantModel struct {
+	MatchID int64
+	// Position порядок игрока в задаче, с 1
+	Position int64
+	BotID    int64
+	AuthorID int64
+	Version  int64
+	// Placement место в матче, 1 -- лучшее; нет, если матч не состоялся
+	Placement sql.NullInt64
+	Error     sql.NullString
+	Log       []byte
+	Diff      int64
+
+	// бот мог быть отправлен в архив уже после матча
+	BotArchived bool
+}
+
+// placementsFromResult места двух игроков по коду результата матча
+func placementsFromResult(result int) (sql.NullInt64, sql.NullInt64) {
+	switch result {
+	case 0:
+		return sql.NullInt64{Int64: 1, Valid: true}, sql.NullInt64{Int64: 1, Valid: true}
+	case 1:
+		return sql.NullInt64{Int64: 1, Valid: true}, sql.NullInt64{Int64: 2, Valid: true}
+	case 2:
+		return sql.NullInt64{Int64: 2, Valid: true}, sql.NullInt64{Int64: 1, Valid: true}
+	}
+
+	return sql.NullInt64{}, sql.NullInt64{}
+}
+
+// twoPlayerParticipants участники матча по полям *1, *2
+func twoPlayerParticipants(m *MatchModel) []*MatchParticipantModel {
+	placement1, placement2 := placementsFromResult(m.Result)
+	participants := []*MatchParticipantModel{{
+		Position:  1,
+		BotID:     m.Bot1,
+		AuthorID:  m.Author1,
+		Version:   m.Version1,
+		Placement: placement1,
+		Error:     m.Error1,
+		Log:       m.Log1,
+		Diff:      m.Diff1,
+	}}
+	if m.Bot2.Valid {
+		participants = append(participants, &MatchParticipantModel{
+			Position:  2,
+			BotID:     m.Bot2.Int64,
+			AuthorID:  m.GetAuthor2(),
+			Version:   m.GetVersion2(),
+			Placement: placement2,
+			Error:     m.Error2,
+			Log:       m.Log2,
+			Diff:      m.GetDiff2(),
+		})
+	}
+
+	return participants
+}
+
+// fillTwoPlayerFields поля *1, *2 и код результата по участникам: для матча
+// нескольких игроков результат -- позиция единственного победителя, либо 0
+func fillTwoPlayerFields(m *MatchModel) {
+	p1 := m.Participants[0]
+	m.Bot1, m.Author1, m.Version1, m.Error1, m.Log1, m.Diff1 =
+		p1.BotID, p1.AuthorID, p1.Version, p1.Error, p1.Log, p1.Diff
+	if len(m.Participants) > 1 {
+		p2 := m.Participants[1]
+		m.Bot2 = sql.NullInt64{Int64: p2.BotID, Valid: true}
+		m.Author2 = sql.NullInt64{Int64: p2.AuthorID, Valid: true}
+		m.Version2 = sql.NullInt64{Int64: p2.Version, Valid: true}
+		m.Diff2 = sql.NullInt64{Int64: p2.Diff, Valid: true}
+		m.Error2, m.Log2 = p2.Error, p2.Log
+	}
+
+	if m.Result == 3 {
+		return
+	}
+	m.Result = 0
+	for _, p := range m.Participants {
+		if p.Placement.Int64 == 1 {
+			if m.Result != 0 {
+				m.Result = 0
+				return
+			}
+			m.Result = int(p.Position)
+		}
+	}
+}
+
+// participantOutcome победа, поражение или ничья участника для счётчиков бота:
+// ничья -- если первое место разделили несколько игроков
+func participantOutcome(participants []*MatchParticipantModel, i int) (int, int, int) {
+	best, shared := participants[i].Placement.Int64, false
+	for j, p := range participants {
+		if p.Placement.Int64 < best {
+			return 0, 1, 0
+		}
+		if j != i && p.Placement.Int64 == best {
+			shared = true
+		}
+	}
+	if shared {
+		return 0, 0, 1
+	}
+
+	return 1, 0, 0
 }
 
 // GetError возвращает ошибку, если она есть, либо пустую строку
@@ -83,6 +211,15 @@ func (m *MatchModel) GetDiff2() int64 {
 	return 0
 }
 
+// GetVersion2 возвращает версию бота соперника, либо 0, если игра с системным ботом
+func (m *MatchModel) GetVersion2() int64 {
+	if m.Version2.Valid {
+		return m.Version2.Int64
+	}
+
+	return 0
+}
+
 // Create создание новой записи о матче в DB
 func (o *MatchObject) Create(m *MatchModel) error {
 	tx, err := pqConn.Begin()
@@ -92,19 +229,136 @@ func (o *MatchObject) Create(m *MatchModel) error {
 	//nolint: errcheck
 	defer tx.Rollback()
 
+	if err = insertMatch(tx, m); err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not commit match create transaction: %v", err)
+	}
+
+	return nil
+}
+
+// RecordMatchOutcome запись рейтингового матча двух ботов, см. RecordMultiMatchOutcome.
+// Возвращает рейтинги ботов после матча
+func (o *MatchObject) RecordMatchOutcome(m *MatchModel, delta1, delta2 Rating) (Rating, Rating, error) {
+	m.Participants = twoPlayerParticipants(m)
+	ratings, err := o.RecordMultiMatchOutcome(m, []Rating{delta1, delta2})
+	if err != nil {
+		return Rating{}, Rating{}, err
+	}
+
+	return ratings[0], ratings[1], nil
+}
+
+// RecordMultiMatchOutcome запись рейтингового матча одной транзакцией: изменения рейтинга
+// (deltas, в порядке участников) прибавляются к текущим значениям в DB, счётчики игр ботов
+// увеличиваются, а Diff участников заполняются по фактическим очкам, в историю рейтинга
+// пишутся новые значения. Задача матча в той же транзакции отмечается выполненной, а матч
+// той же задачи второй раз не запишется. Возвращает рейтинги ботов после матча
+func (o *MatchObject) RecordMultiMatchOutcome(m *MatchModel, deltas []Rating) ([]Rating, error) {
+	if len(m.Participants) < 2 || len(m.Participants) != len(deltas) {
+		return nil, errors.Wrapf(utils.ErrInvalid, "match has %d participants and %d rating changes",
+			len(m.Participants), len(deltas))
+	}
+
+	tx, err := pqConn.Begin()
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal,
+			"can not open match outcome transaction: %s", err.Error())
+	}
+	//nolint: errcheck
+	defer tx.Rollback()
+
+	ratings := make([]Rating, len(deltas))
+	for i, p := range m.Participants {
+		wins, losses, draws := participantOutcome(m.Participants, i)
+		ratings[i], err = applyBotOutcome(tx, p.BotID, deltas[i], wins, losses, draws)
+		if err != nil {
+			return nil, err
+		}
+		p.Diff = roundScore(ratings[i].Score) - roundScore(ratings[i].Score-deltas[i].Score)
+	}
+
+	fillTwoPlayerFields(m)
+	if err = insertMatch(tx, m); err != nil {
+		return nil, err
+	}
+
+	if m.JobID.Valid {
+		_, err = tx.Exec(`UPDATE jobs SET status = $2, error = NULL, updated = now() WHERE id = $1;`,
+			m.JobID.Int64, jobDone)
+		if err != nil {
+			return nil, errors.Wrapf(utils.ErrInternal, "can not finish match job: %v", err)
+		}
+	}
+
+	matchID := sql.NullInt64{Int64: m.ID, Valid: true}
+	for i, p := range m.Participants {
+		if err = insertRatingHistory(tx, &RatingHistoryModel{BotID: p.BotID, MatchID: matchID, Version: p.Version,
+			Score: ratings[i].Score, Deviation: ratings[i].Deviation, Reason: ratingReasonMatch}); err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal,
+			"can not commit match outcome transaction: %v", err)
+	}
+
+	return ratings, nil
+}
+
+func applyBotOutcome(tx *sql.Tx, botID int64, delta Rating, wins, losses, draws int) (Rating, error) {
+	r := Rating{}
+	row := tx.QueryRow(`UPDATE bots SET score = score + $1,
+		score_deviation = GREATEST(score_deviation + $2, 0),
+		score_volatility = GREATEST(score_volatility + $3, 0),
+		games_played = games_played + 1, wins = wins + $4, losses = losses + $5, draws = draws + $6
+		WHERE bots.id = $7
+		RETURNING score, score_deviation, score_volatility;`,
+		delta.Score, delta.Deviation, delta.Volatility, wins, losses, draws, botID)
+	if err := row.Scan(&r.Score, &r.Deviation, &r.Volatility); err != nil {
+		if err == sql.ErrNoRows {
+			return r, errors.Wrapf(utils.ErrNotExists, "bot %d does not exist: %v", botID, err)
+		}
+
+		return r, errors.Wrapf(utils.ErrInternal, "can not apply match outcome to bot %d: %v", botID, err)
+	}
+
+	return r, nil
+}
+
+func insertMatch(tx *sql.Tx, m *MatchModel) error {
 	m.Timestamp = time.Now()
 	row := tx.QueryRow(`INSERT INTO matches (game_slug, info, states, error, result, error_1, error_2,
-		time, bot_1, author_1, log_1, diff_1, bot_2, author_2, log_2, diff_2)
-	 	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16) RETURNING id, time`,
+		time, bot_1, author_1, log_1, diff_1, version_1, bot_2, author_2, log_2, diff_2, version_2, job_id)
+	 	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+	 	RETURNING id, time`,
 		&m.GameSlug, &m.Info, &m.States, &m.Error, &m.Result, &m.Error1, &m.Error2, &m.Timestamp, &m.Bot1,
-		&m.Author1, &m.Log1, &m.Diff1, &m.Bot2, &m.Author2, &m.Log2, &m.Diff2)
-	if err = row.Scan(&m.ID, &m.Timestamp); err != nil {
+		&m.Author1, &m.Log1, &m.Diff1, &m.Version1, &m.Bot2, &m.Author2, &m.Log2, &m.Diff2, &m.Version2, &m.JobID)
+	if err := row.Scan(&m.ID, &m.Timestamp); err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			return errors.Wrapf(utils.ErrTaken, "match of this job is already recorded: %v", err)
+		}
+
 		return errors.Wrapf(utils.ErrInternal, "create match row error: %v", err)
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		return errors.Wrapf(utils.ErrInternal, "can not commit match create transaction: %v", err)
+	if len(m.Participants) == 0 {
+		m.Participants = twoPlayerParticipants(m)
+	}
+	for _, p := range m.Participants {
+		p.MatchID = m.ID
+		_, err := tx.Exec(`INSERT INTO match_participants (match_id, position, bot_id, author_id, version,
+			placement, error, log, diff) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);`,
+			p.MatchID, p.Position, p.BotID, p.AuthorID, p.Version, p.Placement, p.Error, p.Log, p.Diff)
+		if err != nil {
+			return errors.Wrapf(utils.ErrInternal, "create match participant row error: %v", err)
+		}
 	}
 
 	return nil
@@ -113,12 +367,15 @@ func (o *MatchObject) Create(m *MatchModel) error {
 // GetMatchByID Получение матча по его идентификатору
 func (o *MatchObject) GetMatchByID(matchID int64) (*MatchModel, error) {
 	row := pqConn.QueryRow(`SELECT m.id, m.game_slug, m.info, m.states, m.error, m.result,
-	m.error_1, m.error_2, m.time, m.bot_1, m.author_1, m.log_1, m.diff_1,
-	m.bot_2, m.author_2, m.log_2, m.diff_2 FROM matches m WHERE m.id=$1`, matchID)
+	m.error_1, m.error_2, m.time, m.bot_1, m.author_1, m.log_1, m.diff_1, m.version_1,
+	m.bot_2, m.author_2, m.log_2, m.diff_2, m.version_2, b1.is_archived, COALESCE(b2.is_archived, false)
+	FROM matches m JOIN bots b1 ON b1.id = m.bot_1 LEFT JOIN bots b2 ON b2.id = m.bot_2
+	WHERE m.id=$1`, matchID)
 
 	m := &MatchModel{}
 	err := row.Scan(&m.ID, &m.GameSlug, &m.Info, &m.States, &m.Error, &m.Result, &m.Error1, &m.Error2, &m.Timestamp,
-		&m.Bot1, &m.Author1, &m.Log1, &m.Diff1, &m.Bot2, &m.Author2, &m.Log2, &m.Diff2)
+		&m.Bot1, &m.Author1, &m.Log1, &m.Diff1, &m.Version1, &m.Bot2, &m.Author2, &m.Log2, &m.Diff2, &m.Version2,
+		&m.Bot1Archived, &m.Bot2Archived)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.Wrapf(utils.ErrNotExists, "match with this id does not exist: %v", err)
@@ -130,16 +387,20 @@ func (o *MatchObject) GetMatchByID(matchID int64) (*MatchModel, error) {
 	return m, nil
 }
 
-// GetMatchesByGameSlugAndAuthorID получение списка матчей для игры и/или автора
+// GetMatchesByGameSlugAndAuthorID получение списка матчей для игры и/или автора.
+// Автор может играть в матче на любом месте, не только первым или вторым
 func (o *MatchObject) GetMatchesByGameSlugAndAuthorID(authorID int64,
 	gameSlug string, limit, since int64) ([]*MatchModel, error) {
 	args := []interface{}{since}
 
 	query := `SELECT m.id, m.game_slug, m.info, m.states, m.error, m.result, m.error_1, m.error_2,
-	m.time, m.bot_1, m.author_1, m.log_1, m.diff_1, m.bot_2,
-	m.author_2, m.log_2, m.diff_2 FROM matches m WHERE m.id < $1`
+	m.time, m.bot_1, m.author_1, m.log_1, m.diff_1, m.version_1, m.bot_2,
+	m.author_2, m.log_2, m.diff_2, m.version_2, b1.is_archived, COALESCE(b2.is_archived, false)
+	FROM matches m JOIN bots b1 ON b1.id = m.bot_1 LEFT JOIN bots b2 ON b2.id = m.bot_2
+	WHERE m.id < $1`
 	if authorID > 0 {
-		query += ` AND (m.author_1 = $2 OR m.author_2 = $2)`
+		query += ` AND EXISTS (SELECT 1 FROM match_participants mp
+			WHERE mp.match_id = m.id AND mp.author_id = $2)`
 		args = append(args, authorID)
 	}
 
@@ -164,7 +425,8 @@ func (o *MatchObject) GetMatchesByGameSlugAndAuthorID(authorID int64,
 	for rows.Next() {
 		m := &MatchModel{}
 		err := rows.Scan(&m.ID, &m.GameSlug, &m.Info, &m.States, &m.Error, &m.Result, &m.Error1, &m.Error2, &m.Timestamp,
-			&m.Bot1, &m.Author1, &m.Log1, &m.Diff1, &m.Bot2, &m.Author2, &m.Log2, &m.Diff2)
+			&m.Bot1, &m.Author1, &m.Log1, &m.Diff1, &m.Version1, &m.Bot2, &m.Author2, &m.Log2, &m.Diff2, &m.Version2,
+			&m.Bot1Archived, &m.Bot2Archived)
 		if err != nil {
 			return nil, errors.Wrapf(utils.ErrInternal, "get bots by game slug and author id scan bot error: %v", err)
 		}
@@ -173,3 +435,52 @@ func (o *MatchObject) GetMatchesByGameSlugAndAuthorID(authorID int64,
 
 	return matches, nil
 }
+
+// GetRecentPairs пары ботов, которые играли между собой после since.
+// Матч нескольких ботов даёт все пары его участников
+func (o *MatchObject) GetRecentPairs(gameSlug string, since time.Time) (map[botPair]bool, error) {
+	rows, err := pqConn.Query(`SELECT DISTINCT least(p1.bot_id, p2.bot_id), greatest(p1.bot_id, p2.bot_id)
+		FROM matches m JOIN match_participants p1 ON p1.match_id = m.id
+		JOIN match_participants p2 ON p2.match_id = m.id AND p2.position > p1.position
+		WHERE m.game_slug = $1 AND m.time > $2;`, gameSlug, since)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "get recent pairs error: %v", err)
+	}
+	defer rows.Close()
+
+	pairs := make(map[botPair]bool)
+	for rows.Next() {
+		var bot1, bot2 int64
+		if err = rows.Scan(&bot1, &bot2); err != nil {
+			return nil, errors.Wrapf(utils.ErrInternal, "get recent pairs scan error: %v", err)
+		}
+		pairs[newBotPair(bot1, bot2)] = true
+	}
+
+	return pairs, nil
+}
+
+// GetParticipants все игроки матча по порядку
+func (o *MatchObject) GetParticipants(matchID int64) ([]*MatchParticipantModel, error) {
+	rows, err := pqConn.Query(`SELECT mp.match_id, mp.position, mp.bot_id, mp.author_id, mp.version,
+		mp.placement, mp.error, mp.log, mp.diff, b.is_archived
+		FROM match_participants mp JOIN bots b ON b.id = mp.bot_id
+		WHERE mp.match_id = $1 ORDER BY mp.position;`, matchID)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "get match participants error: %v", err)
+	}
+	defer rows.Close()
+
+	participants := make([]*MatchParticipantModel, 0)
+	for rows.Next() {
+		p := &MatchParticipantModel{}
+		err = rows.Scan(&p.MatchID, &p.Position, &p.BotID, &p.AuthorID, &p.Version,
+			&p.Placement, &p.Error, &p.Log, &p.Diff, &p.BotArchived)
+		if err != nil {
+			return nil, errors.Wrapf(utils.ErrInternal, "get match participants scan error: %v", err)
+		}
+		participants = append(participants, p)
+	}
+
+	return participants, nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+func TestRecordMatchOutcomeOK(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE bots").
+		WithArgs(10.4, -5.0, 0.0, 1, 0, 0, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"score", "score_deviation", "score_volatility"}).
+			AddRow(510.4, 95.0, 0.06))
+	mock.ExpectQuery("UPDATE bots").
+		WithArgs(-10.4, -5.0, 0.0, 0, 1, 0, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"score", "score_deviation", "score_volatility"}).
+			AddRow(489.6, 95.0, 0.06))
+	mock.ExpectQuery("INSERT INTO matches").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "time"}).AddRow(3, time.Time{}))
+	mock.ExpectExec("INSERT INTO match_participants").
+		WithArgs(3, 1, 1, 0, 1, 1, nil, sqlmock.AnyArg(), 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO match_participants").
+		WithArgs(3, 2, 2, 0, 2, 2, nil, sqlmock.AnyArg(), -10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO rating_history").
+		WithArgs(1, 3, 1, 510.4, 95.0, "match").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO rating_history").
+		WithArgs(2, 3, 2, 489.6, 95.0, "match").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	pqConn = db
+	Matches = &MatchObject{}
+
+	m := &MatchModel{
+		Result:   1,
+		Bot1:     1,
+		Version1: 1,
+		Bot2:     sql.NullInt64{Int64: 2, Valid: true},
+		Version2: sql.NullInt64{Int64: 2, Valid: true},
+	}
+	r1, r2, err := Matches.RecordMatchOutcome(m,
+		Rating{Score: 10.4, Deviation: -5}, Rating{Score: -10.4, Deviation: -5})
+	if err != nil {
+		t.Errorf("TestRecordMatchOutcomeOK got unexpected error: %v", err)
+	}
+
+	if r1.Score != 510.4 || r2.Score != 489.6 {
+		t.Errorf("TestRecordMatchOutcomeOK got unexpected ratings: %+v, %+v", r1, r2)
+	}
+	// 500 -> 510, 500 -> 490 с учётом округления очков в DB
+	if m.ID != 3 || m.Diff1 != 10 || m.GetDiff2() != -10 {
+		t.Errorf("TestRecordMatchOutcomeOK got unexpected match: %+v", m)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestRecordMatchOutcomeOK there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRecordMatchOutcomeRollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE bots").
+		WithArgs(0.0, 0.0, 0.0, 0, 0, 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"score", "score_deviation", "score_volatility"}).
+			AddRow(500.0, 95.0, 0.06))
+	mock.ExpectQuery("UPDATE bots").
+		WithArgs(0.0, 0.0, 0.0, 0, 0, 1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"score", "score_deviation", "score_volatility"}).
+			AddRow(500.0, 95.0, 0.06))
+	mock.ExpectQuery("INSERT INTO matches").
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	pqConn = db
+	Matches = &MatchObject{}
+
+	m := &MatchModel{
+		Result: 0,
+		Bot1:   1,
+		Bot2:   sql.NullInt64{Int64: 2, Valid: true},
+	}
+	_, _, err = Matches.RecordMatchOutcome(m, Rating{}, Rating{})
+	if errors.Cause(err) != utils.ErrInternal {
+		t.Errorf("TestRecordMatchOutcomeRollback got unexpected error: %v, expected: %v", err, utils.ErrInternal)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestRecordMatchOutcomeRollback there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRecordMultiMatchOutcome(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	// второй и третий разделили первое место -- ничья, первый проиграл
+	mock.ExpectQuery("UPDATE bots").
+		WithArgs(-20.0, 0.0, 0.0, 0, 1, 0, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"score", "score_deviation", "score_volatility"}).
+			AddRow(480.0, 0.0, 0.0))
+	mock.ExpectQuery("UPDATE bots").
+		WithArgs(10.0, 0.0, 0.0, 0, 0, 1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"score", "score_deviation", "score_volatility"}).
+			AddRow(510.0, 0.0, 0.0))
+	mock.ExpectQuery("UPDATE bots").
+		WithArgs(10.0, 0.0, 0.0, 0, 0, 1, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"score", "score_deviation", "score_volatility"}).
+			AddRow(510.0, 0.0, 0.0))
+	mock.ExpectQuery("INSERT INTO matches").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "time"}).AddRow(7, time.Time{}))
+	for i := 1; i <= 3; i++ {
+		mock.ExpectExec("INSERT INTO match_participants").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec("UPDATE jobs SET status").
+		WithArgs(5, "done").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	for i := 1; i <= 3; i++ {
+		mock.ExpectExec("INSERT INTO rating_history").
+			WillReturnResult(sqlmock.NewResult(int64(i), 1))
+	}
+	mock.ExpectCommit()
+
+	pqConn = db
+	Matches = &MatchObject{}
+
+	m := &MatchModel{GameSlug: "ffa", JobID: sql.NullInt64{Int64: 5, Valid: true}}
+	for i := int64(1); i <= 3; i++ {
+		placement := int64(1)
+		if i == 1 {
+			placement = 2
+		}
+		m.Participants = append(m.Participants, &MatchParticipantModel{Position: i, BotID: i, AuthorID: 10 + i,
+			Version: 1, Placement: sql.NullInt64{Int64: placement, Valid: true}})
+	}
+
+	_, err = Matches.RecordMultiMatchOutcome(m, []Rating{{Score: -20}, {Score: 10}, {Score: 10}})
+	if err != nil {
+		t.Fatalf("TestRecordMultiMatchOutcome got unexpected error: %v", err)
+	}
+
+	// первые два игрока -- в полях матча на двоих, победителя нет
+	if m.ID != 7 || m.Result != 0 || m.Bot1 != 1 || m.GetBot2() != 2 || m.Diff1 != -20 || m.GetDiff2() != 10 {
+		t.Errorf("TestRecordMultiMatchOutcome got unexpected match: %+v", m)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestRecordMultiMatchOutcome there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRecordMatchOutcomeJobRecorded(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	// матч этой задачи уже записала прошлая попытка
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE bots").
+		WillReturnRows(sqlmock.NewRows([]string{"score", "score_deviation", "score_volatility"}).
+			AddRow(510.4, 95.0, 0.06))
+	mock.ExpectQuery("UPDATE bots").
+		WillReturnRows(sqlmock.NewRows([]string{"score", "score_deviation", "score_volatility"}).
+			AddRow(489.6, 95.0, 0.06))
+	mock.ExpectQuery("INSERT INTO matches").
+		WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectRollback()
+
+	pqConn = db
+	Matches = &MatchObject{}
+
+	m := &MatchModel{
+		Result:   1,
+		Bot1:     1,
+		Version1: 1,
+		Bot2:     sql.NullInt64{Int64: 2, Valid: true},
+		Version2: sql.NullInt64{Int64: 2, Valid: true},
+		JobID:    sql.NullInt64{Int64: 5, Valid: true},
+	}
+	_, _, err = Matches.RecordMatchOutcome(m, Rating{Score: 10.4}, Rating{Score: -10.4})
+	if errors.Cause(err) != utils.ErrTaken {
+		t.Errorf("TestRecordMatchOutcomeJobRecorded got unexpected error: %v, expected: %v", err, utils.ErrTaken)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestRecordMatchOutcomeJobRecorded there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateMatchJobRecorded(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	// несостоявшийся матч задачи, возобновлённой после рестарта
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO matches").
+		WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectRollback()
+
+	pqConn = db
+	Matches = &MatchObject{}
+
+	err = Matches.Create(&MatchModel{
+		Result:   3,
+		Error:    sql.NullString{String: "tester timeout", Valid: true},
+		Bot1:     1,
+		Version1: 1,
+		Bot2:     sql.NullInt64{Int64: 2, Valid: true},
+		Version2: sql.NullInt64{Int64: 2, Valid: true},
+		JobID:    sql.NullInt64{Int64: 5, Valid: true},
+	})
+	if errors.Cause(err) != utils.ErrTaken {
+		t.Errorf("TestCreateMatchJobRecorded got unexpected error: %v, expected: %v", err, utils.ErrTaken)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestCreateMatchJobRecorded there were unfulfilled expectations: %s", err)
+	}
+}
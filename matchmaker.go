@@ -0,0 +1,340 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	matchmakingPairs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "matchmaking_pairs_total",
+		Help: "Number of bot pairs sent to testers by matchmaking",
+	}, []string{"game"})
+	matchmakingSameAuthorSkips = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "matchmaking_same_author_skips_total",
+		Help: "Number of candidates skipped because both bots belong to one author",
+	}, []string{"game"})
+	matchmakingUnpaired = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "matchmaking_unpaired_bots",
+		Help: "Number of bots left without opponent in the last cycle",
+	}, []string{"game"})
+	matchmakingScoreDiff = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "matchmaking_pair_score_diff",
+		Help:    "Absolute score difference between paired bots",
+		Buckets: []float64{25, 50, 100, 200, 400, 800},
+	}, []string{"game"})
+	matchmakingRematchSkips = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "matchmaking_rematch_skips_total",
+		Help: "Number of candidates skipped because the pair played recently",
+	}, []string{"game"})
+	matchmakingRecentGames = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "matchmaking_bot_recent_games",
+		Help:    "Games played by selected bots during the fairness window",
+		Buckets: []float64{0, 1, 2, 5, 10, 20, 50, 100},
+	}, []string{"game"})
+)
+
+func init() {
+	prometheus.MustRegister(matchmakingPairs, matchmakingSameAuthorSkips,
+		matchmakingUnpaired, matchmakingScoreDiff, matchmakingRematchSkips, matchmakingRecentGames)
+}
+
+// fairnessWindow за какое время считаются сыгранные ботом матчи
+const fairnessWindow = 24 * time.Hour
+
+// botPair пара ботов без учёта порядка
+type botPair [2]int64
+
+func newBotPair(bot1, bot2 int64) botPair {
+	if bot1 > bot2 {
+		bot1, bot2 = bot2, bot1
+	}
+
+	return botPair{bot1, bot2}
+}
+
+// pairingRules ограничения подбора пар на один цикл
+type pairingRules struct {
+	// MaxPairs сколько пар можно отправить тестерам
+	MaxPairs int
+	// MinDailyGames боты, сыгравшие за окно справедливости меньше, выбирают
+	// соперника первыми и сразу в максимальном окне
+	MinDailyGames int64
+	// Recent пары, которые недавно играли между собой и ещё не остыли
+	Recent map[botPair]bool
+}
+
+// matchPair пара ботов, которая отправится на матч
+type matchPair struct {
+	Bot1 *BotModel
+	Bot2 *BotModel
+	// Window окно очков, в котором искался соперник для Bot1
+	Window int64
+	// Waited сколько Bot1 ждал соперника
+	Waited time.Duration
+}
+
+// matchGroup боты одного матча на нескольких игроков
+type matchGroup struct {
+	Bots []*BotModel
+	// Window окно очков, в котором искались соперники для Bots[0]
+	Window int64
+	// Waited сколько Bots[0] ждал соперников
+	Waited time.Duration
+}
+
+// pairingStats итоги подбора пар за один цикл; Pairs -- число матчей
+type pairingStats struct {
+	Pairs           int
+	SameAuthorSkips int
+	RematchSkips    int
+	Unpaired        int
+}
+
+// matchmaker подбирает пары ботов с близкими очками. Окно допустимой разницы
+// очков растёт, пока бот ждёт соперника, так что рано или поздно сыграют все
+type matchmaker struct {
+	// BaseWindow допустимая разница очков для бота, который только начал ждать
+	BaseWindow int64
+	// WindowGrowth расширение окна за каждую минуту ожидания
+	WindowGrowth int64
+	// MaxWindow окно, шире которого не бывает
+	MaxWindow int64
+	// ForgetAfter сколько помнить бота, который перестал попадать в выборку
+	ForgetAfter time.Duration
+
+	mu sync.Mutex
+	// game slug -> bot id -> ожидание
+	waiting map[string]map[int64]*waitingBot
+}
+
+type waitingBot struct {
+	since    time.Time
+	lastSeen time.Time
+}
+
+func newMatchmaker() *matchmaker {
+	return &matchmaker{
+		BaseWindow:   100,
+		WindowGrowth: 50,
+		MaxWindow:    1000,
+		ForgetAfter:  10 * time.Minute,
+		waiting:      make(map[string]map[int64]*waitingBot),
+	}
+}
+
+func (mm *matchmaker) window(waited time.Duration) int64 {
+	w := mm.BaseWindow + mm.WindowGrowth*int64(waited/time.Minute)
+	if w > mm.MaxWindow {
+		return mm.MaxWindow
+	}
+
+	return w
+}
+
+// pairBots разбивает ботов игры на пары, см. groupBots
+func (mm *matchmaker) pairBots(gameSlug string, bots []*BotModel, now time.Time,
+	rules *pairingRules) ([]*matchPair, *pairingStats) {
+	groups, stats := mm.groupBots(gameSlug, bots, now, rules, 2)
+
+	pairs := make([]*matchPair, len(groups))
+	for i, g := range groups {
+		pairs[i] = &matchPair{
+			Bot1:   g.Bots[0],
+			Bot2:   g.Bots[1],
+			Window: g.Window,
+			Waited: g.Waited,
+		}
+	}
+
+	return pairs, stats
+}
+
+// groupBots разбивает ботов игры на матчи по size игроков. Каждый бот попадает не больше
+// чем в один матч. Первыми соперников выбирают недоигравшие свой минимум, затем те, кто
+// дольше ждёт; соперники -- ближайшие по очкам боты других авторов в пределах окна,
+// с которыми не было недавнего матча. Боты без матча ждут следующего цикла с более
+// широким окном. Матчей не больше rules.MaxPairs: остальные боты сохраняют очередь ожидания
+func (mm *matchmaker) groupBots(gameSlug string, bots []*BotModel, now time.Time,
+	rules *pairingRules, size int) ([]*matchGroup, *pairingStats) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	waiting, ok := mm.waiting[gameSlug]
+	if !ok {
+		waiting = make(map[int64]*waitingBot)
+		mm.waiting[gameSlug] = waiting
+	}
+
+	for _, bot := range bots {
+		if wb, ok := waiting[bot.ID]; ok {
+			wb.lastSeen = now
+		} else {
+			waiting[bot.ID] = &waitingBot{since: now, lastSeen: now}
+		}
+	}
+
+	byScore := make([]*BotModel, len(bots))
+	copy(byScore, bots)
+	sort.SliceStable(byScore, func(i, j int) bool {
+		return byScore[i].Score < byScore[j].Score
+	})
+	position := make(map[int64]int, len(byScore))
+	for i, bot := range byScore {
+		position[bot.ID] = i
+	}
+
+	byWaiting := make([]*BotModel, len(bots))
+	copy(byWaiting, bots)
+	starving := func(bot *BotModel) bool {
+		return bot.RecentGames < rules.MinDailyGames
+	}
+	sort.SliceStable(byWaiting, func(i, j int) bool {
+		bi, bj := byWaiting[i], byWaiting[j]
+		if starving(bi) != starving(bj) {
+			return starving(bi)
+		}
+		if starving(bi) && bi.RecentGames != bj.RecentGames {
+			return bi.RecentGames < bj.RecentGames
+		}
+
+		return waiting[bi.ID].since.Before(waiting[bj.ID].since)
+	})
+
+	stats := &pairingStats{}
+	paired := make(map[int64]bool, len(bots))
+	groups := make([]*matchGroup, 0, len(bots)/size)
+	for _, bot := range byWaiting {
+		if len(groups) >= rules.MaxPairs {
+			break
+		}
+		if paired[bot.ID] {
+			continue
+		}
+
+		waited := now.Sub(waiting[bot.ID].since)
+		window := mm.window(waited)
+		if starving(bot) {
+			window = mm.MaxWindow
+		}
+
+		group := []*BotModel{bot}
+		paired[bot.ID] = true
+		for len(group) < size {
+			opponent, skips := nearestOpponent(byScore, position[bot.ID], window, paired, rules.Recent, group)
+			stats.SameAuthorSkips += skips.SameAuthor
+			stats.RematchSkips += skips.Rematch
+			if opponent == nil {
+				break
+			}
+			group = append(group, opponent)
+			paired[opponent.ID] = true
+		}
+		if len(group) < size {
+			// матч не собрался -- боты свободны для других
+			for _, b := range group {
+				delete(paired, b.ID)
+			}
+			continue
+		}
+
+		for _, b := range group {
+			delete(waiting, b.ID)
+		}
+		groups = append(groups, &matchGroup{
+			Bots:   group,
+			Window: window,
+			Waited: waited,
+		})
+	}
+
+	// забываем тех, кто давно не попадал в выборку
+	for id, wb := range waiting {
+		if now.Sub(wb.lastSeen) > mm.ForgetAfter {
+			delete(waiting, id)
+		}
+	}
+
+	stats.Pairs = len(groups)
+	stats.Unpaired = len(bots) - size*len(groups)
+	return groups, stats
+}
+
+// opponentSkips пропущенные при поиске соперника кандидаты
+type opponentSkips struct {
+	SameAuthor int
+	Rematch    int
+}
+
+// nearestOpponent ищет ближайшего по очкам свободного бота, автор которого не играет
+// в группе и который недавно не встречался ни с кем из группы, расходясь от позиции
+// бота в отсортированном по очкам списке в обе стороны
+func nearestOpponent(byScore []*BotModel, pos int, window int64,
+	paired map[int64]bool, recent map[botPair]bool, group []*BotModel) (*BotModel, opponentSkips) {
+	bot := byScore[pos]
+	skips := opponentSkips{}
+	left, right := pos-1, pos+1
+	for left >= 0 || right < len(byScore) {
+		var candidate *BotModel
+		leftDiff, rightDiff := -1.0, -1.0
+		if left >= 0 {
+			leftDiff = bot.Score - byScore[left].Score
+		}
+		if right < len(byScore) {
+			rightDiff = byScore[right].Score - bot.Score
+		}
+
+		if rightDiff < 0 || (leftDiff >= 0 && leftDiff <= rightDiff) {
+			candidate = byScore[left]
+			left--
+		} else {
+			candidate = byScore[right]
+			right++
+		}
+
+		if math.Abs(candidate.Score-bot.Score) > float64(window) {
+			// дальше только хуже
+			break
+		}
+
+		if paired[candidate.ID] {
+			continue
+		}
+		if sameAuthor(group, candidate) {
+			skips.SameAuthor++
+			continue
+		}
+		if playedRecently(group, candidate, recent) {
+			skips.Rematch++
+			continue
+		}
+
+		return candidate, skips
+	}
+
+	return nil, skips
+}
+
+func sameAuthor(group []*BotModel, candidate *BotModel) bool {
+	for _, b := range group {
+		if b.AuthorID == candidate.AuthorID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func playedRecently(group []*BotModel, candidate *BotModel, recent map[botPair]bool) bool {
+	for _, b := range group {
+		if recent[newBotPair(b.ID, candidate.ID)] {
+			return true
+		}
+	}
+
+	return false
+}
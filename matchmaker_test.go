@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPairBotsByScore(t *testing.T) {
+	mm := newMatchmaker()
+	bots := []*BotModel{
+		{ID: 1, AuthorID: 1, Score: 2000},
+		{ID: 2, AuthorID: 2, Score: 400},
+		{ID: 3, AuthorID: 3, Score: 1950},
+		{ID: 4, AuthorID: 4, Score: 420},
+	}
+
+	pairs, stats := mm.pairBots("pong", bots, time.Now(), &pairingRules{MaxPairs: len(bots)})
+	if stats.Pairs != 2 || stats.Unpaired != 0 {
+		t.Fatalf("TestPairBotsByScore got unexpected stats: %+v", stats)
+	}
+
+	for _, p := range pairs {
+		diff := p.Bot1.Score - p.Bot2.Score
+		if diff < -100 || diff > 100 {
+			t.Errorf("TestPairBotsByScore paired far bots: %.0f vs %.0f", p.Bot1.Score, p.Bot2.Score)
+		}
+	}
+}
+
+func TestPairBotsSkipsSameAuthor(t *testing.T) {
+	mm := newMatchmaker()
+	bots := []*BotModel{
+		{ID: 1, AuthorID: 1, Score: 500},
+		{ID: 2, AuthorID: 1, Score: 510},
+		{ID: 3, AuthorID: 2, Score: 530},
+	}
+
+	pairs, stats := mm.pairBots("pong", bots, time.Now(), &pairingRules{MaxPairs: len(bots)})
+	if len(pairs) != 1 {
+		t.Fatalf("TestPairBotsSkipsSameAuthor got %d pairs, expected 1", len(pairs))
+	}
+
+	if pairs[0].Bot1.AuthorID == pairs[0].Bot2.AuthorID {
+		t.Errorf("TestPairBotsSkipsSameAuthor paired bots of one author")
+	}
+
+	if stats.SameAuthorSkips == 0 || stats.Unpaired != 1 {
+		t.Errorf("TestPairBotsSkipsSameAuthor got unexpected stats: %+v", stats)
+	}
+}
+
+func TestPairBotsWindowWidens(t *testing.T) {
+	mm := newMatchmaker()
+	bots := []*BotModel{
+		{ID: 1, AuthorID: 1, Score: 400},
+		{ID: 2, AuthorID: 2, Score: 800},
+	}
+
+	now := time.Now()
+	if pairs, _ := mm.pairBots("pong", bots, now, &pairingRules{MaxPairs: len(bots)}); len(pairs) != 0 {
+		t.Fatalf("TestPairBotsWindowWidens paired bots outside of base window")
+	}
+
+	// за 6 минут окно вырастает до 400
+	if pairs, _ := mm.pairBots("pong", bots, now.Add(6*time.Minute), &pairingRules{MaxPairs: len(bots)}); len(pairs) != 1 {
+		t.Errorf("TestPairBotsWindowWidens did not pair bots after waiting")
+	}
+}
+
+func TestPairBotsMaxPairs(t *testing.T) {
+	mm := newMatchmaker()
+	bots := []*BotModel{
+		{ID: 1, AuthorID: 1, Score: 500},
+		{ID: 2, AuthorID: 2, Score: 510},
+		{ID: 3, AuthorID: 3, Score: 520},
+		{ID: 4, AuthorID: 4, Score: 530},
+	}
+
+	now := time.Now()
+	pairs, _ := mm.pairBots("pong", bots, now, &pairingRules{MaxPairs: 1})
+	if len(pairs) != 1 {
+		t.Fatalf("TestPairBotsMaxPairs got %d pairs, expected 1", len(pairs))
+	}
+
+	// оставшиеся боты продолжают ждать с прежнего момента
+	if waited := len(mm.waiting["pong"]); waited != 2 {
+		t.Errorf("TestPairBotsMaxPairs got %d waiting bots, expected 2", waited)
+	}
+}
+
+func TestPairBotsSkipsRecentRematch(t *testing.T) {
+	mm := newMatchmaker()
+	bots := []*BotModel{
+		{ID: 1, AuthorID: 1, Score: 500},
+		{ID: 2, AuthorID: 2, Score: 505},
+		{ID: 3, AuthorID: 3, Score: 550},
+	}
+
+	pairs, stats := mm.pairBots("pong", bots, time.Now(), &pairingRules{
+		MaxPairs: len(bots),
+		Recent:   map[botPair]bool{newBotPair(2, 1): true},
+	})
+	if len(pairs) != 1 || stats.RematchSkips == 0 {
+		t.Fatalf("TestPairBotsSkipsRecentRematch got unexpected result: %d pairs, %+v", len(pairs), stats)
+	}
+
+	if newBotPair(pairs[0].Bot1.ID, pairs[0].Bot2.ID) == newBotPair(1, 2) {
+		t.Errorf("TestPairBotsSkipsRecentRematch paired bots that played recently")
+	}
+}
+
+func TestPairBotsPrefersUnderplayed(t *testing.T) {
+	mm := newMatchmaker()
+	bots := []*BotModel{
+		{ID: 1, AuthorID: 1, Score: 500, RecentGames: 10},
+		{ID: 2, AuthorID: 2, Score: 510, RecentGames: 12},
+		{ID: 3, AuthorID: 3, Score: 1200, RecentGames: 0},
+	}
+
+	// недоигравший бот выбирает соперника первым и сразу в максимальном окне
+	pairs, _ := mm.pairBots("pong", bots, time.Now(), &pairingRules{MaxPairs: 1, MinDailyGames: 5})
+	if len(pairs) != 1 || pairs[0].Bot1.ID != 3 {
+		t.Fatalf("TestPairBotsPrefersUnderplayed got unexpected pairs: %+v", pairs)
+	}
+}
+
+func TestGroupBotsThreePlayers(t *testing.T) {
+	mm := newMatchmaker()
+	bots := []*BotModel{
+		{ID: 1, AuthorID: 1, Score: 500},
+		{ID: 2, AuthorID: 1, Score: 505},
+		{ID: 3, AuthorID: 2, Score: 510},
+		{ID: 4, AuthorID: 3, Score: 520},
+		{ID: 5, AuthorID: 4, Score: 530},
+	}
+
+	groups, stats := mm.groupBots("ffa", bots, time.Now(), &pairingRules{MaxPairs: len(bots)}, 3)
+	if len(groups) != 1 || stats.Unpaired != 2 {
+		t.Fatalf("TestGroupBotsThreePlayers got unexpected result: %d groups, %+v", len(groups), stats)
+	}
+
+	authors := make(map[int64]bool)
+	for _, b := range groups[0].Bots {
+		if authors[b.AuthorID] {
+			t.Errorf("TestGroupBotsThreePlayers grouped bots of one author: %+v", groups[0].Bots)
+		}
+		authors[b.AuthorID] = true
+	}
+}
@@ -5,69 +5,199 @@ import (
 	"database/sql"
 	"encoding/json"
 	"math"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/HotCodeGroup/warscript-utils/models"
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
 var (
 	botsLimit = int64(100)
-	gameSlugs = []string{"pong", "2atod"}
+
+	mm = newMatchmaker()
 )
 
-func startMatchmaking() {
+// startMatchmaking фоновый подбор матчей, выполняется только лидером
+func startMatchmaking(stop <-chan struct{}) {
 	for {
 		timer := time.NewTimer(10 * time.Second)
-		for _, gameSlug := range gameSlugs {
-			bots, err := Bots.GetBotsForTesting(botsLimit, gameSlug)
+		load, err := loadTesterLoad()
+		if err != nil {
+			logger.Error(errors.Wrap(err, "can not get tester load, skipping cycle"))
+			load = &testerLoad{Queued: testerMaxQueued}
+		}
+
+		for _, game := range games.Enabled() {
+			select {
+			case <-stop:
+				timer.Stop()
+				return
+			default:
+			}
+
+			gameSlug := game.Slug
+			budget := load.matchBudget(game)
+			if budget == 0 {
+				// тестеры не справляются -- период не закрываем, боты подождут
+				logger.WithField("game", gameSlug).Warnf("matchmaking: testers are saturated "+
+					"(%d running, %d queued), skipping", load.Running[gameSlug], load.Queued)
+				matchmakingThrottled.WithLabelValues(gameSlug, "saturated").Inc()
+				continue
+			}
+
+			now := time.Now()
+			bots, err := Bots.GetBotsForTesting(botsLimit, gameSlug, now.Add(-fairnessWindow))
 			if err != nil {
 				logger.Error(errors.Wrap(err, "can't get bots for testing "+gameSlug))
 				continue
 			}
-			if len(bots) < 1 {
+			if len(bots) < 2 {
 				continue
 			}
 
+			recent, err := Matches.GetRecentPairs(gameSlug, now.Add(-game.rematchCooldown()))
+			if err != nil {
+				logger.Error(errors.Wrap(err, "can't get recent pairs "+gameSlug))
+				continue
+			}
+
+			for _, bot := range bots {
+				matchmakingRecentGames.WithLabelValues(gameSlug).Observe(float64(bot.RecentGames))
+			}
+
+			players := game.players()
+			groups, stats := mm.groupBots(gameSlug, bots, now, &pairingRules{
+				MaxPairs:      int(budget),
+				MinDailyGames: game.minDailyGames(),
+				Recent:        recent,
+			}, players)
+			if int64(len(bots)/players) > budget {
+				matchmakingThrottled.WithLabelValues(gameSlug, "shrunk").Inc()
+			}
+			logger.WithField("game", gameSlug).Infof("matchmaking: %d bots, %d matches, %d unpaired, "+
+				"%d same author skips, %d rematch skips",
+				len(bots), stats.Pairs, stats.Unpaired, stats.SameAuthorSkips, stats.RematchSkips)
+			matchmakingSameAuthorSkips.WithLabelValues(gameSlug).Add(float64(stats.SameAuthorSkips))
+			matchmakingRematchSkips.WithLabelValues(gameSlug).Add(float64(stats.RematchSkips))
+			matchmakingUnpaired.WithLabelValues(gameSlug).Set(float64(stats.Unpaired))
+
 			wg := sync.WaitGroup{}
-			for i := 0; i < len(bots); i++ {
-				nextI := i + 1
-				if nextI == len(bots) {
-					nextI = 0
+			playedIDs := make([]int64, 0, players*len(groups))
+			for _, group := range groups {
+				ids := make([]int64, len(group.Bots))
+				scores := make([]string, len(group.Bots))
+				minScore, maxScore := group.Bots[0].Score, group.Bots[0].Score
+				for i, bot := range group.Bots {
+					ids[i] = bot.ID
+					scores[i] = strconv.FormatFloat(bot.Score, 'f', 0, 64)
+					minScore, maxScore = math.Min(minScore, bot.Score), math.Max(maxScore, bot.Score)
 				}
-
-				if bots[i].Language == bots[nextI].Language && bots[i].AuthorID != bots[nextI].AuthorID {
-					// делаем RPC запрос
-					events, err := sendForVerifyRPC(&TestTask{
-						Code1:    bots[i].Code,
-						Code2:    bots[nextI].Code,
-						GameSlug: gameSlug, // так как citext, то ориджинал слаг в gameInfo
-						Language: Lang(bots[i].Language),
-					})
-					if err != nil {
-						logger.Error(errors.Wrap(err, "failed to call testing rpc"))
-						continue
-					}
-					// запускаем обработчик ответа RPC
-
-					go func(b1 *BotModel, b2 *BotModel, ev <-chan *TesterStatusQueue) {
-						defer wg.Done()
-
-						wg.Add(1)
-						processTestingStatus(b1, b2, h.broadcast, ev)
-					}(bots[i], bots[nextI], events)
+				logger.WithFields(logrus.Fields{
+					"game":    gameSlug,
+					"bot_ids": ids,
+				}).Infof("pairing %s (window %d, waited %s)",
+					strings.Join(scores, " vs "), group.Window, group.Waited)
+
+				// язык не важен: разноязычные матчи уходят в общую очередь тестеров
+				// делаем RPC запрос
+				job := rankedJob(gameSlug, group.Bots)
+				events, err := startJob(job, rankedTask(gameSlug, group.Bots))
+				if err != nil {
+					logger.Error(errors.Wrap(err, "failed to call testing rpc"))
+					continue
 				}
+				matchmakingPairs.WithLabelValues(gameSlug).Inc()
+				matchmakingScoreDiff.WithLabelValues(gameSlug).Observe(maxScore - minScore)
+
+				playedIDs = append(playedIDs, ids...)
+				load.dispatched(gameSlug, 1)
+
+				// запускаем обработчик ответа RPC
+				wg.Add(1)
+				go func(jobID int64, bots []*BotModel, ev <-chan *TesterStatusQueue) {
+					defer wg.Done()
+					processRankedStatus(jobID, bots, h.broadcast, ev)
+				}(job.ID, group.Bots, events)
 			}
 
 			wg.Wait()
+
+			// цикл -- рейтинговый период: каждый бот сыграл в нём не больше одного матча,
+			// и его рейтинг уже пересчитан по этому матчу; у не игравших растёт неуверенность
+			closeRatingPeriod(game, playedIDs, now)
 		}
-		<-timer.C
+
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// closeRatingPeriod конец рейтингового периода игры: пересчёт рейтинга ботов, не игравших в цикле
+func closeRatingPeriod(game *GameConfig, playedIDs []int64, now time.Time) {
+	// неактивными ботами занимается затухание, иначе их неуверенность росла бы дважды
+	var activeSince time.Time
+	if game.Decay != nil && game.Decay.InactiveDays > 0 {
+		activeSince = inactiveSince(game.Slug, now)
+	}
+
+	err := Bots.UpdateIdleRatings(game.Slug, playedIDs, activeSince, ratingSystemFor(game.Slug).Idle)
+	if err != nil {
+		logger.Error(errors.Wrap(err, "can't close rating period "+game.Slug))
+	}
+}
+
+// rankedJob запись рейтингового матча в jobs
+func rankedJob(gameSlug string, bots []*BotModel) *JobModel {
+	players := make(pq.Int64Array, len(bots))
+	for i, bot := range bots {
+		players[i] = bot.ID
+	}
+
+	return &JobModel{
+		Type:     jobRanked,
+		GameSlug: gameSlug,
+		Bot1:     bots[0].ID,
+		Version1: bots[0].Version,
+		Author1:  bots[0].AuthorID,
+		Bot2:     sql.NullInt64{Int64: bots[1].ID, Valid: true},
+		Players:  players,
+	}
+}
+
+// rankedTask задача тестерам на рейтинговый матч
+func rankedTask(gameSlug string, bots []*BotModel) *TestTask {
+	players := make([]*TestPlayer, len(bots))
+	for i, bot := range bots {
+		players[i] = botPlayer(bot)
 	}
+
+	// так как citext, то ориджинал слаг в gameInfo
+	return newTestTask(gameSlug, players...)
 }
 
-func processTestingStatus(bot1, bot2 *BotModel,
+// processRankedStatus обработка рейтингового матча задачи jobID. Матчи на двоих обрабатываются
+// как раньше, чтобы ответы API и уведомления не изменились
+func processRankedStatus(jobID int64, bots []*BotModel, broadcast chan<- *BotStatusMessage,
+	events <-chan *TesterStatusQueue) {
+	if len(bots) == 2 {
+		processTestingStatus(jobID, bots[0], bots[1], broadcast, events)
+		return
+	}
+
+	processMultiTestingStatus(jobID, bots, broadcast, events)
+}
+
+func processTestingStatus(jobID int64, bot1, bot2 *BotModel,
 	broadcast chan<- *BotStatusMessage, events <-chan *TesterStatusQueue) {
 	gameSlug := bot1.GameSlug
 
@@ -91,43 +221,43 @@ func processTestingStatus(bot1, bot2 *BotModel,
 				continue
 			}
 
-			// Обновили ботов
-			newScore1, newScore2 := newRatings(bot1.Score, bot2.Score, res.Winner)
-			err = Bots.SetBotScoreByID(bot1.ID, newScore1)
-			if err != nil {
-				logger.Error(errors.Wrap(err, "can't update bot1 score"))
-				continue
-			}
-			err = Bots.SetBotScoreByID(bot2.ID, newScore2)
-			if err != nil {
-				logger.Error(errors.Wrap(err, "can't update bot2 score"))
-				continue
-			}
+			// Пересчитали рейтинги по системе игры
+			newRating1, newRating2 := ratingSystemFor(gameSlug).Rate(bot1.Rating(), bot2.Rating(), res.Winner)
 
-			// сохранили матч
+			// сохранили матч и рейтинги одной транзакцией
 			m := &MatchModel{
 				Info:     res.Info,
 				States:   res.States,
 				Result:   res.Winner,
 				GameSlug: gameSlug,
 
-				Bot1:    bot1.ID,
-				Error1:  sql.NullString{String: res.Error1, Valid: res.Error1 != ""},
-				Author1: bot1.AuthorID,
-				Log1:    res.Logs1,
-				Diff1:   newScore1 - bot1.Score,
-
-				Bot2:    sql.NullInt64{Int64: bot2.ID, Valid: true},
-				Error2:  sql.NullString{String: res.Error2, Valid: res.Error2 != ""},
-				Author2: sql.NullInt64{Int64: bot2.AuthorID, Valid: true},
-				Log2:    res.Logs2,
-				Diff2:   sql.NullInt64{Int64: newScore2 - bot2.Score, Valid: true},
+				Bot1:     bot1.ID,
+				Error1:   sql.NullString{String: res.Error1, Valid: res.Error1 != ""},
+				Author1:  bot1.AuthorID,
+				Log1:     res.Logs1,
+				Version1: bot1.Version,
+
+				Bot2:     sql.NullInt64{Int64: bot2.ID, Valid: true},
+				Error2:   sql.NullString{String: res.Error2, Valid: res.Error2 != ""},
+				Author2:  sql.NullInt64{Int64: bot2.AuthorID, Valid: true},
+				Log2:     res.Logs2,
+				Version2: sql.NullInt64{Int64: bot2.Version, Valid: true},
+
+				JobID: sql.NullInt64{Int64: jobID, Valid: true},
 			}
-			err = Matches.Create(m)
+			newRating1, newRating2, err = Matches.RecordMatchOutcome(m,
+				newRating1.Sub(bot1.Rating()), newRating2.Sub(bot2.Rating()))
 			if err != nil {
-				logger.Error(errors.Wrap(err, "can not save match"))
+				if errors.Cause(err) == utils.ErrTaken {
+					logger.Warn("match of this job is already recorded")
+					continue
+				}
+
+				logger.Error(errors.Wrap(err, "can not record match outcome"))
 				continue
 			}
+			newScore1, newScore2 := roundScore(newRating1.Score), roundScore(newRating2.Score)
+			diff1, diff2 := m.Diff1, m.GetDiff2()
 
 			// делаем запрос
 			userIDsM := &models.UserIDs{
@@ -171,17 +301,21 @@ func processTestingStatus(bot1, bot2 *BotModel,
 			}
 
 			body, err := json.Marshal(&MatchInfo{
-				ID:        m.ID,
-				Result:    m.Result,
-				GameSlug:  m.GameSlug,
-				Author1:   ai1,
-				Author2:   ai2,
-				Bot1ID:    bot1.ID,
-				Bot2ID:    bot2.ID,
-				NewScore1: newScore1,
-				NewScore2: newScore2,
-				Diff1:     newScore1 - bot1.Score,
-				Diff2:     newScore2 - bot2.Score,
+				ID:            m.ID,
+				Result:        m.Result,
+				GameSlug:      m.GameSlug,
+				Author1:       ai1,
+				Author2:       ai2,
+				Bot1ID:        bot1.ID,
+				Bot2ID:        bot2.ID,
+				Version1:      bot1.Version,
+				Version2:      bot2.Version,
+				NewScore1:     newScore1,
+				NewScore2:     newScore2,
+				NewDeviation1: roundScore(newRating1.Deviation),
+				NewDeviation2: roundScore(newRating2.Deviation),
+				Diff1:         diff1,
+				Diff2:         diff2,
 			})
 			if err != nil {
 				logger.Error(errors.Wrap(err, "can marshal match info"))
@@ -208,7 +342,7 @@ func processTestingStatus(bot1, bot2 *BotModel,
 				BotID:    bot1.ID,
 				GameSlug: gameSlug,
 				MatchID:  m.ID,
-				Diff:     newScore1 - bot1.Score,
+				Diff:     diff1,
 			})
 			if err != nil {
 				logger.Error(errors.Wrap(err, "can not marshal body user1"))
@@ -230,7 +364,7 @@ func processTestingStatus(bot1, bot2 *BotModel,
 				BotID:    bot2.ID,
 				GameSlug: gameSlug,
 				MatchID:  m.ID,
-				Diff:     newScore2 - bot2.Score,
+				Diff:     diff2,
 			})
 			if err != nil {
 				logger.Error(errors.Wrap(err, "can not marshal body user2"))
@@ -247,7 +381,7 @@ func processTestingStatus(bot1, bot2 *BotModel,
 				continue
 			}
 
-		case "error":
+		case "error", "timeout":
 			res := &TesterStatusError{}
 			err := json.Unmarshal(event.Body, res)
 			if err != nil {
@@ -261,15 +395,24 @@ func processTestingStatus(bot1, bot2 *BotModel,
 				Error:    sql.NullString{String: res.Error, Valid: true},
 				GameSlug: gameSlug,
 
-				Bot1:    bot1.ID,
-				Author1: bot1.AuthorID,
-				Diff1:   0,
+				Bot1:     bot1.ID,
+				Author1:  bot1.AuthorID,
+				Diff1:    0,
+				Version1: bot1.Version,
+
+				Bot2:     sql.NullInt64{Int64: bot2.ID, Valid: true},
+				Author2:  sql.NullInt64{Int64: bot2.AuthorID, Valid: true},
+				Diff2:    sql.NullInt64{Int64: 0, Valid: true},
+				Version2: sql.NullInt64{Int64: bot2.Version, Valid: true},
 
-				Bot2:    sql.NullInt64{Int64: bot2.ID, Valid: true},
-				Author2: sql.NullInt64{Int64: bot2.AuthorID, Valid: true},
-				Diff2:   sql.NullInt64{Int64: 0, Valid: true},
+				JobID: sql.NullInt64{Int64: jobID, Valid: true},
 			})
 			if err != nil {
+				if errors.Cause(err) == utils.ErrTaken {
+					logger.Warn("match of this job is already recorded")
+					continue
+				}
+
 				logger.Error(errors.Wrap(err, "can not save match"))
 				continue
 			}
@@ -281,19 +424,3 @@ func processTestingStatus(bot1, bot2 *BotModel,
 		logger.Infof("Processing [%s]: new status: %s", event.Type, status)
 	}
 }
-
-func newRatings(sc1, sc2 int64, winner int) (int64, int64) {
-	if winner == 0 {
-		return sc1 + int64(40*(0.5-expVal(sc2, sc1))), sc2 + int64(40*(0.5-expVal(sc1, sc2)))
-	} else if winner == 1 {
-		return sc1 + int64(40*(1-expVal(sc2, sc1))), sc2 - int64(40*(expVal(sc1, sc2)))
-	} else if winner == 2 {
-		return sc1 - int64(40*(expVal(sc2, sc1))), sc2 + int64(40*(1-expVal(sc1, sc2)))
-	}
-
-	return sc1, sc2
-}
-
-func expVal(sc1, sc2 int64) float64 {
-	return 1.0 / (1 + math.Pow(10, float64(sc1-sc2)/400))
-}
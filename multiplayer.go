@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/HotCodeGroup/warscript-utils/models"
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// getAuthors информация об авторах по их id; авторы, о которых сервис
+// пользователей ничего не вернул, в ответ не попадают
+func getAuthors(ids []int64) (map[int64]*AuthorInfo, error) {
+	userIDs := &models.UserIDs{IDs: make([]*models.UserID, len(ids))}
+	for i, id := range ids {
+		userIDs.IDs[i] = &models.UserID{ID: id}
+	}
+
+	users, err := authGPRC.GetUsersByIDs(context.Background(), userIDs)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not get authors info")
+	}
+
+	authors := make(map[int64]*AuthorInfo, len(users.Users))
+	for _, u := range users.Users {
+		authors[u.ID] = &AuthorInfo{
+			ID:        u.ID,
+			Username:  u.Username,
+			PhotoUUID: u.PhotoUUID,
+			Active:    u.Active,
+		}
+	}
+
+	return authors, nil
+}
+
+// newMatchParticipant участник матча для API
+func newMatchParticipant(p *MatchParticipantModel, authors map[int64]*AuthorInfo) *MatchParticipant {
+	return &MatchParticipant{
+		Position:  p.Position,
+		Author:    authors[p.AuthorID],
+		BotID:     p.BotID,
+		Version:   p.Version,
+		Archived:  p.BotArchived,
+		Placement: p.Placement.Int64,
+		Diff:      p.Diff,
+	}
+}
+
+// multiMatchParticipants участники матча в порядке игроков задачи
+func multiMatchParticipants(bots []*BotModel, res *TesterStatusResult, placements []int) []*MatchParticipantModel {
+	participants := make([]*MatchParticipantModel, len(bots))
+	for i, bot := range bots {
+		playerError := ""
+		if res != nil {
+			playerError = res.playerError(i)
+		}
+
+		participants[i] = &MatchParticipantModel{
+			Position: int64(i + 1),
+			BotID:    bot.ID,
+			AuthorID: bot.AuthorID,
+			Version:  bot.Version,
+			Error:    sql.NullString{String: playerError, Valid: playerError != ""},
+		}
+		if res != nil {
+			participants[i].Log = res.playerLog(i)
+		}
+		if placements != nil {
+			participants[i].Placement = sql.NullInt64{Int64: int64(placements[i]), Valid: true}
+		}
+	}
+
+	return participants
+}
+
+// processMultiTestingStatus обработка рейтингового матча нескольких ботов
+func processMultiTestingStatus(jobID int64, bots []*BotModel, broadcast chan<- *BotStatusMessage,
+	events <-chan *TesterStatusQueue) {
+	gameSlug := bots[0].GameSlug
+
+	ids := make([]int64, len(bots))
+	authorIDs := make([]int64, len(bots))
+	for i, bot := range bots {
+		ids[i], authorIDs[i] = bot.ID, bot.AuthorID
+	}
+	logger := logger.WithFields(logrus.Fields{
+		"bot_ids": ids,
+		"method":  "processMultiTestingStatus",
+	})
+
+	for event := range events {
+		logger.Infof("Processing [%s]", event.Type)
+		switch event.Type {
+		case "status":
+			continue
+		case "result":
+			res := &TesterStatusResult{}
+			err := json.Unmarshal(event.Body, res)
+			if err != nil {
+				logger.Error(errors.Wrap(err, "can not unmarshal result status body"))
+				continue
+			}
+
+			placements, ok := res.placements(len(bots))
+			if !ok {
+				logger.Errorf("tester returned bad placements %v for %d players", res.Placements, len(bots))
+				saveMultiMatchError(logger, jobID, bots, "tester returned bad placements")
+				continue
+			}
+
+			// Пересчитали рейтинги по системе игры
+			ratings := make([]Rating, len(bots))
+			for i, bot := range bots {
+				ratings[i] = bot.Rating()
+			}
+			newRatings := rateMulti(ratingSystemFor(gameSlug), ratings, placements)
+			deltas := make([]Rating, len(bots))
+			for i := range bots {
+				deltas[i] = newRatings[i].Sub(ratings[i])
+			}
+
+			// сохранили матч и рейтинги одной транзакцией
+			m := &MatchModel{
+				Info:         res.Info,
+				States:       res.States,
+				GameSlug:     gameSlug,
+				Participants: multiMatchParticipants(bots, res, placements),
+				JobID:        sql.NullInt64{Int64: jobID, Valid: true},
+			}
+			newRatings, err = Matches.RecordMultiMatchOutcome(m, deltas)
+			if err != nil {
+				if errors.Cause(err) == utils.ErrTaken {
+					logger.Warn("match of this job is already recorded")
+					continue
+				}
+
+				logger.Error(errors.Wrap(err, "can not record match outcome"))
+				continue
+			}
+
+			authors, err := getAuthors(authorIDs)
+			if err != nil {
+				logger.Error(err)
+				continue
+			}
+
+			info := &MatchInfo{
+				ID:            m.ID,
+				Result:        m.Result,
+				GameSlug:      m.GameSlug,
+				Author1:       authors[m.Author1],
+				Author2:       authors[m.GetAuthor2()],
+				Bot1ID:        m.Bot1,
+				Bot2ID:        m.GetBot2(),
+				Version1:      m.Version1,
+				Version2:      m.GetVersion2(),
+				NewScore1:     roundScore(newRatings[0].Score),
+				NewScore2:     roundScore(newRatings[1].Score),
+				NewDeviation1: roundScore(newRatings[0].Deviation),
+				NewDeviation2: roundScore(newRatings[1].Deviation),
+				Diff1:         m.Diff1,
+				Diff2:         m.GetDiff2(),
+				Participants:  make([]*MatchParticipant, len(m.Participants)),
+			}
+			for i, p := range m.Participants {
+				info.Participants[i] = newMatchParticipant(p, authors)
+				info.Participants[i].NewScore = roundScore(newRatings[i].Score)
+				info.Participants[i].NewDeviation = roundScore(newRatings[i].Deviation)
+			}
+
+			body, err := json.Marshal(info)
+			if err != nil {
+				logger.Error(errors.Wrap(err, "can marshal match info"))
+				continue
+			}
+
+			// в общую ленту матч попадает один раз, остальным авторам -- лично
+			for i, p := range m.Participants {
+				broadcast <- &BotStatusMessage{
+					Private:  i > 0,
+					AuthorID: p.AuthorID,
+					GameSlug: gameSlug,
+					Body:     body,
+					Type:     "match",
+				}
+
+				notifyBody, err := json.Marshal(&NotifyMatchMessage{
+					BotID:    p.BotID,
+					GameSlug: gameSlug,
+					MatchID:  m.ID,
+					Diff:     p.Diff,
+				})
+				if err != nil {
+					logger.Error(errors.Wrap(err, "can not marshal notify body"))
+					continue
+				}
+
+				_, err = notifyGRPC.SendNotify(context.Background(), &models.Message{
+					Type: "match",
+					User: p.AuthorID,
+					Game: gameSlug,
+					Body: notifyBody,
+				})
+				if err != nil {
+					logger.Error(errors.Wrapf(err, "can send notify to user %d", p.AuthorID))
+				}
+			}
+
+		case "error", "timeout":
+			res := &TesterStatusError{}
+			err := json.Unmarshal(event.Body, res)
+			if err != nil {
+				logger.Error(errors.Wrap(err, "can not unmarshal error status body"))
+				continue
+			}
+
+			logger.Infof("Match error: %s", res.Error)
+			saveMultiMatchError(logger, jobID, bots, res.Error)
+
+		default:
+			logger.Error(errors.New("can not process unknown status type"))
+		}
+	}
+}
+
+// saveMultiMatchError запись несостоявшегося матча, рейтинг не меняется.
+// Матч задачи, возобновлённой после рестарта, второй раз не запишется
+func saveMultiMatchError(logger *logrus.Entry, jobID int64, bots []*BotModel, errText string) {
+	m := &MatchModel{
+		Result:       3, // код: ошибка
+		Error:        sql.NullString{String: errText, Valid: true},
+		GameSlug:     bots[0].GameSlug,
+		Participants: multiMatchParticipants(bots, nil, nil),
+		JobID:        sql.NullInt64{Int64: jobID, Valid: true},
+	}
+	fillTwoPlayerFields(m)
+
+	if err := Matches.Create(m); err != nil {
+		if errors.Cause(err) == utils.ErrTaken {
+			logger.Warn("match of this job is already recorded")
+			return
+		}
+
+		logger.Error(errors.Wrap(err, "can not save match"))
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultInitialScore очки бота, впервые прошедшего проверку
+	defaultInitialScore = 400
+	defaultEloK         = 40
+
+	ratingSystemElo       = "elo"
+	ratingSystemGlicko2   = "glicko2"
+	ratingSystemTrueSkill = "trueskill"
+)
+
+// Rating рейтинг бота. Смысл Deviation и Volatility зависит от системы:
+// в Glicko-2 это RD и волатильность, в TrueSkill -- сигма, а Elo их не трогает
+type Rating struct {
+	Score      float64
+	Deviation  float64
+	Volatility float64
+}
+
+// Interval 95% доверительный интервал очков
+func (r Rating) Interval() (float64, float64) {
+	return r.Score - 2*r.Deviation, r.Score + 2*r.Deviation
+}
+
+// Sub покомпонентная разность рейтингов, изменение после матча
+func (r Rating) Sub(o Rating) Rating {
+	return Rating{
+		Score:      r.Score - o.Score,
+		Deviation:  r.Deviation - o.Deviation,
+		Volatility: r.Volatility - o.Volatility,
+	}
+}
+
+// RatingSystem способ пересчёта рейтинга ботов после матчей
+type RatingSystem interface {
+	// Initial рейтинг бота, впервые прошедшего проверку
+	Initial() Rating
+	// Rate рейтинги после матча; winner: 0 -- ничья, 1 или 2 -- номер победителя
+	Rate(r1, r2 Rating, winner int) (Rating, Rating)
+	// Idle рейтинг бота, который не играл весь рейтинговый период (цикл матчмейкинга)
+	Idle(r Rating) Rating
+}
+
+// RatingConfig настройки рейтинга для игры; нулевые значения заменяются дефолтами
+type RatingConfig struct {
+	// System одна из: elo, glicko2, trueskill
+	System string `json:"system"`
+	// Initial очки только что проверенного бота
+	Initial float64 `json:"initial"`
+	// K коэффициент Elo
+	K float64 `json:"k"`
+	// Deviation начальное отклонение рейтинга (RD для Glicko-2, сигма для TrueSkill)
+	Deviation float64 `json:"deviation"`
+	// DrawProbability вероятность ничьей между равными ботами для TrueSkill
+	DrawProbability float64 `json:"draw_probability"`
+}
+
+// defaultRatingSystem используется для игр без своих настроек
+var defaultRatingSystem RatingSystem = &glicko2System{
+	initial:    defaultInitialScore,
+	deviation:  glickoInitialDeviation,
+	volatility: glickoInitialVolatility,
+	tau:        glickoTau,
+}
+
+func newRatingSystem(config *RatingConfig) (RatingSystem, error) {
+	if config == nil {
+		return defaultRatingSystem, nil
+	}
+
+	initial := config.Initial
+	if initial == 0 {
+		initial = defaultInitialScore
+	}
+
+	switch config.System {
+	case ratingSystemElo:
+		k := config.K
+		if k == 0 {
+			k = defaultEloK
+		}
+		if k < 0 {
+			return nil, errors.Errorf("elo k must be positive, got %f", k)
+		}
+
+		return &eloSystem{k: k, initial: initial}, nil
+	case ratingSystemGlicko2, "":
+		deviation := config.Deviation
+		if deviation == 0 {
+			deviation = glickoInitialDeviation
+		}
+
+		return &glicko2System{
+			initial:    initial,
+			deviation:  deviation,
+			volatility: glickoInitialVolatility,
+			tau:        glickoTau,
+		}, nil
+	case ratingSystemTrueSkill:
+		sigma := config.Deviation
+		if sigma == 0 {
+			sigma = initial / 3
+		}
+		drawProbability := config.DrawProbability
+		if drawProbability == 0 {
+			drawProbability = trueSkillDrawProbability
+		}
+		if drawProbability < 0 || drawProbability >= 1 {
+			return nil, errors.Errorf("draw probability must be in [0, 1), got %f", drawProbability)
+		}
+
+		return newTrueSkillSystem(initial, sigma, drawProbability), nil
+	default:
+		return nil, errors.Errorf("unknown rating system %q", config.System)
+	}
+}
+
+// ratingSystemFor система рейтинга, выбранная для игры
+func ratingSystemFor(gameSlug string) RatingSystem {
+	if games != nil {
+		if game, ok := games.Get(gameSlug); ok && game.ratingSystem != nil {
+			return game.ratingSystem
+		}
+	}
+
+	return defaultRatingSystem
+}
+
+// roundScore очки для API и истории матчей
+func roundScore(score float64) int64 {
+	return int64(math.Round(score))
+}
+
+// outcome очки первого игрока за матч: 1 -- победа, 0.5 -- ничья, 0 -- поражение
+func outcome(winner int) (float64, bool) {
+	switch winner {
+	case 0:
+		return 0.5, true
+	case 1:
+		return 1, true
+	case 2:
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// eloSystem классический Elo с фиксированным K
+type eloSystem struct {
+	k       float64
+	initial float64
+}
+
+func (es *eloSystem) Initial() Rating {
+	return Rating{Score: es.initial}
+}
+
+func (es *eloSystem) Rate(r1, r2 Rating, winner int) (Rating, Rating) {
+	s1, ok := outcome(winner)
+	if !ok {
+		return r1, r2
+	}
+
+	e1 := 1 / (1 + math.Pow(10, (r2.Score-r1.Score)/400))
+	r1.Score += es.k * (s1 - e1)
+	r2.Score += es.k * ((1 - s1) - (1 - e1))
+
+	return r1, r2
+}
+
+func (es *eloSystem) Idle(r Rating) Rating {
+	return r
+}
+
+// rateMulti рейтинги после матча нескольких игроков; placements -- места, 1 -- лучшее.
+// Матч раскладывается на попарные встречи всех игроков, изменения рейтинга
+// усредняются по числу соперников. Для двух игроков совпадает с Rate
+func rateMulti(system RatingSystem, ratings []Rating, placements []int) []Rating {
+	n := len(ratings)
+	result := make([]Rating, n)
+	copy(result, ratings)
+	if n < 2 {
+		return result
+	}
+
+	deltas := make([]Rating, n)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			winner := 0
+			if placements[i] < placements[j] {
+				winner = 1
+			} else if placements[i] > placements[j] {
+				winner = 2
+			}
+
+			ri, rj := system.Rate(ratings[i], ratings[j], winner)
+			deltas[i] = addRating(deltas[i], ri.Sub(ratings[i]))
+			deltas[j] = addRating(deltas[j], rj.Sub(ratings[j]))
+		}
+	}
+
+	opponents := float64(n - 1)
+	for i := range result {
+		result[i].Score += deltas[i].Score / opponents
+		result[i].Deviation += deltas[i].Deviation / opponents
+		result[i].Volatility += deltas[i].Volatility / opponents
+	}
+
+	return result
+}
+
+func addRating(a, b Rating) Rating {
+	return Rating{
+		Score:      a.Score + b.Score,
+		Deviation:  a.Deviation + b.Deviation,
+		Volatility: a.Volatility + b.Volatility,
+	}
+}
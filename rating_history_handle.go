@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+const (
+	ratingHistoryLimit    = 100
+	ratingHistoryMaxLimit = 1000
+)
+
+// GetBotRatingHistory история рейтинга бота для графика.
+// group=day оставляет по одной точке на день
+func GetBotRatingHistory(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger(r, logger, "GetBotRatingHistory")
+	errWriter := utils.NewErrorResponseWriter(w, logger)
+
+	botID, err := strconv.ParseInt(mux.Vars(r)["bot_id"], 10, 64)
+	if err != nil {
+		errWriter.WriteWarn(http.StatusNotFound, errors.Wrap(err, "wrong format bot_id"))
+		return
+	}
+
+	group := r.URL.Query().Get("group")
+	if group != "" && group != "day" {
+		errWriter.WriteValidationError(&utils.ValidationError{
+			"group": utils.ErrInvalid.Error(),
+		})
+		return
+	}
+
+	limit, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+	if err != nil || limit <= 0 {
+		limit = ratingHistoryLimit
+	}
+	if limit > ratingHistoryMaxLimit {
+		limit = ratingHistoryMaxLimit
+	}
+
+	bot, err := Bots.GetBotByID(botID)
+	if err != nil {
+		if errors.Cause(err) == utils.ErrNotExists {
+			errWriter.WriteWarn(http.StatusNotFound, errors.Wrap(err, "bot not exists"))
+		} else {
+			errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get bot method error"))
+		}
+		return
+	}
+
+	history, err := RatingHistory.GetRatingHistory(bot.ID, group == "day", limit)
+	if err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get rating history method error"))
+		return
+	}
+
+	points := make([]*RatingPoint, len(history))
+	for i, h := range history {
+		points[i] = &RatingPoint{
+			Time:           h.Time,
+			Score:          roundScore(h.Score),
+			ScoreDeviation: roundScore(h.Deviation),
+			Version:        h.Version,
+			Reason:         h.Reason,
+			MatchID:        h.MatchID.Int64,
+		}
+	}
+
+	utils.WriteApplicationJSON(w, http.StatusOK, points)
+}
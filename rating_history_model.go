@@ -0,0 +1,87 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ratingReasonMatch рейтинг изменился после рейтингового матча
+	ratingReasonMatch = "match"
+	// ratingReasonVerification версия бота прошла проверку
+	ratingReasonVerification = "verification"
+	// ratingReasonDecay рейтинг затух, потому что бот давно не играл
+	ratingReasonDecay = "decay"
+)
+
+// RatingHistoryAccessObject DAO for RatingHistory model
+type RatingHistoryAccessObject interface {
+	GetRatingHistory(botID int64, daily bool, limit int64) ([]*RatingHistoryModel, error)
+}
+
+// RatingHistoryObject implementation of RatingHistoryAccessObject
+type RatingHistoryObject struct{}
+
+// RatingHistory объект для обращения с моделью rating_history
+var RatingHistory RatingHistoryAccessObject
+
+func init() {
+	RatingHistory = &RatingHistoryObject{}
+}
+
+// RatingHistoryModel model for rating_history table
+type RatingHistoryModel struct {
+	BotID     int64
+	MatchID   sql.NullInt64
+	Version   int64
+	Score     float64
+	Deviation float64
+	Reason    string
+	Time      time.Time
+}
+
+// insertRatingHistory запись точки истории рейтинга в транзакции, которая меняет рейтинг
+func insertRatingHistory(tx *sql.Tx, h *RatingHistoryModel) error {
+	_, err := tx.Exec(`INSERT INTO rating_history (bot_id, match_id, version, score, score_deviation, reason)
+		VALUES ($1, $2, $3, $4, $5, $6);`, h.BotID, h.MatchID, h.Version, h.Score, h.Deviation, h.Reason)
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not insert rating history row: %v", err)
+	}
+
+	return nil
+}
+
+// GetRatingHistory последние limit точек истории рейтинга бота в хронологическом порядке.
+// Если daily, то от каждого дня остаётся только последняя точка
+func (o *RatingHistoryObject) GetRatingHistory(botID int64, daily bool, limit int64) ([]*RatingHistoryModel, error) {
+	inner := `SELECT h.bot_id, h.match_id, h.version, h.score, h.score_deviation, h.reason, h.time
+		FROM rating_history h WHERE h.bot_id = $1 ORDER BY h.time DESC LIMIT $2`
+	if daily {
+		inner = `SELECT DISTINCT ON (date_trunc('day', h.time))
+		h.bot_id, h.match_id, h.version, h.score, h.score_deviation, h.reason, h.time
+		FROM rating_history h WHERE h.bot_id = $1
+		ORDER BY date_trunc('day', h.time) DESC, h.time DESC LIMIT $2`
+	}
+
+	rows, err := pqConn.Query(`SELECT p.bot_id, p.match_id, p.version, p.score, p.score_deviation, p.reason, p.time
+		FROM (`+inner+`) p ORDER BY p.time;`, botID, limit)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "get rating history error: %v", err)
+	}
+	defer rows.Close()
+
+	history := make([]*RatingHistoryModel, 0)
+	for rows.Next() {
+		h := &RatingHistoryModel{}
+		err = rows.Scan(&h.BotID, &h.MatchID, &h.Version, &h.Score, &h.Deviation, &h.Reason, &h.Time)
+		if err != nil {
+			return nil, errors.Wrapf(utils.ErrInternal, "get rating history scan error: %v", err)
+		}
+		history = append(history, h)
+	}
+
+	return history, nil
+}
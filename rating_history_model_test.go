@@ -0,0 +1,47 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestGetRatingHistoryDaily(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	day := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("DISTINCT ON").
+		WithArgs(1, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"bot_id", "match_id", "version", "score", "score_deviation",
+			"reason", "time"}).
+			AddRow(1, nil, 1, 400.0, 350.0, "verification", day).
+			AddRow(1, 5, 1, 415.5, 300.0, "match", day.AddDate(0, 0, 1)))
+
+	pqConn = db
+	RatingHistory = &RatingHistoryObject{}
+
+	history, err := RatingHistory.GetRatingHistory(1, true, 10)
+	if err != nil {
+		t.Errorf("TestGetRatingHistoryDaily got unexpected error: %v", err)
+	}
+
+	expected := []*RatingHistoryModel{
+		{BotID: 1, Version: 1, Score: 400, Deviation: 350, Reason: "verification", Time: day},
+		{BotID: 1, MatchID: sql.NullInt64{Int64: 5, Valid: true}, Version: 1, Score: 415.5, Deviation: 300,
+			Reason: "match", Time: day.AddDate(0, 0, 1)},
+	}
+	if !reflect.DeepEqual(history, expected) {
+		t.Errorf("TestGetRatingHistoryDaily got unexpected result: %v; expected: %v", history, expected)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestGetRatingHistoryDaily there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEloRate(t *testing.T) {
+	rs, err := newRatingSystem(&RatingConfig{System: ratingSystemElo, K: 32})
+	if err != nil {
+		t.Fatalf("TestEloRate got unexpected error: %v", err)
+	}
+
+	r1, r2 := rs.Rate(Rating{Score: 400}, Rating{Score: 400}, 1)
+	if r1.Score != 416 || r2.Score != 384 {
+		t.Errorf("TestEloRate got unexpected scores: %f, %f, expected: 416, 384", r1.Score, r2.Score)
+	}
+
+	r1, r2 = rs.Rate(Rating{Score: 400}, Rating{Score: 400}, 0)
+	if r1.Score != 400 || r2.Score != 400 {
+		t.Errorf("TestEloRate draw changed equal scores: %f, %f", r1.Score, r2.Score)
+	}
+}
+
+func TestTrueSkillRate(t *testing.T) {
+	rs, err := newRatingSystem(&RatingConfig{System: ratingSystemTrueSkill, Initial: 25, Deviation: 25.0 / 3})
+	if err != nil {
+		t.Fatalf("TestTrueSkillRate got unexpected error: %v", err)
+	}
+
+	init := rs.Initial()
+	r1, r2 := rs.Rate(init, init, 2)
+	if r2.Score <= init.Score || r1.Score >= init.Score {
+		t.Errorf("TestTrueSkillRate winner did not gain: %+v, %+v", r1, r2)
+	}
+	if math.Abs((r2.Score-init.Score)-(init.Score-r1.Score)) > 1e-9 {
+		t.Errorf("TestTrueSkillRate got asymmetric update: %+v, %+v", r1, r2)
+	}
+	if r1.Deviation >= init.Deviation || r2.Deviation >= init.Deviation {
+		t.Errorf("TestTrueSkillRate deviation did not shrink: %+v, %+v", r1, r2)
+	}
+
+	// ничья с более сильным ботом -- успех для слабого
+	weak, strong := rs.Rate(Rating{Score: 20, Deviation: 3}, Rating{Score: 30, Deviation: 3}, 0)
+	if weak.Score <= 20 || strong.Score >= 30 {
+		t.Errorf("TestTrueSkillRate draw moved scores the wrong way: %+v, %+v", weak, strong)
+	}
+}
+
+func TestNewRatingSystemInvalid(t *testing.T) {
+	configs := []*RatingConfig{
+		{System: "chess"},
+		{System: ratingSystemElo, K: -1},
+		{System: ratingSystemTrueSkill, DrawProbability: 1},
+	}
+	for _, config := range configs {
+		if _, err := newRatingSystem(config); err == nil {
+			t.Errorf("TestNewRatingSystemInvalid expected error for %+v", config)
+		}
+	}
+}
+
+func TestRateMultiTwoPlayersMatchesRate(t *testing.T) {
+	r1, r2 := Rating{Score: 500, Deviation: 100, Volatility: 0.06}, Rating{Score: 450, Deviation: 200, Volatility: 0.06}
+	e1, e2 := defaultRatingSystem.Rate(r1, r2, 2)
+
+	got := rateMulti(defaultRatingSystem, []Rating{r1, r2}, []int{2, 1})
+	if got[0] != e1 || got[1] != e2 {
+		t.Errorf("TestRateMultiTwoPlayersMatchesRate got %+v, expected %+v, %+v", got, e1, e2)
+	}
+}
+
+func TestRateMultiPlacements(t *testing.T) {
+	system := &eloSystem{k: 40, initial: 400}
+	r := Rating{Score: 400}
+
+	got := rateMulti(system, []Rating{r, r, r, r}, []int{3, 1, 2, 3})
+	if !(got[1].Score > got[2].Score && got[2].Score > got[0].Score) {
+		t.Errorf("TestRateMultiPlacements ratings do not follow placements: %+v", got)
+	}
+	if got[0] != got[3] {
+		t.Errorf("TestRateMultiPlacements equal placements got different ratings: %+v, %+v", got[0], got[3])
+	}
+
+	sum := 0.0
+	for _, rating := range got {
+		sum += rating.Score - r.Score
+	}
+	if math.Abs(sum) > 1e-9 {
+		t.Errorf("TestRateMultiPlacements Elo is not zero-sum: %f", sum)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/HotCodeGroup/warscript-utils/models"
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/pkg/errors"
+)
+
+// seasonCarryOver доля отрыва от среднего, которая по умолчанию переходит в новый сезон
+const seasonCarryOver = 0.5
+
+func newSeason(s *SeasonModel) *Season {
+	season := &Season{
+		GameSlug:  s.GameSlug,
+		Number:    s.Number,
+		StartedAt: s.StartedAt,
+	}
+	if s.EndedAt.Valid {
+		endedAt := s.EndedAt.Time
+		season.EndedAt = &endedAt
+	}
+
+	return season
+}
+
+// CloseSeason закрытие текущего сезона игры с архивом итоговой таблицы
+// и мягким сбросом рейтингов. Служебная ручка
+func CloseSeason(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger(r, logger, "CloseSeason")
+	errWriter := utils.NewErrorResponseWriter(w, logger)
+
+	form := &SeasonClose{}
+	err := utils.DecodeBodyJSON(r.Body, form)
+	if err != nil {
+		errWriter.WriteWarn(http.StatusBadRequest, errors.Wrap(err, "decode body error"))
+		return
+	}
+
+	if err = form.Validate(); err != nil {
+		// уверены в преобразовании
+		errWriter.WriteValidationError(err.(*utils.ValidationError))
+		return
+	}
+
+	gameInfo, err := gamesGPRC.GetGameBySlug(context.Background(), &models.GameSlug{Slug: form.GameSlug})
+	if err != nil {
+		errWriter.WriteWarn(http.StatusNotFound, errors.Wrap(err, "can not get game"))
+		return
+	}
+
+	carryOver := seasonCarryOver
+	if form.CarryOver != nil {
+		carryOver = *form.CarryOver
+	}
+
+	season, err := Seasons.CloseSeason(gameInfo.Slug, carryOver, ratingSystemFor(gameInfo.Slug).Initial())
+	if err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "close season method error"))
+		return
+	}
+	logger.Infof("season %d of %s is closed", season.Number, season.GameSlug)
+
+	utils.WriteApplicationJSON(w, http.StatusOK, newSeason(season))
+}
+
+// GetSeasons список сезонов игры
+func GetSeasons(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger(r, logger, "GetSeasons")
+	errWriter := utils.NewErrorResponseWriter(w, logger)
+
+	gameSlug := r.URL.Query().Get("game_slug")
+	if gameSlug == "" {
+		errWriter.WriteValidationError(&utils.ValidationError{
+			"game_slug": utils.ErrInvalid.Error(),
+		})
+		return
+	}
+
+	seasons, err := Seasons.GetSeasons(gameSlug)
+	if err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get seasons method error"))
+		return
+	}
+
+	respSeasons := make([]*Season, len(seasons))
+	for i, s := range seasons {
+		respSeasons[i] = newSeason(s)
+	}
+
+	utils.WriteApplicationJSON(w, http.StatusOK, respSeasons)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// ratingReasonSeasonReset рейтинг сдвинут к среднему при закрытии сезона
+const ratingReasonSeasonReset = "season_reset"
+
+// SeasonAccessObject DAO for Season model
+type SeasonAccessObject interface {
+	CloseSeason(game string, carryOver float64, initial Rating) (*SeasonModel, error)
+	GetSeason(game string, number int64) (*SeasonModel, error)
+	GetSeasons(game string) ([]*SeasonModel, error)
+	GetStandings(game string, number, authorID, limit, since int64) ([]*SeasonStandingModel, error)
+}
+
+// SeasonObject implementation of SeasonAccessObject
+type SeasonObject struct{}
+
+// Seasons объект для обращения с моделью season
+var Seasons SeasonAccessObject
+
+func init() {
+	Seasons = &SeasonObject{}
+}
+
+// SeasonModel model for seasons table
+type SeasonModel struct {
+	ID        int64
+	GameSlug  string
+	Number    int64
+	StartedAt time.Time
+	EndedAt   pq.NullTime
+}
+
+// SeasonStandingModel model for season_standings table.
+// В Bot рейтинг и статистика на момент закрытия сезона
+type SeasonStandingModel struct {
+	Rank int64
+	Bot  *BotModel
+}
+
+// CloseSeason закрытие текущего сезона игры: итоговые места сохраняются в архив,
+// рейтинги сдвигаются к среднему так, что от отклонения остаётся доля carryOver,
+// а отклонение рейтинга возвращается к начальному в той же пропорции.
+// Если сезонов у игры ещё не было, закрывается первый
+func (o *SeasonObject) CloseSeason(game string, carryOver float64, initial Rating) (*SeasonModel, error) {
+	tx, err := pqConn.Begin()
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "can not open season close transaction: %s", err.Error())
+	}
+	//nolint: errcheck
+	defer tx.Rollback()
+
+	s := &SeasonModel{}
+	row := tx.QueryRow(`SELECT s.id, s.game_slug, s.number, s.started_at FROM seasons s
+		WHERE s.game_slug = $1 AND s.ended_at IS NULL FOR UPDATE;`, game)
+	err = row.Scan(&s.ID, &s.GameSlug, &s.Number, &s.StartedAt)
+	if err == sql.ErrNoRows {
+		row = tx.QueryRow(`INSERT INTO seasons (game_slug, number, started_at)
+			SELECT $1, COALESCE(MAX(s.number), 0) + 1,
+			COALESCE((SELECT MIN(m.time) FROM matches m WHERE m.game_slug = $1), now())
+			FROM seasons s WHERE s.game_slug = $1
+			RETURNING id, game_slug, number, started_at;`, game)
+		err = row.Scan(&s.ID, &s.GameSlug, &s.Number, &s.StartedAt)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "can not get current season: %v", err)
+	}
+
+	row = tx.QueryRow(`UPDATE seasons SET ended_at = now() WHERE id = $1 RETURNING ended_at;`, s.ID)
+	if err = row.Scan(&s.EndedAt); err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "can not close season: %v", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO season_standings (season_id, bot_id, author_id, version, rank,
+		score, score_deviation, games_played, wins, losses, draws)
+		SELECT $1, b.id, b.author_id, b.version, rank() OVER (ORDER BY b.score DESC),
+		b.score, b.score_deviation, b.games_played, b.wins, b.losses, b.draws
+		FROM bots b WHERE b.game_slug = $2 AND b.is_active = true AND b.is_verified = true
+		AND b.is_archived = false;`, s.ID, game)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "can not save season standings: %v", err)
+	}
+
+	_, err = tx.Exec(`UPDATE bots b SET score = m.mean + (b.score - m.mean) * $2,
+		score_deviation = b.score_deviation + ($3 - b.score_deviation) * (1 - $2)
+		FROM (SELECT AVG(o.score) AS mean FROM bots o
+			WHERE o.game_slug = $1 AND o.is_verified = true AND o.is_archived = false) m
+		WHERE b.game_slug = $1 AND b.is_verified = true AND b.is_archived = false;`,
+		game, carryOver, initial.Deviation)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "can not reset ratings: %v", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO rating_history (bot_id, version, score, score_deviation, reason)
+		SELECT b.id, b.version, b.score, b.score_deviation, $2 FROM bots b
+		WHERE b.game_slug = $1 AND b.is_verified = true AND b.is_archived = false;`,
+		game, ratingReasonSeasonReset)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "can not insert rating history rows: %v", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO seasons (game_slug, number) VALUES ($1, $2);`, s.GameSlug, s.Number+1)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "can not open next season: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "can not commit season close transaction: %v", err)
+	}
+
+	return s, nil
+}
+
+// GetSeason получение сезона игры по номеру
+func (o *SeasonObject) GetSeason(game string, number int64) (*SeasonModel, error) {
+	row := pqConn.QueryRow(`SELECT s.id, s.game_slug, s.number, s.started_at, s.ended_at FROM seasons s
+		WHERE s.game_slug = $1 AND s.number = $2;`, game, number)
+
+	s := &SeasonModel{}
+	if err := row.Scan(&s.ID, &s.GameSlug, &s.Number, &s.StartedAt, &s.EndedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.Wrapf(utils.ErrNotExists, "season does not exist: %v", err)
+		}
+
+		return nil, errors.Wrapf(utils.ErrInternal, "can not get season: %v", err)
+	}
+
+	return s, nil
+}
+
+// GetSeasons список сезонов игры, начиная с последнего
+func (o *SeasonObject) GetSeasons(game string) ([]*SeasonModel, error) {
+	rows, err := pqConn.Query(`SELECT s.id, s.game_slug, s.number, s.started_at, s.ended_at FROM seasons s
+		WHERE s.game_slug = $1 ORDER BY s.number DESC;`, game)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "get seasons error: %v", err)
+	}
+	defer rows.Close()
+
+	seasons := make([]*SeasonModel, 0)
+	for rows.Next() {
+		s := &SeasonModel{}
+		if err = rows.Scan(&s.ID, &s.GameSlug, &s.Number, &s.StartedAt, &s.EndedAt); err != nil {
+			return nil, errors.Wrapf(utils.ErrInternal, "get seasons scan error: %v", err)
+		}
+		seasons = append(seasons, s)
+	}
+
+	return seasons, nil
+}
+
+// GetStandings итоговая таблица закрытого сезона, при authorID > 0 -- только боты автора
+func (o *SeasonObject) GetStandings(game string, number, authorID, limit, since int64) ([]*SeasonStandingModel, error) {
+	args := []interface{}{game, number, limit, since}
+	query := `SELECT st.rank, b.id, b.author_id, b.game_slug, b.is_active, b.is_verified, b.is_archived,
+	st.version, st.score, st.score_deviation, st.games_played, st.wins, st.losses, st.draws
+	FROM season_standings st JOIN seasons s ON s.id = st.season_id JOIN bots b ON b.id = st.bot_id
+	WHERE s.game_slug = $1 AND s.number = $2`
+	if authorID > 0 {
+		query += ` AND st.author_id = $5`
+		args = append(args, authorID)
+	}
+	query += ` ORDER BY st.rank, b.id LIMIT $3 OFFSET $4;`
+
+	rows, err := pqConn.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "get season standings error: %v", err)
+	}
+	defer rows.Close()
+
+	standings := make([]*SeasonStandingModel, 0)
+	for rows.Next() {
+		st := &SeasonStandingModel{Bot: &BotModel{}}
+		err = rows.Scan(&st.Rank, &st.Bot.ID, &st.Bot.AuthorID, &st.Bot.GameSlug, &st.Bot.IsActive,
+			&st.Bot.IsVerified, &st.Bot.IsArchived, &st.Bot.Version, &st.Bot.Score, &st.Bot.Deviation,
+			&st.Bot.GamesPlayed, &st.Bot.Wins, &st.Bot.Losses, &st.Bot.Draws)
+		if err != nil {
+			return nil, errors.Wrapf(utils.ErrInternal, "get season standings scan error: %v", err)
+		}
+		standings = append(standings, st)
+	}
+
+	return standings, nil
+}
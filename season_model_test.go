@@ -0,0 +1,87 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/pkg/errors"
+)
+
+func TestCloseSeasonFirst(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	started := time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)
+	ended := started.AddDate(0, 1, 0)
+
+	// сезонов ещё не было -- закрываем первый
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM seasons").
+		WithArgs("pong").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("INSERT INTO seasons").
+		WithArgs("pong").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "game_slug", "number", "started_at"}).
+			AddRow(1, "pong", 1, started))
+	mock.ExpectQuery("UPDATE seasons").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"ended_at"}).AddRow(ended))
+	mock.ExpectExec("INSERT INTO season_standings").
+		WithArgs(1, "pong").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("UPDATE bots").
+		WithArgs("pong", 0.5, 350.0).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("INSERT INTO rating_history").
+		WithArgs("pong", "season_reset").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("INSERT INTO seasons").
+		WithArgs("pong", 2).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	pqConn = db
+	Seasons = &SeasonObject{}
+
+	season, err := Seasons.CloseSeason("pong", 0.5, Rating{Score: 400, Deviation: 350})
+	if err != nil {
+		t.Errorf("TestCloseSeasonFirst got unexpected error: %v", err)
+	}
+
+	if season.Number != 1 || !season.EndedAt.Valid || !season.EndedAt.Time.Equal(ended) {
+		t.Errorf("TestCloseSeasonFirst got unexpected season: %+v", season)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestCloseSeasonFirst there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetSeasonNotExists(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM seasons").
+		WithArgs("pong", 5).
+		WillReturnError(sql.ErrNoRows)
+
+	pqConn = db
+	Seasons = &SeasonObject{}
+
+	if _, err = Seasons.GetSeason("pong", 5); errors.Cause(err) != utils.ErrNotExists {
+		t.Errorf("TestGetSeasonNotExists got unexpected error: %v, expected: %v", err, utils.ErrNotExists)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestGetSeasonNotExists there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultSimilarityThreshold с какого сходства пара ботов попадает в отчёт
+	defaultSimilarityThreshold = 0.8
+	// similarityMinFingerprints слишком короткий код похож на всё подряд и не сравнивается
+	similarityMinFingerprints = 10
+)
+
+var similarityReports = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "similarity_reports_total",
+	Help: "Number of suspiciously similar bot pairs found",
+}, []string{"game"})
+
+func init() {
+	prometheus.MustRegister(similarityReports)
+}
+
+// similarityThresholdFor порог сходства, выбранный для игры
+func similarityThresholdFor(gameSlug string) float64 {
+	if games != nil {
+		if game, ok := games.Get(gameSlug); ok && game.SimilarityThreshold > 0 {
+			return game.SimilarityThreshold
+		}
+	}
+
+	return defaultSimilarityThreshold
+}
+
+// checkSimilarity сохраняет отпечаток текущего кода бота и сравнивает его с ботами
+// других авторов той же игры. Вызывается, когда код бота меняется: при создании,
+// после проверки новой версии и при откате. Пары со сходством выше порога попадают
+// в отчёт для модераторов; смену кода проверка не блокирует
+func checkSimilarity(bot *BotModel) {
+	logger := logger.WithFields(logrus.Fields{
+		"bot_id": bot.ID,
+		"method": "checkSimilarity",
+	})
+
+	fp := fingerprint(Lang(bot.Language), bot.Code)
+	if err := Similarity.SetFingerprints(bot.ID, fp); err != nil {
+		logger.Error(errors.Wrap(err, "can not save bot fingerprints"))
+	}
+	if len(fp) < similarityMinFingerprints {
+		return
+	}
+
+	candidates, err := Similarity.GetCandidates(bot)
+	if err != nil {
+		logger.Error(errors.Wrap(err, "can not get similarity candidates"))
+		return
+	}
+
+	threshold := similarityThresholdFor(bot.GameSlug)
+	reports := make([]*SimilarityReportModel, 0)
+	for _, c := range candidates {
+		// отпечатки ботов, созданных до проверки или сменивших версию, считаем на месте
+		if len(c.Fingerprints) == 0 {
+			c.Fingerprints = fingerprint(Lang(c.Language), c.Code)
+			if err = Similarity.SetFingerprints(c.BotID, c.Fingerprints); err != nil {
+				logger.Error(errors.Wrap(err, "can not save candidate fingerprints"))
+			}
+		}
+		if len(c.Fingerprints) < similarityMinFingerprints {
+			continue
+		}
+
+		if s := similarity(fp, c.Fingerprints); s >= threshold {
+			reports = append(reports, &SimilarityReportModel{
+				GameSlug:   bot.GameSlug,
+				BotID:      bot.ID,
+				OtherBotID: c.BotID,
+				Similarity: s,
+			})
+		}
+	}
+	if len(reports) == 0 {
+		return
+	}
+
+	if err = Similarity.SaveReports(reports); err != nil {
+		logger.Error(errors.Wrap(err, "can not save similarity reports"))
+		return
+	}
+	similarityReports.WithLabelValues(bot.GameSlug).Add(float64(len(reports)))
+	logger.Warnf("bot is similar to %d bots of other authors", len(reports))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/pkg/errors"
+)
+
+func newSimilarityReport(r *SimilarityReportModel, authors map[int64]*AuthorInfo) *SimilarityReport {
+	return &SimilarityReport{
+		ID:          r.ID,
+		GameSlug:    r.GameSlug,
+		BotID:       r.BotID,
+		Author:      authors[r.AuthorID],
+		OtherBotID:  r.OtherBotID,
+		OtherAuthor: authors[r.OtherAuthorID],
+		Similarity:  r.Similarity,
+		Created:     r.Created,
+	}
+}
+
+// GetSimilarityReports список подозрительно похожих пар ботов для модераторов.
+// Служебная ручка
+func GetSimilarityReports(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger(r, logger, "GetSimilarityReports")
+	errWriter := utils.NewErrorResponseWriter(w, logger)
+
+	limit, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+	if err != nil {
+		limit = 10
+	}
+	since, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	if err != nil {
+		since = 0
+	}
+	minSimilarity, err := strconv.ParseFloat(r.URL.Query().Get("min_similarity"), 64)
+	if err != nil {
+		minSimilarity = 0
+	}
+
+	reports, err := Similarity.GetReports(r.URL.Query().Get("game_slug"), minSimilarity, limit, since)
+	if err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get similarity reports method error"))
+		return
+	}
+
+	resp := make([]*SimilarityReport, len(reports))
+	if len(reports) == 0 {
+		utils.WriteApplicationJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	ids := make([]int64, 0, 2*len(reports))
+	for _, rep := range reports {
+		ids = append(ids, rep.AuthorID, rep.OtherAuthorID)
+	}
+	authors, err := getAuthors(ids)
+	if err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "can not get authors"))
+		return
+	}
+
+	for i, rep := range reports {
+		resp[i] = newSimilarityReport(rep, authors)
+	}
+
+	utils.WriteApplicationJSON(w, http.StatusOK, resp)
+}
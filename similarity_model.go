@@ -0,0 +1,136 @@
+package main
+
+import (
+	"time"
+
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// SimilarityAccessObject DAO for SimilarityReport model
+type SimilarityAccessObject interface {
+	SetFingerprints(botID int64, fingerprints []int64) error
+	GetCandidates(b *BotModel) ([]*BotFingerprintModel, error)
+	SaveReports(reports []*SimilarityReportModel) error
+	GetReports(game string, minSimilarity float64, limit, since int64) ([]*SimilarityReportModel, error)
+}
+
+// SimilarityObject implementation of SimilarityAccessObject
+type SimilarityObject struct{}
+
+// Similarity объект для обращения с отпечатками кода и отчётами о похожих ботах
+var Similarity SimilarityAccessObject
+
+func init() {
+	Similarity = &SimilarityObject{}
+}
+
+// BotFingerprintModel код бота и его отпечаток; пустой отпечаток ещё не посчитан
+type BotFingerprintModel struct {
+	BotID        int64
+	AuthorID     int64
+	Language     string
+	Code         string
+	Fingerprints pq.Int64Array
+}
+
+// SimilarityReportModel model for similarity_reports table.
+// BotID -- новый бот, OtherBotID -- похожий на него бот другого автора
+type SimilarityReportModel struct {
+	ID            int64
+	GameSlug      string
+	BotID         int64
+	AuthorID      int64
+	OtherBotID    int64
+	OtherAuthorID int64
+	Similarity    float64
+	Created       time.Time
+}
+
+// SetFingerprints сохранение отпечатка текущего кода бота
+func (o *SimilarityObject) SetFingerprints(botID int64, fingerprints []int64) error {
+	_, err := pqConn.Exec(`UPDATE bots SET fingerprints = $1 WHERE bots.id = $2;`,
+		pq.Int64Array(fingerprints), botID)
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not set bot fingerprints: %v", err)
+	}
+
+	return nil
+}
+
+// GetCandidates боты других авторов той же игры и языка, с которыми сравнивается бот.
+// Архивные боты тоже сравниваются: код из архива можно скопировать так же
+func (o *SimilarityObject) GetCandidates(b *BotModel) ([]*BotFingerprintModel, error) {
+	rows, err := pqConn.Query(`SELECT b.id, b.author_id, b.language, b.code, coalesce(b.fingerprints, '{}')
+		FROM bots b WHERE b.game_slug = $1 AND b.language = $2 AND b.author_id <> $3 ORDER BY b.id;`,
+		b.GameSlug, b.Language, b.AuthorID)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "get similarity candidates error: %v", err)
+	}
+	defer rows.Close()
+
+	candidates := make([]*BotFingerprintModel, 0)
+	for rows.Next() {
+		c := &BotFingerprintModel{}
+		if err = rows.Scan(&c.BotID, &c.AuthorID, &c.Language, &c.Code, &c.Fingerprints); err != nil {
+			return nil, errors.Wrapf(utils.ErrInternal, "get similarity candidates scan error: %v", err)
+		}
+		candidates = append(candidates, c)
+	}
+
+	return candidates, nil
+}
+
+// SaveReports сохранение найденных пар похожих ботов. Повторная пара обновляет сходство
+func (o *SimilarityObject) SaveReports(reports []*SimilarityReportModel) error {
+	tx, err := pqConn.Begin()
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not open similarity reports transaction: %s", err.Error())
+	}
+	//nolint: errcheck
+	defer tx.Rollback()
+
+	for _, r := range reports {
+		_, err = tx.Exec(`INSERT INTO similarity_reports (game_slug, bot_id, other_bot_id, similarity)
+			VALUES ($1, $2, $3, $4) ON CONFLICT (bot_id, other_bot_id)
+			DO UPDATE SET similarity = EXCLUDED.similarity, created = now();`,
+			r.GameSlug, r.BotID, r.OtherBotID, r.Similarity)
+		if err != nil {
+			return errors.Wrapf(utils.ErrInternal, "can not insert similarity report: %v", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not commit similarity reports transaction: %v", err)
+	}
+
+	return nil
+}
+
+// GetReports пары похожих ботов со сходством не ниже minSimilarity, самые похожие первыми
+func (o *SimilarityObject) GetReports(game string, minSimilarity float64,
+	limit, since int64) ([]*SimilarityReportModel, error) {
+	rows, err := pqConn.Query(`SELECT r.id, r.game_slug, r.bot_id, b.author_id, r.other_bot_id, ob.author_id,
+		r.similarity, r.created FROM similarity_reports r
+		JOIN bots b ON b.id = r.bot_id JOIN bots ob ON ob.id = r.other_bot_id
+		WHERE ($1 = '' OR r.game_slug = $1) AND r.similarity >= $2
+		ORDER BY r.similarity DESC, r.id DESC LIMIT $3 OFFSET $4;`, game, minSimilarity, limit, since)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "get similarity reports error: %v", err)
+	}
+	defer rows.Close()
+
+	reports := make([]*SimilarityReportModel, 0)
+	for rows.Next() {
+		r := &SimilarityReportModel{}
+		if err = rows.Scan(&r.ID, &r.GameSlug, &r.BotID, &r.AuthorID, &r.OtherBotID, &r.OtherAuthorID,
+			&r.Similarity, &r.Created); err != nil {
+			return nil, errors.Wrapf(utils.ErrInternal, "get similarity reports scan error: %v", err)
+		}
+		reports = append(reports, r)
+	}
+
+	return reports, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/pkg/errors"
+)
+
+func TestGetCandidatesOK(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT").
+		WithArgs("pong", "JS", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "author_id", "language", "code", "fingerprints"}).
+			AddRow(2, 3, "JS", "a=5;", "{10,20}").
+			AddRow(4, 5, "JS", "b=6;", "{}"))
+
+	pqConn = db
+	Similarity = &SimilarityObject{}
+
+	candidates, err := Similarity.GetCandidates(&BotModel{ID: 1, AuthorID: 1, GameSlug: "pong", Language: "JS"})
+	if err != nil {
+		t.Fatalf("TestGetCandidatesOK got unexpected error: %v", err)
+	}
+
+	if len(candidates) != 2 || len(candidates[0].Fingerprints) != 2 || len(candidates[1].Fingerprints) != 0 {
+		t.Errorf("TestGetCandidatesOK got unexpected result: %+v", candidates)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestGetCandidatesOK there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSaveReportsOK(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO similarity_reports").
+		WithArgs("pong", 1, 2, 0.9).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	pqConn = db
+	Similarity = &SimilarityObject{}
+
+	err = Similarity.SaveReports([]*SimilarityReportModel{{GameSlug: "pong", BotID: 1, OtherBotID: 2, Similarity: 0.9}})
+	if err != nil {
+		t.Errorf("TestSaveReportsOK got unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestSaveReportsOK there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetReportsInternal(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT").
+		WithArgs("", 0.5, 10, 0).
+		WillReturnError(sql.ErrConnDone)
+
+	pqConn = db
+	Similarity = &SimilarityObject{}
+
+	_, err = Similarity.GetReports("", 0.5, 10, 0)
+	if errors.Cause(err) != utils.ErrInternal {
+		t.Errorf("TestGetReportsInternal got unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestGetReportsInternal there were unfulfilled expectations: %s", err)
+	}
+}
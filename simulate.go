@@ -0,0 +1,456 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// simulationConfig параметры прогона матчмейкинга без тестеров
+type simulationConfig struct {
+	GameSlug string
+	Cycles   int
+	// CycleDuration модельное время одного цикла матчмейкинга
+	CycleDuration time.Duration
+	MaxPairs      int
+	MinDailyGames int64
+	// Players сколько ботов играет в одном матче, как GameConfig.Players
+	Players int
+	// RematchCooldown модельное время, в течение которого пара не играет повторно
+	RematchCooldown time.Duration
+	// DrawProbability вероятность ничьей в синтетической модели исходов
+	DrawProbability float64
+	Rating          *RatingConfig
+	Seed            int64
+}
+
+// simulationBot бот модельной популяции. Skill -- настоящая сила бота,
+// которую рейтинг должен восстановить
+type simulationBot struct {
+	ID       int64   `json:"id"`
+	AuthorID int64   `json:"author_id"`
+	Skill    float64 `json:"skill"`
+	Score    float64 `json:"score"`
+}
+
+// simulationCheckpoint состояние рейтинга после очередного цикла
+type simulationCheckpoint struct {
+	Cycle int `json:"cycle"`
+	// RankCorrelation корреляция Спирмена между очками и настоящей силой
+	RankCorrelation float64 `json:"rank_correlation"`
+	// MeanDeviation среднее отклонение рейтинга по популяции
+	MeanDeviation float64 `json:"mean_deviation"`
+}
+
+// simulationReport итоги прогона
+type simulationReport struct {
+	Bots            int                     `json:"bots"`
+	Cycles          int                     `json:"cycles"`
+	Matches         int                     `json:"matches"`
+	Checkpoints     []*simulationCheckpoint `json:"checkpoints"`
+	GamesMin        int64                   `json:"games_min"`
+	GamesMedian     int64                   `json:"games_median"`
+	GamesMax        int64                   `json:"games_max"`
+	ScoreDiffMedian float64                 `json:"score_diff_median"`
+	ScoreDiffP90    float64                 `json:"score_diff_p90"`
+	SameAuthorSkips int                     `json:"same_author_skips"`
+	RematchSkips    int                     `json:"rematch_skips"`
+	UnpairedAverage float64                 `json:"unpaired_average"`
+}
+
+type simulationMatch struct {
+	bots []int64
+	at   time.Time
+}
+
+// runSimulationCommand подкоманда simulate: популяция ботов из JSON-фикстуры
+// или из базы, исход матчей по синтетической модели вместо тестеров
+func runSimulationCommand(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	fixture := fs.String("fixture", "", "JSON file with bots: [{\"id\", \"author_id\", \"skill\", \"score\"}]")
+	dsn := fs.String("db", "", "postgres connection string to take a snapshot of active bots from")
+	config := &simulationConfig{}
+	fs.StringVar(&config.GameSlug, "game", "simulation", "game slug")
+	fs.IntVar(&config.Cycles, "cycles", 1000, "number of matchmaking cycles")
+	fs.DurationVar(&config.CycleDuration, "cycle", time.Minute, "model time of one cycle")
+	fs.IntVar(&config.MaxPairs, "max-pairs", 0, "pairs per cycle, 0 means unlimited")
+	fs.Int64Var(&config.MinDailyGames, "min-daily", defaultMinDailyGames, "guaranteed games per bot per day")
+	fs.IntVar(&config.Players, "players", 2, "bots per match, as in games config")
+	fs.DurationVar(&config.RematchCooldown, "cooldown", defaultRematchCooldown, "rematch cool-down")
+	fs.Float64Var(&config.DrawProbability, "draw", 0.1, "probability of a draw between equal bots")
+	fs.Int64Var(&config.Seed, "seed", time.Now().UnixNano(), "random seed")
+	rating := fs.String("rating", "", "rating config JSON, as in games config")
+	format := fs.String("format", "text", "report format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *rating != "" {
+		config.Rating = &RatingConfig{}
+		if err := json.Unmarshal([]byte(*rating), config.Rating); err != nil {
+			return errors.Wrap(err, "can not parse rating config")
+		}
+	}
+
+	var bots []*simulationBot
+	var err error
+	switch {
+	case *fixture != "":
+		bots, err = loadSimulationFixture(*fixture)
+	case *dsn != "":
+		bots, err = loadSimulationSnapshot(*dsn, config.GameSlug)
+	default:
+		return errors.New("either -fixture or -db is required")
+	}
+	if err != nil {
+		return err
+	}
+
+	report, err := simulate(config, bots)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	report.write(out)
+
+	return nil
+}
+
+func loadSimulationFixture(path string) ([]*simulationBot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not read fixture")
+	}
+
+	bots := make([]*simulationBot, 0)
+	if err = json.Unmarshal(data, &bots); err != nil {
+		return nil, errors.Wrap(err, "can not unmarshal fixture")
+	}
+
+	return bots, nil
+}
+
+// loadSimulationSnapshot активные боты игры из базы. Настоящая сила
+// неизвестна, за неё принимаются текущие очки
+func loadSimulationSnapshot(dsn, gameSlug string) ([]*simulationBot, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not connect to postgresql database")
+	}
+	defer db.Close()
+	pqConn = db
+
+	models, err := Bots.GetBotsForTesting(math.MaxInt32, gameSlug, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "can not get bots snapshot")
+	}
+
+	bots := make([]*simulationBot, len(models))
+	for i, b := range models {
+		bots[i] = &simulationBot{ID: b.ID, AuthorID: b.AuthorID, Skill: b.Score, Score: b.Score}
+	}
+
+	return bots, nil
+}
+
+// simulate прогон matchmaker.groupBots и системы рейтинга на модельной популяции.
+// Исход матча: логистическая модель Elo по настоящей силе ботов, плюс ничьи.
+// Рейтинг матча нескольких ботов пересчитывается так же, как в матчмейкинге, через rateMulti
+func simulate(config *simulationConfig, population []*simulationBot) (*simulationReport, error) {
+	players := (&GameConfig{Players: config.Players}).players()
+	if len(population) < players {
+		return nil, errors.Errorf("at least %d bots are required", players)
+	}
+
+	system, err := newRatingSystem(config.Rating)
+	if err != nil {
+		return nil, errors.Wrap(err, "bad rating config")
+	}
+	rnd := rand.New(rand.NewSource(config.Seed))
+	mm := newMatchmaker()
+
+	bots := make([]*BotModel, len(population))
+	skill := make(map[int64]float64, len(population))
+	for i, sb := range population {
+		r := system.Initial()
+		if sb.Score != 0 {
+			r.Score = sb.Score
+		}
+		bots[i] = &BotModel{
+			ID:         sb.ID,
+			AuthorID:   sb.AuthorID,
+			GameSlug:   config.GameSlug,
+			Score:      r.Score,
+			Deviation:  r.Deviation,
+			Volatility: r.Volatility,
+		}
+		skill[sb.ID] = sb.Skill
+	}
+
+	maxPairs := config.MaxPairs
+	if maxPairs <= 0 {
+		maxPairs = len(bots) / players
+	}
+
+	report := &simulationReport{Bots: len(bots), Cycles: config.Cycles}
+	checkpointEvery := config.Cycles / 10
+	if checkpointEvery == 0 {
+		checkpointEvery = 1
+	}
+
+	history := make([]simulationMatch, 0)
+	diffs := make([]float64, 0)
+	unpaired := 0
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	for cycle := 1; cycle <= config.Cycles; cycle++ {
+		now = now.Add(config.CycleDuration)
+
+		// из истории нужны только матчи за окно справедливости
+		for len(history) > 0 && now.Sub(history[0].at) > fairnessWindow {
+			history = history[1:]
+		}
+		recentGames := make(map[int64]int64, len(bots))
+		recentPairs := make(map[botPair]bool)
+		for _, m := range history {
+			for i, id := range m.bots {
+				recentGames[id]++
+				if now.Sub(m.at) >= config.RematchCooldown {
+					continue
+				}
+				for _, other := range m.bots[i+1:] {
+					recentPairs[newBotPair(id, other)] = true
+				}
+			}
+		}
+		for _, bot := range bots {
+			bot.RecentGames = recentGames[bot.ID]
+		}
+
+		groups, stats := mm.groupBots(config.GameSlug, bots, now, &pairingRules{
+			MaxPairs:      maxPairs,
+			MinDailyGames: config.MinDailyGames,
+			Recent:        recentPairs,
+		}, players)
+		report.SameAuthorSkips += stats.SameAuthorSkips
+		report.RematchSkips += stats.RematchSkips
+		unpaired += stats.Unpaired
+
+		played := make(map[int64]bool, players*len(groups))
+		for _, group := range groups {
+			ids := make([]int64, len(group.Bots))
+			skills := make([]float64, len(group.Bots))
+			ratings := make([]Rating, len(group.Bots))
+			minScore, maxScore := group.Bots[0].Score, group.Bots[0].Score
+			for i, bot := range group.Bots {
+				ids[i], skills[i], ratings[i] = bot.ID, skill[bot.ID], bot.Rating()
+				minScore, maxScore = math.Min(minScore, bot.Score), math.Max(maxScore, bot.Score)
+			}
+			diffs = append(diffs, maxScore-minScore)
+
+			placements := simulationPlacements(rnd, skills, config.DrawProbability)
+			newRatings := rateMulti(system, ratings, placements)
+			for i, bot := range group.Bots {
+				applySimulationResult(bot, newRatings[i], placements, i)
+				played[bot.ID] = true
+			}
+
+			history = append(history, simulationMatch{bots: ids, at: now})
+			report.Matches++
+		}
+
+		for _, bot := range bots {
+			if !played[bot.ID] {
+				r := system.Idle(bot.Rating())
+				bot.Score, bot.Deviation, bot.Volatility = r.Score, r.Deviation, r.Volatility
+			}
+		}
+
+		if cycle%checkpointEvery == 0 || cycle == config.Cycles {
+			report.Checkpoints = append(report.Checkpoints, simulationCheckpointOf(cycle, bots, skill))
+		}
+	}
+
+	games := make([]int64, len(bots))
+	for i, bot := range bots {
+		games[i] = bot.GamesPlayed
+	}
+	sort.Slice(games, func(i, j int) bool { return games[i] < games[j] })
+	report.GamesMin, report.GamesMedian, report.GamesMax = games[0], games[len(games)/2], games[len(games)-1]
+
+	if len(diffs) > 0 {
+		sort.Float64s(diffs)
+		report.ScoreDiffMedian = diffs[len(diffs)/2]
+		report.ScoreDiffP90 = diffs[len(diffs)*9/10]
+	}
+	report.UnpairedAverage = float64(unpaired) / float64(config.Cycles)
+
+	return report, nil
+}
+
+// simulationOutcome исход матча: 0 -- ничья, 1 или 2 -- номер победителя
+func simulationOutcome(rnd *rand.Rand, skill1, skill2, drawProbability float64) int {
+	if rnd.Float64() < drawProbability {
+		return 0
+	}
+
+	if rnd.Float64() < 1/(1+math.Pow(10, (skill2-skill1)/400)) {
+		return 1
+	}
+
+	return 2
+}
+
+// simulationPlacements места игроков матча: 1 -- лучшее. Для двоих -- simulationOutcome,
+// для большего числа места разыгрываются по очереди с весами по модели Elo,
+// а соседние места с вероятностью ничьей делятся
+func simulationPlacements(rnd *rand.Rand, skills []float64, drawProbability float64) []int {
+	if len(skills) == 2 {
+		switch simulationOutcome(rnd, skills[0], skills[1], drawProbability) {
+		case 1:
+			return []int{1, 2}
+		case 2:
+			return []int{2, 1}
+		}
+		return []int{1, 1}
+	}
+
+	left := make([]int, len(skills))
+	for i := range left {
+		left[i] = i
+	}
+	placements := make([]int, len(skills))
+	previous := 0
+	for place := 1; len(left) > 0; place++ {
+		total := 0.0
+		for _, i := range left {
+			total += math.Pow(10, skills[i]/400)
+		}
+		pick, x := len(left)-1, rnd.Float64()*total
+		for k, i := range left {
+			if x -= math.Pow(10, skills[i]/400); x < 0 {
+				pick = k
+				break
+			}
+		}
+
+		if previous == 0 || rnd.Float64() >= drawProbability {
+			previous = place
+		}
+		placements[left[pick]] = previous
+		left = append(left[:pick], left[pick+1:]...)
+	}
+
+	return placements
+}
+
+// applySimulationResult новый рейтинг и счётчики игр бота, игравшего i-м
+func applySimulationResult(bot *BotModel, r Rating, placements []int, i int) {
+	bot.Score, bot.Deviation, bot.Volatility = r.Score, r.Deviation, r.Volatility
+	bot.GamesPlayed++
+
+	participants := make([]*MatchParticipantModel, len(placements))
+	for j, p := range placements {
+		participants[j] = &MatchParticipantModel{Placement: sql.NullInt64{Int64: int64(p), Valid: true}}
+	}
+	wins, losses, draws := participantOutcome(participants, i)
+	bot.Wins += int64(wins)
+	bot.Losses += int64(losses)
+	bot.Draws += int64(draws)
+}
+
+func simulationCheckpointOf(cycle int, bots []*BotModel, skill map[int64]float64) *simulationCheckpoint {
+	scores := make([]float64, len(bots))
+	skills := make([]float64, len(bots))
+	deviation := 0.0
+	for i, bot := range bots {
+		scores[i], skills[i] = bot.Score, skill[bot.ID]
+		deviation += bot.Deviation
+	}
+
+	return &simulationCheckpoint{
+		Cycle:           cycle,
+		RankCorrelation: rankCorrelation(scores, skills),
+		MeanDeviation:   deviation / float64(len(bots)),
+	}
+}
+
+// rankCorrelation коэффициент корреляции Спирмена
+func rankCorrelation(x, y []float64) float64 {
+	rx, ry := ranks(x), ranks(y)
+	n := float64(len(x))
+	meanRank := (n - 1) / 2
+
+	var cov, vx, vy float64
+	for i := range rx {
+		dx, dy := rx[i]-meanRank, ry[i]-meanRank
+		cov += dx * dy
+		vx += dx * dx
+		vy += dy * dy
+	}
+	if vx == 0 || vy == 0 {
+		return 0
+	}
+
+	return cov / math.Sqrt(vx*vy)
+}
+
+// ranks ранги значений, равным значениям -- средний ранг
+func ranks(values []float64) []float64 {
+	idx := make([]int, len(values))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool { return values[idx[i]] < values[idx[j]] })
+
+	result := make([]float64, len(values))
+	for i := 0; i < len(idx); {
+		j := i
+		for j+1 < len(idx) && values[idx[j+1]] == values[idx[i]] {
+			j++
+		}
+		for k := i; k <= j; k++ {
+			result[idx[k]] = float64(i+j) / 2
+		}
+		i = j + 1
+	}
+
+	return result
+}
+
+func (r *simulationReport) write(w io.Writer) {
+	fmt.Fprintf(w, "bots: %d, cycles: %d, matches: %d\n", r.Bots, r.Cycles, r.Matches)
+	fmt.Fprintln(w, "convergence:")
+	for _, c := range r.Checkpoints {
+		fmt.Fprintf(w, "  cycle %6d: rank correlation %.3f, mean deviation %.1f\n",
+			c.Cycle, c.RankCorrelation, c.MeanDeviation)
+	}
+	fmt.Fprintf(w, "games per bot: min %d, median %d, max %d\n", r.GamesMin, r.GamesMedian, r.GamesMax)
+	fmt.Fprintf(w, "pair score diff: median %.0f, p90 %.0f\n", r.ScoreDiffMedian, r.ScoreDiffP90)
+	fmt.Fprintf(w, "same author skips: %d, rematch skips: %d, unpaired per cycle: %.1f\n",
+		r.SameAuthorSkips, r.RematchSkips, r.UnpairedAverage)
+}
+
+// runSimulation точка входа подкоманды simulate
+func runSimulation(args []string) int {
+	if err := runSimulationCommand(args, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "simulate: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
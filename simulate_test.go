@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimulateConverges(t *testing.T) {
+	population := make([]*simulationBot, 0, 20)
+	for i := int64(1); i <= 20; i++ {
+		// у первых двух авторов по два бота
+		population = append(population, &simulationBot{ID: i, AuthorID: (i + 1) / 2, Skill: 1000 + 50*float64(i)})
+	}
+
+	report, err := simulate(&simulationConfig{
+		GameSlug:        "pong",
+		Cycles:          300,
+		CycleDuration:   time.Minute,
+		MinDailyGames:   5,
+		RematchCooldown: 10 * time.Minute,
+		DrawProbability: 0.1,
+		Seed:            1,
+	}, population)
+	if err != nil {
+		t.Fatalf("TestSimulateConverges got unexpected error: %v", err)
+	}
+
+	if report.Matches == 0 || report.SameAuthorSkips == 0 {
+		t.Errorf("TestSimulateConverges got unexpected report: %+v", report)
+	}
+
+	last := report.Checkpoints[len(report.Checkpoints)-1]
+	if last.Cycle != 300 || last.RankCorrelation < 0.8 {
+		t.Errorf("TestSimulateConverges rating did not converge: %+v", last)
+	}
+}
+
+func TestRankCorrelation(t *testing.T) {
+	if c := rankCorrelation([]float64{1, 2, 3, 4}, []float64{10, 20, 30, 40}); c != 1 {
+		t.Errorf("TestRankCorrelation got %f for same order, expected 1", c)
+	}
+	if c := rankCorrelation([]float64{1, 2, 3, 4}, []float64{40, 30, 20, 10}); c != -1 {
+		t.Errorf("TestRankCorrelation got %f for reversed order, expected -1", c)
+	}
+}
+
+func TestSimulateThreePlayers(t *testing.T) {
+	population := make([]*simulationBot, 0, 12)
+	for i := int64(1); i <= 12; i++ {
+		population = append(population, &simulationBot{ID: i, AuthorID: i, Skill: 1000 + 50*float64(i)})
+	}
+
+	report, err := simulate(&simulationConfig{
+		GameSlug:        "ffa",
+		Cycles:          300,
+		CycleDuration:   time.Minute,
+		MinDailyGames:   5,
+		RematchCooldown: time.Minute,
+		Players:         3,
+		DrawProbability: 0.1,
+		Seed:            1,
+	}, population)
+	if err != nil {
+		t.Fatalf("TestSimulateThreePlayers got unexpected error: %v", err)
+	}
+
+	// за цикл не больше четырёх матчей по три бота
+	if report.Matches == 0 || report.Matches > 300*4 || report.GamesMin == 0 {
+		t.Errorf("TestSimulateThreePlayers got unexpected report: %+v", report)
+	}
+
+	last := report.Checkpoints[len(report.Checkpoints)-1]
+	if last.RankCorrelation < 0.8 {
+		t.Errorf("TestSimulateThreePlayers rating did not converge: %+v", last)
+	}
+}
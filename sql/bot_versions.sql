@@ -0,0 +1,19 @@
+DROP TABLE IF EXISTS "bot_versions";
+CREATE TABLE "bot_versions"
+(
+	bot_id BIGINT NOT NULL REFERENCES bots (id) ON DELETE NO ACTION,
+	version INTEGER NOT NULL CHECK ( version > 0 ),
+	code TEXT CONSTRAINT code_empty NOT NULL CHECK ( code <> '' ),
+	language LANG NOT NULL,
+	is_verified BOOLEAN NOT NULL DEFAULT FALSE,
+	created TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+
+	CONSTRAINT bot_version_pk PRIMARY KEY (bot_id, version),
+	CONSTRAINT unique_version_code UNIQUE (bot_id, code, language)
+);
+
+-- активная версия бота; bots.code и bots.language -- копия кода этой версии
+ALTER TABLE bots ADD CONSTRAINT bot_active_version_fk FOREIGN KEY (id, version)
+	REFERENCES bot_versions (bot_id, version) DEFERRABLE INITIALLY DEFERRED;
+
+ALTER TABLE bot_versions OWNER TO warscript_bots_user;
@@ -1,7 +1,7 @@
 CREATE EXTENSION IF NOT EXISTS citext;
 
 DROP TYPE IF EXISTS LANG CASCADE;
-CREATE TYPE LANG AS ENUM ('JS');
+CREATE TYPE LANG AS ENUM ('JS', 'PY', 'LUA');
 
 DROP TABLE IF EXISTS "bots";
 CREATE TABLE "bots"
@@ -13,12 +13,25 @@ CREATE TABLE "bots"
 	language LANG NOT NULL,
 	is_active BOOLEAN NOT NULL DEFAULT FALSE,
     is_verified BOOLEAN NOT NULL DEFAULT FALSE,
+	is_archived BOOLEAN NOT NULL DEFAULT FALSE,
 	author_id BIGINT NOT NULL,
 	game_slug citext CONSTRAINT game_slug_empty NOT NULL CHECK ( game_slug <> '' ),
-	score BIGINT NOT NULL DEFAULT 0,
+	-- рейтинг Glicko-2
+	score DOUBLE PRECISION NOT NULL DEFAULT 0,
+	score_deviation DOUBLE PRECISION NOT NULL DEFAULT 350,
+	score_volatility DOUBLE PRECISION NOT NULL DEFAULT 0.06,
 	games_played BIGINT NOT NULL DEFAULT 0,
+	wins BIGINT NOT NULL DEFAULT 0,
+	losses BIGINT NOT NULL DEFAULT 0,
+	draws BIGINT NOT NULL DEFAULT 0,
+	version INTEGER NOT NULL DEFAULT 1,
+	-- отпечаток кода для поиска похожих ботов; NULL -- ещё не посчитан
+	fingerprints BIGINT[],
 
 	CONSTRAINT unique_code UNIQUE (code, language, author_id, game_slug)
 );
 
+-- у автора в каждой игре не больше одного активного бота
+CREATE UNIQUE INDEX one_active_bot ON bots (author_id, game_slug) WHERE is_active;
+
 ALTER TABLE bots OWNER TO warscript_bots_user;
\ No newline at end of file
@@ -20,12 +20,20 @@ CREATE TABLE "matches"
 	author_1 BIGINT NOT NULL,
 	log_1 BYTEA,
 	diff_1 BIGINT NOT NULL,
+	version_1 INTEGER NOT NULL DEFAULT 1,
 
 	bot_2 BIGINT REFERENCES bots (id) ON DELETE NO ACTION,
 	error_2 TEXT,
 	author_2 BIGINT,
 	log_2 BYTEA,
-	diff_2 BIGINT
+	diff_2 BIGINT,
+	version_2 INTEGER,
+
+	-- задача тестерам, которой сыгран рейтинговый матч: одна задача -- один матч
+	job_id BIGINT
 );
 
+CREATE INDEX matches_game_time ON matches (game_slug, time);
+CREATE UNIQUE INDEX matches_job ON matches (job_id);
+
 ALTER TABLE matches OWNER TO warscript_bots_user;
\ No newline at end of file
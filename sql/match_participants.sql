@@ -0,0 +1,21 @@
+DROP TABLE IF EXISTS "match_participants";
+CREATE TABLE "match_participants"
+(
+	match_id BIGINT NOT NULL REFERENCES matches (id) ON DELETE CASCADE,
+	-- порядок игрока в задаче тестерам, с 1
+	position INTEGER NOT NULL,
+	bot_id BIGINT NOT NULL REFERENCES bots (id) ON DELETE NO ACTION,
+	author_id BIGINT NOT NULL,
+	version INTEGER NOT NULL,
+	-- место в матче, 1 -- лучшее; NULL, если матч не состоялся
+	placement INTEGER,
+	error TEXT,
+	log BYTEA,
+	diff BIGINT NOT NULL DEFAULT 0,
+
+	CONSTRAINT match_participant_pk PRIMARY KEY (match_id, position)
+);
+
+CREATE INDEX match_participants_bot ON match_participants (bot_id);
+
+ALTER TABLE match_participants OWNER TO warscript_bots_user;
@@ -0,0 +1,31 @@
+-- версии кода ботов. Текущий код каждого бота становится его первой версией
+ALTER TABLE bots ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS "bot_versions"
+(
+	bot_id BIGINT NOT NULL REFERENCES bots (id) ON DELETE NO ACTION,
+	version INTEGER NOT NULL CHECK ( version > 0 ),
+	code TEXT CONSTRAINT code_empty NOT NULL CHECK ( code <> '' ),
+	language LANG NOT NULL,
+	is_verified BOOLEAN NOT NULL DEFAULT FALSE,
+	created TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+
+	CONSTRAINT bot_version_pk PRIMARY KEY (bot_id, version),
+	CONSTRAINT unique_version_code UNIQUE (bot_id, code, language)
+);
+
+ALTER TABLE bot_versions OWNER TO warscript_bots_user;
+
+INSERT INTO bot_versions (bot_id, version, code, language, is_verified)
+SELECT b.id, b.version, b.code, b.language, b.is_verified FROM bots b
+ON CONFLICT DO NOTHING;
+
+-- активная версия бота; bots.code и bots.language -- копия кода этой версии
+ALTER TABLE bots DROP CONSTRAINT IF EXISTS bot_active_version_fk;
+ALTER TABLE bots ADD CONSTRAINT bot_active_version_fk FOREIGN KEY (id, version)
+	REFERENCES bot_versions (bot_id, version) DEFERRABLE INITIALLY DEFERRED;
+
+-- версии ботов, сыгравших матч; старые матчи сыграны первыми версиями
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS version_1 INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS version_2 INTEGER;
+UPDATE matches SET version_2 = 1 WHERE bot_2 IS NOT NULL AND version_2 IS NULL;
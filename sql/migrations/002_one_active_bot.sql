@@ -0,0 +1,7 @@
+-- у автора в каждой игре не больше одного активного бота.
+-- Из уже активных ботов автора активным остаётся самый новый
+UPDATE bots b SET is_active = false
+WHERE b.is_active AND EXISTS (SELECT 1 FROM bots o WHERE o.is_active
+	AND o.author_id = b.author_id AND o.game_slug = b.game_slug AND o.id > b.id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS one_active_bot ON bots (author_id, game_slug) WHERE is_active;
@@ -0,0 +1,2 @@
+-- архивирование ботов
+ALTER TABLE bots ADD COLUMN IF NOT EXISTS is_archived BOOLEAN NOT NULL DEFAULT FALSE;
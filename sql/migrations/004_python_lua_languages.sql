@@ -0,0 +1,4 @@
+-- новые языки ботов: Python и Lua
+-- ALTER TYPE ... ADD VALUE нельзя выполнять внутри транзакции
+ALTER TYPE LANG ADD VALUE IF NOT EXISTS 'PY';
+ALTER TYPE LANG ADD VALUE IF NOT EXISTS 'LUA';
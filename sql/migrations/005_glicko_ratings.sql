@@ -0,0 +1,6 @@
+-- рейтинг Glicko-2: очки дробные, у бота есть отклонение и волатильность.
+-- Очки, набранные в Elo, сохраняются: начальные очки обеих систем совпадают.
+-- Отклонение у всех ботов начальное, так что первые матчи быстро уточнят рейтинг
+ALTER TABLE bots ALTER COLUMN score TYPE DOUBLE PRECISION;
+ALTER TABLE bots ADD COLUMN IF NOT EXISTS score_deviation DOUBLE PRECISION NOT NULL DEFAULT 350;
+ALTER TABLE bots ADD COLUMN IF NOT EXISTS score_volatility DOUBLE PRECISION NOT NULL DEFAULT 0.06;
@@ -0,0 +1,4 @@
+-- статистика рейтинговых матчей бота
+ALTER TABLE bots ADD COLUMN IF NOT EXISTS wins BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE bots ADD COLUMN IF NOT EXISTS losses BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE bots ADD COLUMN IF NOT EXISTS draws BIGINT NOT NULL DEFAULT 0;
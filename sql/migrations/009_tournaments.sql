@@ -0,0 +1,57 @@
+-- турниры
+CREATE EXTENSION IF NOT EXISTS citext;
+
+CREATE TABLE IF NOT EXISTS "tournaments"
+(
+	id BIGSERIAL NOT NULL
+		CONSTRAINT tournament_pk
+			PRIMARY KEY,
+	game_slug citext CONSTRAINT game_slug_empty NOT NULL CHECK ( game_slug <> '' ),
+	organizer_id BIGINT NOT NULL,
+	title TEXT CONSTRAINT title_empty NOT NULL CHECK ( title <> '' ),
+	format TEXT NOT NULL CHECK ( format IN ('round_robin', 'swiss', 'single_elimination') ),
+	rounds INTEGER NOT NULL DEFAULT 0,
+	current_round INTEGER NOT NULL DEFAULT 0,
+	status TEXT NOT NULL CHECK ( status IN ('registration', 'running', 'finished') ),
+	created TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+ALTER TABLE tournaments OWNER TO warscript_bots_user;
+
+CREATE TABLE IF NOT EXISTS "tournament_participants"
+(
+	tournament_id BIGINT NOT NULL REFERENCES tournaments (id) ON DELETE CASCADE,
+	bot_id BIGINT NOT NULL REFERENCES bots (id) ON DELETE NO ACTION,
+	author_id BIGINT NOT NULL,
+	-- посев по очкам на момент старта турнира
+	seed INTEGER NOT NULL DEFAULT 0,
+	points DOUBLE PRECISION NOT NULL DEFAULT 0,
+	wins BIGINT NOT NULL DEFAULT 0,
+	losses BIGINT NOT NULL DEFAULT 0,
+	draws BIGINT NOT NULL DEFAULT 0,
+	eliminated BOOLEAN NOT NULL DEFAULT FALSE,
+
+	CONSTRAINT tournament_participant_pk PRIMARY KEY (tournament_id, bot_id)
+);
+
+ALTER TABLE tournament_participants OWNER TO warscript_bots_user;
+
+CREATE TABLE IF NOT EXISTS "tournament_matches"
+(
+	id BIGSERIAL NOT NULL
+		CONSTRAINT tournament_match_pk
+			PRIMARY KEY,
+	tournament_id BIGINT NOT NULL REFERENCES tournaments (id) ON DELETE CASCADE,
+	round INTEGER NOT NULL,
+	position INTEGER NOT NULL,
+	bot_1 BIGINT NOT NULL REFERENCES bots (id) ON DELETE NO ACTION,
+	-- NULL -- бот проходит раунд без игры
+	bot_2 BIGINT REFERENCES bots (id) ON DELETE NO ACTION,
+	match_id BIGINT REFERENCES matches (id) ON DELETE NO ACTION,
+	winner BIGINT REFERENCES bots (id) ON DELETE NO ACTION,
+	status TEXT NOT NULL CHECK ( status IN ('pending', 'running', 'finished') ),
+
+	CONSTRAINT unique_tournament_position UNIQUE (tournament_id, round, position)
+);
+
+ALTER TABLE tournament_matches OWNER TO warscript_bots_user;
@@ -0,0 +1,28 @@
+-- задачи тестерам
+CREATE EXTENSION IF NOT EXISTS citext;
+
+CREATE TABLE IF NOT EXISTS "jobs"
+(
+	id BIGSERIAL NOT NULL
+		CONSTRAINT job_pk
+			PRIMARY KEY,
+	type TEXT NOT NULL CHECK ( type IN ('verify', 'ranked', 'tournament') ),
+	game_slug citext CONSTRAINT game_slug_empty NOT NULL CHECK ( game_slug <> '' ),
+	bot_1 BIGINT NOT NULL REFERENCES bots (id) ON DELETE NO ACTION,
+	version_1 INTEGER NOT NULL,
+	author_1 BIGINT NOT NULL,
+	bot_2 BIGINT REFERENCES bots (id) ON DELETE NO ACTION,
+	tournament_match_id BIGINT REFERENCES tournament_matches (id) ON DELETE NO ACTION,
+	-- задача в том виде, в котором ушла тестерам
+	task BYTEA NOT NULL,
+	status TEXT NOT NULL CHECK ( status IN ('running', 'done', 'failed') ),
+	attempts INTEGER NOT NULL DEFAULT 0,
+	correlation_id TEXT NOT NULL,
+	error TEXT,
+	created TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+	updated TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS unfinished_jobs ON jobs (updated) WHERE status = 'running';
+
+ALTER TABLE jobs OWNER TO warscript_bots_user;
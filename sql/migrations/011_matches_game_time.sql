@@ -0,0 +1,2 @@
+-- матчи игры за последнее время: справедливый подбор и запрет повторных матчей
+CREATE INDEX IF NOT EXISTS matches_game_time ON matches (game_slug, time);
@@ -0,0 +1,36 @@
+-- участники матчей на нескольких игроков
+CREATE TABLE IF NOT EXISTS "match_participants"
+(
+	match_id BIGINT NOT NULL REFERENCES matches (id) ON DELETE CASCADE,
+	-- порядок игрока в задаче тестерам, с 1
+	position INTEGER NOT NULL,
+	bot_id BIGINT NOT NULL REFERENCES bots (id) ON DELETE NO ACTION,
+	author_id BIGINT NOT NULL,
+	version INTEGER NOT NULL,
+	-- место в матче, 1 -- лучшее; NULL, если матч не состоялся
+	placement INTEGER,
+	error TEXT,
+	log BYTEA,
+	diff BIGINT NOT NULL DEFAULT 0,
+
+	CONSTRAINT match_participant_pk PRIMARY KEY (match_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS match_participants_bot ON match_participants (bot_id);
+
+ALTER TABLE match_participants OWNER TO warscript_bots_user;
+
+-- старые матчи на двоих
+INSERT INTO match_participants (match_id, position, bot_id, author_id, version, placement, error, log, diff)
+SELECT m.id, 1, m.bot_1, m.author_1, m.version_1,
+	CASE m.result WHEN 0 THEN 1 WHEN 1 THEN 1 WHEN 2 THEN 2 END, m.error_1, m.log_1, m.diff_1
+FROM matches m
+ON CONFLICT DO NOTHING;
+
+INSERT INTO match_participants (match_id, position, bot_id, author_id, version, placement, error, log, diff)
+SELECT m.id, 2, m.bot_2, m.author_2, m.version_2,
+	CASE m.result WHEN 0 THEN 1 WHEN 1 THEN 2 WHEN 2 THEN 1 END, m.error_2, m.log_2, coalesce(m.diff_2, 0)
+FROM matches m WHERE m.bot_2 IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS players BIGINT[];
@@ -0,0 +1,20 @@
+-- отпечатки кода ботов; у старых ботов посчитаются при первой проверке сходства
+ALTER TABLE bots ADD COLUMN IF NOT EXISTS fingerprints BIGINT[];
+
+CREATE TABLE IF NOT EXISTS "similarity_reports"
+(
+	id BIGSERIAL NOT NULL
+		CONSTRAINT similarity_report_pk
+			PRIMARY KEY,
+	game_slug citext CONSTRAINT game_slug_empty NOT NULL CHECK ( game_slug <> '' ),
+	bot_id BIGINT NOT NULL REFERENCES bots (id) ON DELETE NO ACTION,
+	other_bot_id BIGINT NOT NULL REFERENCES bots (id) ON DELETE NO ACTION,
+	similarity DOUBLE PRECISION NOT NULL,
+	created TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+
+	CONSTRAINT unique_similarity_pair UNIQUE (bot_id, other_bot_id)
+);
+
+CREATE INDEX IF NOT EXISTS similarity_reports_game ON similarity_reports (game_slug, similarity);
+
+ALTER TABLE similarity_reports OWNER TO warscript_bots_user;
@@ -0,0 +1,4 @@
+-- задача тестерам, которой сыгран рейтинговый матч: одна задача -- один матч,
+-- так что возобновлённая после рестарта задача не запишет матч второй раз
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS job_id BIGINT;
+CREATE UNIQUE INDEX IF NOT EXISTS matches_job ON matches (job_id);
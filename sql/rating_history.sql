@@ -0,0 +1,19 @@
+DROP TABLE IF EXISTS "rating_history";
+CREATE TABLE "rating_history"
+(
+	id BIGSERIAL NOT NULL
+		CONSTRAINT rating_history_pk
+			PRIMARY KEY,
+	bot_id BIGINT NOT NULL REFERENCES bots (id) ON DELETE NO ACTION,
+	-- матч, после которого изменился рейтинг; NULL для изменений вне матчей
+	match_id BIGINT REFERENCES matches (id) ON DELETE NO ACTION,
+	version INTEGER NOT NULL,
+	score DOUBLE PRECISION NOT NULL,
+	score_deviation DOUBLE PRECISION NOT NULL,
+	reason TEXT NOT NULL,
+	time TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX rating_history_bot_time ON rating_history (bot_id, time);
+
+ALTER TABLE rating_history OWNER TO warscript_bots_user;
@@ -0,0 +1,41 @@
+CREATE EXTENSION IF NOT EXISTS citext;
+
+DROP TABLE IF EXISTS "seasons";
+CREATE TABLE "seasons"
+(
+	id BIGSERIAL NOT NULL
+		CONSTRAINT season_pk
+			PRIMARY KEY,
+	game_slug citext CONSTRAINT game_slug_empty NOT NULL CHECK ( game_slug <> '' ),
+	number INTEGER NOT NULL,
+	started_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+	-- NULL у текущего сезона
+	ended_at TIMESTAMP WITHOUT TIME ZONE,
+
+	CONSTRAINT unique_season_number UNIQUE (game_slug, number)
+);
+
+-- у игры не больше одного текущего сезона
+CREATE UNIQUE INDEX one_current_season ON seasons (game_slug) WHERE ended_at IS NULL;
+
+ALTER TABLE seasons OWNER TO warscript_bots_user;
+
+DROP TABLE IF EXISTS "season_standings";
+CREATE TABLE "season_standings"
+(
+	season_id BIGINT NOT NULL REFERENCES seasons (id) ON DELETE CASCADE,
+	bot_id BIGINT NOT NULL REFERENCES bots (id) ON DELETE NO ACTION,
+	author_id BIGINT NOT NULL,
+	version INTEGER NOT NULL,
+	rank INTEGER NOT NULL,
+	score DOUBLE PRECISION NOT NULL,
+	score_deviation DOUBLE PRECISION NOT NULL,
+	games_played BIGINT NOT NULL,
+	wins BIGINT NOT NULL,
+	losses BIGINT NOT NULL,
+	draws BIGINT NOT NULL,
+
+	CONSTRAINT season_standing_pk PRIMARY KEY (season_id, bot_id)
+);
+
+ALTER TABLE season_standings OWNER TO warscript_bots_user;
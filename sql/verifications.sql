@@ -0,0 +1,45 @@
+CREATE EXTENSION IF NOT EXISTS citext;
+
+DROP TABLE IF EXISTS "verifications";
+CREATE TABLE "verifications"
+(
+	id BIGSERIAL NOT NULL
+		CONSTRAINT verification_pk
+			PRIMARY KEY,
+	bot_id BIGINT NOT NULL REFERENCES bots (id) ON DELETE NO ACTION,
+	version INTEGER NOT NULL,
+	author_id BIGINT NOT NULL,
+	game_slug citext CONSTRAINT game_slug_empty NOT NULL CHECK ( game_slug <> '' ),
+	status TEXT NOT NULL CHECK ( status IN ('running', 'passed', 'failed') ),
+	-- критерии прохождения на момент запуска проверки
+	min_non_losses INTEGER NOT NULL,
+	allow_errors BOOLEAN NOT NULL,
+	created TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+	finished TIMESTAMP WITHOUT TIME ZONE
+);
+
+CREATE INDEX verifications_bot_version ON verifications (bot_id, version);
+
+ALTER TABLE verifications OWNER TO warscript_bots_user;
+
+DROP TABLE IF EXISTS "verification_matches";
+CREATE TABLE "verification_matches"
+(
+	verification_id BIGINT NOT NULL REFERENCES verifications (id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	-- имя эталонного бота из настроек игры
+	opponent TEXT NOT NULL,
+	-- за какого игрока задачи играет проверяемый бот
+	side INTEGER NOT NULL CHECK ( side IN (1, 2) ),
+	seed BIGINT,
+	job_id BIGINT REFERENCES jobs (id) ON DELETE NO ACTION,
+	match_id BIGINT REFERENCES matches (id) ON DELETE NO ACTION,
+	outcome TEXT NOT NULL CHECK ( outcome IN ('pending', 'win', 'draw', 'loss', 'error') ),
+	error TEXT,
+
+	CONSTRAINT verification_match_pk PRIMARY KEY (verification_id, position)
+);
+
+CREATE INDEX verification_matches_job ON verification_matches (job_id);
+
+ALTER TABLE verification_matches OWNER TO warscript_bots_user;
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	tournamentRoundRobin        = "round_robin"
+	tournamentSwiss             = "swiss"
+	tournamentSingleElimination = "single_elimination"
+
+	tournamentRegistration = "registration"
+	tournamentRunning      = "running"
+	tournamentFinished     = "finished"
+
+	tournamentMatchPending  = "pending"
+	tournamentMatchRunning  = "running"
+	tournamentMatchFinished = "finished"
+)
+
+// tournamentPairing пара раунда турнира; Bot2 == 0 -- бот проходит раунд без игры
+type tournamentPairing struct {
+	Position int64
+	Bot1     int64
+	Bot2     int64
+}
+
+// tournamentRounds число раундов турнира из n участников.
+// Для швейцарской системы rounds задаёт организатор, по умолчанию log2(n)
+func tournamentRounds(format string, n, rounds int64) int64 {
+	switch format {
+	case tournamentRoundRobin:
+		if n%2 == 1 {
+			return n
+		}
+		return n - 1
+	case tournamentSwiss:
+		if rounds > 0 {
+			return rounds
+		}
+		return int64(math.Ceil(math.Log2(float64(n))))
+	case tournamentSingleElimination:
+		return int64(math.Ceil(math.Log2(float64(n))))
+	}
+
+	return 0
+}
+
+// roundRobinPairings пары раунда круговой системы методом вращения:
+// первый посев стоит на месте, остальные сдвигаются на позицию каждый раунд
+func roundRobinPairings(seeded []int64, round int64) []*tournamentPairing {
+	ids := append([]int64{}, seeded...)
+	if len(ids)%2 == 1 {
+		ids = append(ids, 0)
+	}
+
+	m := len(ids)
+	shift := int(round-1) % (m - 1)
+	circle := make([]int64, m)
+	circle[0] = ids[0]
+	for j := 1; j < m; j++ {
+		circle[j] = ids[1+(j-1-shift+(m-1))%(m-1)]
+	}
+
+	pairings := make([]*tournamentPairing, 0, m/2)
+	for i := 0; i < m/2; i++ {
+		bot1, bot2 := circle[i], circle[m-1-i]
+		if bot1 == 0 {
+			bot1, bot2 = bot2, bot1
+		}
+		pairings = append(pairings, &tournamentPairing{Position: int64(i), Bot1: bot1, Bot2: bot2})
+	}
+
+	return pairings
+}
+
+// swissPairings пары раунда швейцарской системы: участники отсортированы по очкам,
+// каждый играет с ближайшим по таблице, с кем ещё не встречался.
+// При нечётном числе без игры проходит последний в таблице, кто ещё не отдыхал
+func swissPairings(standings []*TournamentParticipantModel, matches []*TournamentMatchModel) []*tournamentPairing {
+	played := make(map[[2]int64]bool)
+	hadBye := make(map[int64]bool)
+	for _, tm := range matches {
+		if !tm.Bot2.Valid {
+			hadBye[tm.Bot1] = true
+			continue
+		}
+		played[[2]int64{tm.Bot1, tm.Bot2.Int64}] = true
+		played[[2]int64{tm.Bot2.Int64, tm.Bot1}] = true
+	}
+
+	ids := make([]int64, 0, len(standings))
+	for _, p := range standings {
+		ids = append(ids, p.BotID)
+	}
+
+	pairings := make([]*tournamentPairing, 0, len(ids)/2+1)
+	if len(ids)%2 == 1 {
+		bye := len(ids) - 1
+		for i := len(ids) - 1; i >= 0; i-- {
+			if !hadBye[ids[i]] {
+				bye = i
+				break
+			}
+		}
+		pairings = append(pairings, &tournamentPairing{Bot1: ids[bye]})
+		ids = append(ids[:bye:bye], ids[bye+1:]...)
+	}
+
+	paired := make([]bool, len(ids))
+	for i := range ids {
+		if paired[i] {
+			continue
+		}
+
+		opponent := -1
+		for j := i + 1; j < len(ids); j++ {
+			if paired[j] {
+				continue
+			}
+			if opponent == -1 {
+				// если все уже сыграны -- повторная встреча с ближайшим
+				opponent = j
+			}
+			if !played[[2]int64{ids[i], ids[j]}] {
+				opponent = j
+				break
+			}
+		}
+
+		paired[i], paired[opponent] = true, true
+		pairings = append(pairings, &tournamentPairing{Bot1: ids[i], Bot2: ids[opponent]})
+	}
+
+	for i, p := range pairings {
+		p.Position = int64(i)
+	}
+
+	return pairings
+}
+
+// bracketOrder порядок посевов в сетке на выбывание, при котором сильнейшие
+// встречаются как можно позже: для 8 -- 1, 8, 4, 5, 2, 7, 3, 6
+func bracketOrder(size int) []int64 {
+	order := []int64{1}
+	for len(order) < size {
+		next := make([]int64, 0, 2*len(order))
+		sum := int64(2*len(order) + 1)
+		for _, seed := range order {
+			next = append(next, seed, sum-seed)
+		}
+		order = next
+	}
+
+	return order
+}
+
+// eliminationPairings пары раунда сетки на выбывание. В первом раунде места в сетке
+// определяет посев, лучшие посевы при неполной сетке проходят без игры.
+// Дальше встречаются победители соседних пар предыдущего раунда
+func eliminationPairings(seeded []int64, previous []*TournamentMatchModel) []*tournamentPairing {
+	if len(previous) == 0 {
+		size := 1
+		for size < len(seeded) {
+			size *= 2
+		}
+
+		order := bracketOrder(size)
+		pairings := make([]*tournamentPairing, 0, size/2)
+		for i := 0; i < size; i += 2 {
+			p := &tournamentPairing{Position: int64(i / 2), Bot1: seeded[order[i]-1]}
+			if int(order[i+1]) <= len(seeded) {
+				p.Bot2 = seeded[order[i+1]-1]
+			}
+			pairings = append(pairings, p)
+		}
+
+		return pairings
+	}
+
+	sort.Slice(previous, func(i, j int) bool {
+		return previous[i].Position < previous[j].Position
+	})
+
+	pairings := make([]*tournamentPairing, 0, len(previous)/2)
+	for i := 0; i+1 < len(previous); i += 2 {
+		pairings = append(pairings, &tournamentPairing{
+			Position: int64(i / 2),
+			Bot1:     previous[i].Winner.Int64,
+			Bot2:     previous[i+1].Winner.Int64,
+		})
+	}
+
+	return pairings
+}
+
+// nextTournamentRound пары следующего раунда, либо nil, если турнир окончен.
+// participants отсортированы по таблице, matches -- все матчи турнира
+func nextTournamentRound(t *TournamentModel, participants []*TournamentParticipantModel,
+	matches []*TournamentMatchModel) []*tournamentPairing {
+	if t.CurrentRound >= t.Rounds {
+		return nil
+	}
+
+	// бот без посева в турнире не играет: посев выдаётся всем участникам при старте
+	seededParticipants := make([]*TournamentParticipantModel, 0, len(participants))
+	for _, p := range participants {
+		if p.Seed > 0 {
+			seededParticipants = append(seededParticipants, p)
+		}
+	}
+	participants = seededParticipants
+
+	bySeed := append([]*TournamentParticipantModel{}, participants...)
+	sort.Slice(bySeed, func(i, j int) bool { return bySeed[i].Seed < bySeed[j].Seed })
+	seeded := make([]int64, 0, len(bySeed))
+	for _, p := range bySeed {
+		seeded = append(seeded, p.BotID)
+	}
+
+	switch t.Format {
+	case tournamentRoundRobin:
+		return roundRobinPairings(seeded, t.CurrentRound+1)
+	case tournamentSwiss:
+		return swissPairings(participants, matches)
+	case tournamentSingleElimination:
+		previous := make([]*TournamentMatchModel, 0)
+		for _, tm := range matches {
+			if tm.Round == t.CurrentRound {
+				previous = append(previous, tm)
+			}
+		}
+		return eliminationPairings(seeded, previous)
+	}
+
+	return nil
+}
+
+// startTournaments фоновое проведение турниров: матчи текущих раундов отправляются
+// тестерам, а когда раунд сыгран -- создаётся следующий. Выполняется только лидером
+func startTournaments(stop <-chan struct{}) {
+	for {
+		timer := time.NewTimer(10 * time.Second)
+		tournaments, err := Tournaments.GetRunningTournaments()
+		if err != nil {
+			logger.Error(errors.Wrap(err, "can't get running tournaments"))
+		}
+
+		for _, t := range tournaments {
+			advanceTournament(t)
+		}
+
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func advanceTournament(t *TournamentModel) {
+	logger := logger.WithFields(logrus.Fields{
+		"tournament_id": t.ID,
+		"method":        "advanceTournament",
+	})
+
+	participants, err := Tournaments.GetParticipants(t.ID)
+	if err != nil {
+		logger.Error(errors.Wrap(err, "can not get tournament participants"))
+		return
+	}
+	seeds := make(map[int64]int64, len(participants))
+	for _, p := range participants {
+		seeds[p.BotID] = p.Seed
+	}
+
+	matches, err := Tournaments.GetMatches(t.ID)
+	if err != nil {
+		logger.Error(errors.Wrap(err, "can not get tournament matches"))
+		return
+	}
+
+	roundFinished := true
+	for _, tm := range matches {
+		if tm.Round != t.CurrentRound {
+			continue
+		}
+
+		if tm.Status != tournamentMatchFinished {
+			roundFinished = false
+		}
+		if tm.Status == tournamentMatchPending {
+			dispatchTournamentMatch(t, tm, seeds)
+		}
+	}
+
+	if !roundFinished {
+		return
+	}
+
+	pairings := nextTournamentRound(t, participants, matches)
+	if pairings == nil {
+		if err = Tournaments.Finish(t.ID); err != nil {
+			logger.Error(errors.Wrap(err, "can not finish tournament"))
+			return
+		}
+		t.Status = tournamentFinished
+		broadcastTournament(t)
+		return
+	}
+
+	if err = Tournaments.CreateRound(t.ID, t.CurrentRound+1, pairings); err != nil {
+		// раунд уже создала параллельная итерация
+		if errors.Cause(err) != utils.ErrTaken {
+			logger.Error(errors.Wrap(err, "can not create tournament round"))
+		}
+		return
+	}
+	t.CurrentRound++
+	broadcastTournament(t)
+
+	// матчи нового раунда отправятся на следующей итерации
+}
+
+func dispatchTournamentMatch(t *TournamentModel, tm *TournamentMatchModel, seeds map[int64]int64) {
+	logger := logger.WithFields(logrus.Fields{
+		"tournament_id": t.ID,
+		"match_id":      tm.ID,
+		"method":        "dispatchTournamentMatch",
+	})
+
+	bot1, err := Bots.GetBotByID(tm.Bot1)
+	if err != nil {
+		logger.Error(errors.Wrap(err, "can not get bot1"))
+		return
+	}
+	bot2, err := Bots.GetBotByID(tm.Bot2.Int64)
+	if err != nil {
+		logger.Error(errors.Wrap(err, "can not get bot2"))
+		return
+	}
+
+	taken, err := Tournaments.SetMatchRunning(tm.ID)
+	if err != nil || !taken {
+		if err != nil {
+			logger.Error(errors.Wrap(err, "can not take tournament match"))
+		}
+		return
+	}
+
+	events, err := startJob(&JobModel{
+		Type:              jobTournament,
+		GameSlug:          t.GameSlug,
+		Bot1:              bot1.ID,
+		Version1:          bot1.Version,
+		Author1:           bot1.AuthorID,
+		Bot2:              sql.NullInt64{Int64: bot2.ID, Valid: true},
+		TournamentMatchID: sql.NullInt64{Int64: tm.ID, Valid: true},
+	}, newTestTask(t.GameSlug, botPlayer(bot1), botPlayer(bot2)))
+	if err != nil {
+		logger.Error(errors.Wrap(err, "failed to call testing rpc"))
+		if err = Tournaments.SetMatchPending(tm.ID); err != nil {
+			logger.Error(errors.Wrap(err, "can not return tournament match to pending"))
+		}
+		return
+	}
+
+	go processTournamentStatus(t, tm, bot1, bot2, seeds, events)
+}
+
+// processTournamentStatus обработка матча турнира. Матчи турниров не меняют рейтинг.
+// Ничья на выбывание проводит дальше бота с лучшим посевом. Матч, который тестеры
+// не смогли сыграть, возвращается в очередь и будет отправлен заново
+func processTournamentStatus(t *TournamentModel, tm *TournamentMatchModel, bot1, bot2 *BotModel,
+	seeds map[int64]int64, events <-chan *TesterStatusQueue) {
+	logger := logger.WithFields(logrus.Fields{
+		"tournament_id": t.ID,
+		"bot_id1":       bot1.ID,
+		"bot_id2":       bot2.ID,
+		"method":        "processTournamentStatus",
+	})
+
+	for event := range events {
+		logger.Infof("Processing [%s]", event.Type)
+
+		m := &MatchModel{
+			GameSlug: t.GameSlug,
+
+			Bot1:     bot1.ID,
+			Author1:  bot1.AuthorID,
+			Version1: bot1.Version,
+
+			Bot2:     sql.NullInt64{Int64: bot2.ID, Valid: true},
+			Author2:  sql.NullInt64{Int64: bot2.AuthorID, Valid: true},
+			Diff2:    sql.NullInt64{Int64: 0, Valid: true},
+			Version2: sql.NullInt64{Int64: bot2.Version, Valid: true},
+		}
+
+		switch event.Type {
+		case "status":
+			continue
+		case "result":
+			res := &TesterStatusResult{}
+			err := json.Unmarshal(event.Body, res)
+			if err != nil {
+				logger.Error(errors.Wrap(err, "can not unmarshal result status body"))
+				continue
+			}
+
+			m.Info, m.States, m.Result = res.Info, res.States, res.Winner
+			m.Error1 = sql.NullString{String: res.Error1, Valid: res.Error1 != ""}
+			m.Error2 = sql.NullString{String: res.Error2, Valid: res.Error2 != ""}
+			m.Log1, m.Log2 = res.Logs1, res.Logs2
+		case "error", "timeout":
+			res := &TesterStatusError{}
+			err := json.Unmarshal(event.Body, res)
+			if err != nil {
+				logger.Error(errors.Wrap(err, "can not unmarshal error status body"))
+				continue
+			}
+
+			logger.Infof("Match error: %s", res.Error)
+			if err = Tournaments.SetMatchPending(tm.ID); err != nil {
+				logger.Error(errors.Wrap(err, "can not return tournament match to pending"))
+			}
+			continue
+		default:
+			logger.Error(errors.New("can not process unknown status type"))
+			continue
+		}
+
+		winner, eliminated := tournamentMatchWinner(t.Format, tm, m.Result, seeds)
+		if err := Tournaments.RecordMatchResult(tm, m, winner, eliminated); err != nil {
+			logger.Error(errors.Wrap(err, "can not record tournament match"))
+			continue
+		}
+		broadcastTournament(t)
+	}
+}
+
+// tournamentMatchWinner победитель пары (0 -- ничья) и выбывший бот (0 -- никто)
+func tournamentMatchWinner(format string, tm *TournamentMatchModel, result int,
+	seeds map[int64]int64) (int64, int64) {
+	winner, loser := int64(0), int64(0)
+	switch result {
+	case 1:
+		winner, loser = tm.Bot1, tm.Bot2.Int64
+	case 2:
+		winner, loser = tm.Bot2.Int64, tm.Bot1
+	}
+
+	if format != tournamentSingleElimination {
+		return winner, 0
+	}
+
+	if winner == 0 {
+		winner, loser = tm.Bot1, tm.Bot2.Int64
+		if seeds[loser] < seeds[winner] {
+			winner, loser = loser, winner
+		}
+	}
+
+	return winner, loser
+}
+
+// broadcastTournament обновление турнира для всех, кто слушает игру или организатора
+func broadcastTournament(t *TournamentModel) {
+	body, err := json.Marshal(newTournament(t))
+	if err != nil {
+		logger.Error(errors.Wrap(err, "can not marshal tournament"))
+		return
+	}
+
+	h.broadcast <- &BotStatusMessage{
+		AuthorID: t.OrganizerID,
+		GameSlug: t.GameSlug,
+		Body:     body,
+		Type:     "tournament",
+	}
+}
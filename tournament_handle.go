@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/HotCodeGroup/warscript-utils/models"
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+func newTournament(t *TournamentModel) *Tournament {
+	return &Tournament{
+		ID:           t.ID,
+		GameSlug:     t.GameSlug,
+		OrganizerID:  t.OrganizerID,
+		Title:        t.Title,
+		Format:       t.Format,
+		Rounds:       t.Rounds,
+		CurrentRound: t.CurrentRound,
+		Status:       t.Status,
+		Created:      t.Created,
+	}
+}
+
+// getTournament турнир из пути запроса; если его нет, пишет ошибку и возвращает nil
+func getTournament(r *http.Request, errWriter *utils.ErrorResponseWriter) *TournamentModel {
+	tournamentID, err := strconv.ParseInt(mux.Vars(r)["tournament_id"], 10, 64)
+	if err != nil {
+		errWriter.WriteWarn(http.StatusNotFound, errors.Wrap(err, "wrong format tournament_id"))
+		return nil
+	}
+
+	t, err := Tournaments.GetTournamentByID(tournamentID)
+	if err != nil {
+		if errors.Cause(err) == utils.ErrNotExists {
+			errWriter.WriteWarn(http.StatusNotFound, errors.Wrap(err, "tournament not exists"))
+		} else {
+			errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get tournament method error"))
+		}
+		return nil
+	}
+
+	return t
+}
+
+// CreateTournament создание турнира, организатор -- текущий пользователь
+func CreateTournament(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger(r, logger, "CreateTournament")
+	errWriter := utils.NewErrorResponseWriter(w, logger)
+	info := SessionInfo(r)
+	if info == nil {
+		errWriter.WriteWarn(http.StatusUnauthorized, errors.New("session info is not presented"))
+		return
+	}
+
+	form := &TournamentCreate{}
+	err := utils.DecodeBodyJSON(r.Body, form)
+	if err != nil {
+		errWriter.WriteWarn(http.StatusBadRequest, errors.Wrap(err, "decode body error"))
+		return
+	}
+
+	if err = form.Validate(); err != nil {
+		// уверены в преобразовании
+		errWriter.WriteValidationError(err.(*utils.ValidationError))
+		return
+	}
+
+	gameInfo, err := gamesGPRC.GetGameBySlug(context.Background(), &models.GameSlug{Slug: form.GameSlug})
+	if err != nil {
+		errWriter.WriteValidationError(&utils.ValidationError{
+			"game_slug": utils.ErrNotExists.Error(),
+		})
+		return
+	}
+
+	t := &TournamentModel{
+		GameSlug:    gameInfo.Slug,
+		OrganizerID: info.ID,
+		Title:       form.Title,
+		Format:      form.Format,
+		Rounds:      form.Rounds,
+	}
+	if err = Tournaments.Create(t); err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "tournament create error"))
+		return
+	}
+
+	utils.WriteApplicationJSON(w, http.StatusOK, newTournament(t))
+}
+
+// GetTournaments список турниров, можно отфильтровать по игре
+func GetTournaments(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger(r, logger, "GetTournaments")
+	errWriter := utils.NewErrorResponseWriter(w, logger)
+
+	limit, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+	if err != nil {
+		limit = 10
+	}
+	since, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	if err != nil {
+		since = 0
+	}
+
+	tournaments, err := Tournaments.GetTournaments(r.URL.Query().Get("game_slug"), limit, since)
+	if err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get tournaments method error"))
+		return
+	}
+
+	respTournaments := make([]*Tournament, len(tournaments))
+	for i, t := range tournaments {
+		respTournaments[i] = newTournament(t)
+	}
+
+	utils.WriteApplicationJSON(w, http.StatusOK, respTournaments)
+}
+
+// GetTournament турнир с турнирной таблицей и сеткой
+func GetTournament(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger(r, logger, "GetTournament")
+	errWriter := utils.NewErrorResponseWriter(w, logger)
+
+	t := getTournament(r, errWriter)
+	if t == nil {
+		return
+	}
+
+	participants, err := Tournaments.GetParticipants(t.ID)
+	if err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get tournament participants error"))
+		return
+	}
+
+	matches, err := Tournaments.GetMatches(t.ID)
+	if err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get tournament matches error"))
+		return
+	}
+
+	resp := &TournamentFull{
+		Tournament: *newTournament(t),
+		Standings:  make([]*TournamentStanding, len(participants)),
+		Matches:    make([]*TournamentMatch, len(matches)),
+	}
+	for i, p := range participants {
+		resp.Standings[i] = &TournamentStanding{
+			BotID:      p.BotID,
+			AuthorID:   p.AuthorID,
+			Seed:       p.Seed,
+			Points:     p.Points,
+			Wins:       p.Wins,
+			Losses:     p.Losses,
+			Draws:      p.Draws,
+			Eliminated: p.Eliminated,
+		}
+	}
+	for i, tm := range matches {
+		resp.Matches[i] = &TournamentMatch{
+			Round:    tm.Round,
+			Position: tm.Position,
+			Bot1ID:   tm.Bot1,
+			Bot2ID:   tm.Bot2.Int64,
+			MatchID:  tm.MatchID.Int64,
+			WinnerID: tm.Winner.Int64,
+			Status:   tm.Status,
+		}
+	}
+
+	utils.WriteApplicationJSON(w, http.StatusOK, resp)
+}
+
+// RegisterTournamentBot регистрация бота на турнир. Зарегистрировать бота
+// может его автор или организатор турнира
+func RegisterTournamentBot(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger(r, logger, "RegisterTournamentBot")
+	errWriter := utils.NewErrorResponseWriter(w, logger)
+	info := SessionInfo(r)
+	if info == nil {
+		errWriter.WriteWarn(http.StatusUnauthorized, errors.New("session info is not presented"))
+		return
+	}
+
+	form := &TournamentRegister{}
+	err := utils.DecodeBodyJSON(r.Body, form)
+	if err != nil {
+		errWriter.WriteWarn(http.StatusBadRequest, errors.Wrap(err, "decode body error"))
+		return
+	}
+
+	t := getTournament(r, errWriter)
+	if t == nil {
+		return
+	}
+
+	if t.Status != tournamentRegistration {
+		errWriter.WriteWarn(http.StatusConflict, errors.New("tournament registration is closed"))
+		return
+	}
+
+	bot, err := Bots.GetBotByID(form.BotID)
+	if err != nil {
+		if errors.Cause(err) == utils.ErrNotExists {
+			errWriter.WriteValidationError(&utils.ValidationError{
+				"bot_id": utils.ErrNotExists.Error(),
+			})
+		} else {
+			errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get bot method error"))
+		}
+		return
+	}
+
+	if bot.AuthorID != info.ID && t.OrganizerID != info.ID {
+		errWriter.WriteWarn(http.StatusForbidden, errors.New("bot belongs to another author"))
+		return
+	}
+
+	// game_slug -- citext
+	if !strings.EqualFold(bot.GameSlug, t.GameSlug) || !bot.IsVerified || bot.IsArchived {
+		errWriter.WriteValidationError(&utils.ValidationError{
+			"bot_id": utils.ErrInvalid.Error(),
+		})
+		return
+	}
+
+	err = Tournaments.AddParticipant(&TournamentParticipantModel{
+		TournamentID: t.ID,
+		BotID:        bot.ID,
+		AuthorID:     bot.AuthorID,
+	})
+	if err != nil {
+		if errors.Cause(err) == utils.ErrTaken {
+			errWriter.WriteValidationError(&utils.ValidationError{
+				"bot_id": utils.ErrTaken.Error(),
+			})
+			return
+		}
+		if errors.Cause(err) == utils.ErrInvalid {
+			errWriter.WriteWarn(http.StatusConflict, errors.Wrap(err, "tournament registration is closed"))
+			return
+		}
+
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "add participant method error"))
+		return
+	}
+
+	utils.WriteApplicationJSON(w, http.StatusOK, newTournament(t))
+}
+
+// StartTournament закрытие регистрации и запуск турнира, только для организатора
+func StartTournament(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger(r, logger, "StartTournament")
+	errWriter := utils.NewErrorResponseWriter(w, logger)
+	info := SessionInfo(r)
+	if info == nil {
+		errWriter.WriteWarn(http.StatusUnauthorized, errors.New("session info is not presented"))
+		return
+	}
+
+	t := getTournament(r, errWriter)
+	if t == nil {
+		return
+	}
+
+	if t.OrganizerID != info.ID {
+		errWriter.WriteWarn(http.StatusForbidden, errors.New("only organizer can start tournament"))
+		return
+	}
+
+	participants, err := Tournaments.GetParticipants(t.ID)
+	if err != nil {
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get tournament participants error"))
+		return
+	}
+
+	if len(participants) < 2 {
+		errWriter.WriteValidationError(&utils.ValidationError{
+			"participants": utils.ErrInvalid.Error(),
+		})
+		return
+	}
+
+	rounds, err := Tournaments.Start(t.ID)
+	if err != nil {
+		if errors.Cause(err) == utils.ErrInvalid {
+			errWriter.WriteWarn(http.StatusConflict, errors.Wrap(err, "tournament can not be started"))
+			return
+		}
+
+		errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "start tournament method error"))
+		return
+	}
+	t.Status, t.Rounds = tournamentRunning, rounds
+	utils.WriteApplicationJSON(w, http.StatusOK, newTournament(t))
+}
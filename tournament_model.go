@@ -0,0 +1,425 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// TournamentAccessObject DAO for Tournament model
+type TournamentAccessObject interface {
+	Create(t *TournamentModel) error
+	GetTournamentByID(tournamentID int64) (*TournamentModel, error)
+	GetTournaments(game string, limit, since int64) ([]*TournamentModel, error)
+	GetRunningTournaments() ([]*TournamentModel, error)
+	Start(tournamentID int64) (int64, error)
+	Finish(tournamentID int64) error
+
+	AddParticipant(p *TournamentParticipantModel) error
+	GetParticipants(tournamentID int64) ([]*TournamentParticipantModel, error)
+
+	GetMatches(tournamentID int64) ([]*TournamentMatchModel, error)
+	CreateRound(tournamentID, round int64, pairings []*tournamentPairing) error
+	SetMatchRunning(tournamentMatchID int64) (bool, error)
+	SetMatchPending(tournamentMatchID int64) error
+	RecordMatchResult(tm *TournamentMatchModel, m *MatchModel, winner, eliminated int64) error
+}
+
+// TournamentObject implementation of TournamentAccessObject
+type TournamentObject struct{}
+
+// Tournaments объект для обращения с моделью tournament
+var Tournaments TournamentAccessObject
+
+func init() {
+	Tournaments = &TournamentObject{}
+}
+
+// TournamentModel model for tournaments table
+type TournamentModel struct {
+	ID           int64
+	GameSlug     string
+	OrganizerID  int64
+	Title        string
+	Format       string
+	Rounds       int64
+	CurrentRound int64
+	Status       string
+	Created      time.Time
+}
+
+// TournamentParticipantModel model for tournament_participants table
+type TournamentParticipantModel struct {
+	TournamentID int64
+	BotID        int64
+	AuthorID     int64
+	Seed         int64
+	Points       float64
+	Wins         int64
+	Losses       int64
+	Draws        int64
+	Eliminated   bool
+}
+
+// TournamentMatchModel model for tournament_matches table, пара в сетке турнира
+type TournamentMatchModel struct {
+	ID           int64
+	TournamentID int64
+	Round        int64
+	Position     int64
+	Bot1         int64
+	Bot2         sql.NullInt64
+	MatchID      sql.NullInt64
+	Winner       sql.NullInt64
+	Status       string
+}
+
+const tournamentFields = `t.id, t.game_slug, t.organizer_id, t.title, t.format,
+	t.rounds, t.current_round, t.status, t.created`
+
+func scanTournament(row rowScanner) (*TournamentModel, error) {
+	t := &TournamentModel{}
+	err := row.Scan(&t.ID, &t.GameSlug, &t.OrganizerID, &t.Title, &t.Format,
+		&t.Rounds, &t.CurrentRound, &t.Status, &t.Created)
+
+	return t, err
+}
+
+// Create создание турнира, открытого для регистрации ботов
+func (o *TournamentObject) Create(t *TournamentModel) error {
+	t.Status = tournamentRegistration
+	row := pqConn.QueryRow(`INSERT INTO tournaments (game_slug, organizer_id, title, format, rounds, status)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created;`,
+		t.GameSlug, t.OrganizerID, t.Title, t.Format, t.Rounds, t.Status)
+	if err := row.Scan(&t.ID, &t.Created); err != nil {
+		return errors.Wrapf(utils.ErrInternal, "create tournament row error: %v", err)
+	}
+
+	return nil
+}
+
+// GetTournamentByID получение турнира по его идентификатору
+func (o *TournamentObject) GetTournamentByID(tournamentID int64) (*TournamentModel, error) {
+	row := pqConn.QueryRow(`SELECT `+tournamentFields+` FROM tournaments t WHERE t.id = $1;`, tournamentID)
+	t, err := scanTournament(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.Wrapf(utils.ErrNotExists, "tournament with this id does not exist: %v", err)
+		}
+
+		return nil, errors.Wrapf(utils.ErrInternal, "can not get tournament by id: %v", err)
+	}
+
+	return t, nil
+}
+
+// GetTournaments список турниров, начиная с последних; пустой game -- все игры
+func (o *TournamentObject) GetTournaments(game string, limit, since int64) ([]*TournamentModel, error) {
+	rows, err := pqConn.Query(`SELECT `+tournamentFields+` FROM tournaments t
+		WHERE ($1 = '' OR t.game_slug = $1) ORDER BY t.id DESC LIMIT $2 OFFSET $3;`, game, limit, since)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "get tournaments error: %v", err)
+	}
+
+	return scanTournaments(rows)
+}
+
+// GetRunningTournaments идущие турниры всех игр
+func (o *TournamentObject) GetRunningTournaments() ([]*TournamentModel, error) {
+	rows, err := pqConn.Query(`SELECT `+tournamentFields+` FROM tournaments t
+		WHERE t.status = $1 ORDER BY t.id;`, tournamentRunning)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "get running tournaments error: %v", err)
+	}
+
+	return scanTournaments(rows)
+}
+
+func scanTournaments(rows *sql.Rows) ([]*TournamentModel, error) {
+	defer rows.Close()
+
+	tournaments := make([]*TournamentModel, 0)
+	for rows.Next() {
+		t, err := scanTournament(rows)
+		if err != nil {
+			return nil, errors.Wrapf(utils.ErrInternal, "get tournaments scan error: %v", err)
+		}
+		tournaments = append(tournaments, t)
+	}
+
+	return tournaments, nil
+}
+
+// Start закрытие регистрации: участники получают посев по текущим очкам ботов,
+// число раундов считается по участникам под блокировкой турнира, чтобы
+// параллельная регистрация не попала мимо посева. Первый раунд создаст фоновый обработчик турниров
+func (o *TournamentObject) Start(tournamentID int64) (int64, error) {
+	tx, err := pqConn.Begin()
+	if err != nil {
+		return 0, errors.Wrapf(utils.ErrInternal, "can not open tournament start transaction: %s", err.Error())
+	}
+	//nolint: errcheck
+	defer tx.Rollback()
+
+	var format, status string
+	var rounds int64
+	row := tx.QueryRow(`SELECT t.format, t.rounds, t.status FROM tournaments t
+		WHERE t.id = $1 FOR UPDATE;`, tournamentID)
+	if err = row.Scan(&format, &rounds, &status); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, errors.Wrapf(utils.ErrNotExists, "tournament does not exist: %v", err)
+		}
+
+		return 0, errors.Wrapf(utils.ErrInternal, "can not lock tournament: %v", err)
+	}
+	if status != tournamentRegistration {
+		return 0, errors.Wrap(utils.ErrInvalid, "tournament is not open for registration")
+	}
+
+	var participants int64
+	row = tx.QueryRow(`SELECT count(*) FROM tournament_participants WHERE tournament_id = $1;`, tournamentID)
+	if err = row.Scan(&participants); err != nil {
+		return 0, errors.Wrapf(utils.ErrInternal, "can not count tournament participants: %v", err)
+	}
+	if participants < 2 {
+		return 0, errors.Wrap(utils.ErrInvalid, "not enough tournament participants")
+	}
+
+	rounds = tournamentRounds(format, participants, rounds)
+	_, err = tx.Exec(`UPDATE tournaments SET status = $2, rounds = $3 WHERE id = $1;`,
+		tournamentID, tournamentRunning, rounds)
+	if err != nil {
+		return 0, errors.Wrapf(utils.ErrInternal, "can not start tournament: %v", err)
+	}
+
+	_, err = tx.Exec(`UPDATE tournament_participants p SET seed = s.seed
+		FROM (SELECT tp.bot_id, row_number() OVER (ORDER BY b.score DESC, tp.bot_id) AS seed
+			FROM tournament_participants tp JOIN bots b ON b.id = tp.bot_id
+			WHERE tp.tournament_id = $1) s
+		WHERE p.tournament_id = $1 AND p.bot_id = s.bot_id;`, tournamentID)
+	if err != nil {
+		return 0, errors.Wrapf(utils.ErrInternal, "can not seed tournament participants: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, errors.Wrapf(utils.ErrInternal, "can not commit tournament start transaction: %v", err)
+	}
+
+	return rounds, nil
+}
+
+// Finish завершение турнира
+func (o *TournamentObject) Finish(tournamentID int64) error {
+	_, err := pqConn.Exec(`UPDATE tournaments SET status = $2 WHERE id = $1;`, tournamentID, tournamentFinished)
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not finish tournament: %v", err)
+	}
+
+	return nil
+}
+
+// AddParticipant регистрация бота на турнир, только пока регистрация открыта.
+// Строка турнира блокируется на чтение, так что Start дождётся вставки или наоборот
+func (o *TournamentObject) AddParticipant(p *TournamentParticipantModel) error {
+	res, err := pqConn.Exec(`INSERT INTO tournament_participants (tournament_id, bot_id, author_id)
+		SELECT t.id, $2, $3 FROM tournaments t WHERE t.id = $1 AND t.status = $4 FOR SHARE;`,
+		p.TournamentID, p.BotID, p.AuthorID, tournamentRegistration)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			return errors.Wrapf(utils.ErrTaken, "bot is already registered: %v", err)
+		}
+
+		return errors.Wrapf(utils.ErrInternal, "can not add tournament participant: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.Wrap(utils.ErrInvalid, "tournament registration is closed")
+	}
+
+	return nil
+}
+
+// GetParticipants участники турнира в порядке турнирной таблицы
+func (o *TournamentObject) GetParticipants(tournamentID int64) ([]*TournamentParticipantModel, error) {
+	rows, err := pqConn.Query(`SELECT p.tournament_id, p.bot_id, p.author_id, p.seed, p.points,
+		p.wins, p.losses, p.draws, p.eliminated FROM tournament_participants p
+		WHERE p.tournament_id = $1 ORDER BY p.points DESC, p.seed, p.bot_id;`, tournamentID)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "get tournament participants error: %v", err)
+	}
+	defer rows.Close()
+
+	participants := make([]*TournamentParticipantModel, 0)
+	for rows.Next() {
+		p := &TournamentParticipantModel{}
+		err = rows.Scan(&p.TournamentID, &p.BotID, &p.AuthorID, &p.Seed, &p.Points,
+			&p.Wins, &p.Losses, &p.Draws, &p.Eliminated)
+		if err != nil {
+			return nil, errors.Wrapf(utils.ErrInternal, "get tournament participants scan error: %v", err)
+		}
+		participants = append(participants, p)
+	}
+
+	return participants, nil
+}
+
+// GetMatches сетка турнира: пары всех раундов
+func (o *TournamentObject) GetMatches(tournamentID int64) ([]*TournamentMatchModel, error) {
+	rows, err := pqConn.Query(`SELECT tm.id, tm.tournament_id, tm.round, tm.position, tm.bot_1, tm.bot_2,
+		tm.match_id, tm.winner, tm.status FROM tournament_matches tm
+		WHERE tm.tournament_id = $1 ORDER BY tm.round, tm.position;`, tournamentID)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "get tournament matches error: %v", err)
+	}
+	defer rows.Close()
+
+	matches := make([]*TournamentMatchModel, 0)
+	for rows.Next() {
+		tm := &TournamentMatchModel{}
+		err = rows.Scan(&tm.ID, &tm.TournamentID, &tm.Round, &tm.Position, &tm.Bot1, &tm.Bot2,
+			&tm.MatchID, &tm.Winner, &tm.Status)
+		if err != nil {
+			return nil, errors.Wrapf(utils.ErrInternal, "get tournament matches scan error: %v", err)
+		}
+		matches = append(matches, tm)
+	}
+
+	return matches, nil
+}
+
+// CreateRound создание пар нового раунда. Бот без соперника сразу получает очко за победу.
+// Если раунд уже создан параллельно, возвращает ErrTaken
+func (o *TournamentObject) CreateRound(tournamentID, round int64, pairings []*tournamentPairing) error {
+	tx, err := pqConn.Begin()
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not open tournament round transaction: %s", err.Error())
+	}
+	//nolint: errcheck
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE tournaments SET current_round = $2
+		WHERE id = $1 AND current_round = $2 - 1;`, tournamentID, round)
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not update tournament round: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.Wrap(utils.ErrTaken, "tournament round is already created")
+	}
+
+	for _, p := range pairings {
+		if p.Bot2 != 0 {
+			_, err = tx.Exec(`INSERT INTO tournament_matches (tournament_id, round, position, bot_1, bot_2, status)
+				VALUES ($1, $2, $3, $4, $5, $6);`, tournamentID, round, p.Position, p.Bot1, p.Bot2,
+				tournamentMatchPending)
+			if err != nil {
+				return errors.Wrapf(utils.ErrInternal, "can not create tournament match: %v", err)
+			}
+			continue
+		}
+
+		_, err = tx.Exec(`INSERT INTO tournament_matches (tournament_id, round, position, bot_1, winner, status)
+			VALUES ($1, $2, $3, $4, $4, $5);`, tournamentID, round, p.Position, p.Bot1, tournamentMatchFinished)
+		if err != nil {
+			return errors.Wrapf(utils.ErrInternal, "can not create tournament bye: %v", err)
+		}
+		_, err = tx.Exec(`UPDATE tournament_participants SET points = points + 1
+			WHERE tournament_id = $1 AND bot_id = $2;`, tournamentID, p.Bot1)
+		if err != nil {
+			return errors.Wrapf(utils.ErrInternal, "can not update tournament participant: %v", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not commit tournament round transaction: %v", err)
+	}
+
+	return nil
+}
+
+// SetMatchRunning пара забирается на отправку тестерам; false -- её уже забрали
+func (o *TournamentObject) SetMatchRunning(tournamentMatchID int64) (bool, error) {
+	res, err := pqConn.Exec(`UPDATE tournament_matches SET status = $2 WHERE id = $1 AND status = $3;`,
+		tournamentMatchID, tournamentMatchRunning, tournamentMatchPending)
+	if err != nil {
+		return false, errors.Wrapf(utils.ErrInternal, "can not update tournament match: %v", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(utils.ErrInternal, "can not update tournament match: %v", err)
+	}
+
+	return n > 0, nil
+}
+
+// SetMatchPending возврат пары в очередь, если её не удалось отправить тестерам или сыграть
+func (o *TournamentObject) SetMatchPending(tournamentMatchID int64) error {
+	_, err := pqConn.Exec(`UPDATE tournament_matches SET status = $2 WHERE id = $1 AND status = $3;`,
+		tournamentMatchID, tournamentMatchPending, tournamentMatchRunning)
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not update tournament match: %v", err)
+	}
+
+	return nil
+}
+
+// RecordMatchResult запись сыгранного матча турнира одной транзакцией: матч, итог пары
+// и очки участников (1 за победу, 0.5 за ничью). Рейтинг ботов не меняется
+func (o *TournamentObject) RecordMatchResult(tm *TournamentMatchModel, m *MatchModel,
+	winner, eliminated int64) error {
+	tx, err := pqConn.Begin()
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not open tournament match transaction: %s", err.Error())
+	}
+	//nolint: errcheck
+	defer tx.Rollback()
+
+	if err = insertMatch(tx, m); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`UPDATE tournament_matches SET match_id = $2, winner = $3, status = $4
+		WHERE id = $1 AND status = $5;`, tm.ID, m.ID, sql.NullInt64{Int64: winner, Valid: winner != 0},
+		tournamentMatchFinished, tournamentMatchRunning)
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not update tournament match: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.Wrap(utils.ErrInvalid, "tournament match is not running")
+	}
+
+	for _, botID := range []int64{tm.Bot1, tm.Bot2.Int64} {
+		win, loss, draw := 0, 0, 0
+		switch winner {
+		case 0:
+			draw = 1
+		case botID:
+			win = 1
+		default:
+			loss = 1
+		}
+		if m.Result != 1 && m.Result != 2 {
+			// ничья на выбывание: победитель проходит дальше по посеву
+			win, loss, draw = 0, 0, 1
+		}
+
+		_, err = tx.Exec(`UPDATE tournament_participants SET points = points + $3 + 0.5 * $5,
+			wins = wins + $3, losses = losses + $4, draws = draws + $5, eliminated = eliminated OR $6
+			WHERE tournament_id = $1 AND bot_id = $2;`,
+			tm.TournamentID, botID, win, loss, draw, botID == eliminated)
+		if err != nil {
+			return errors.Wrapf(utils.ErrInternal, "can not update tournament participant: %v", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not commit tournament match transaction: %v", err)
+	}
+
+	return nil
+}
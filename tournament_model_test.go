@@ -0,0 +1,138 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/pkg/errors"
+)
+
+func TestCreateRoundWithBye(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE tournaments SET current_round").
+		WithArgs(1, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO tournament_matches").
+		WithArgs(1, 1, 0, 11, 12, "pending").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO tournament_matches").
+		WithArgs(1, 1, 1, 13, "finished").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec("UPDATE tournament_participants SET points").
+		WithArgs(1, 13).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	pqConn = db
+	Tournaments = &TournamentObject{}
+
+	err = Tournaments.CreateRound(1, 1, []*tournamentPairing{
+		{Position: 0, Bot1: 11, Bot2: 12},
+		{Position: 1, Bot1: 13},
+	})
+	if err != nil {
+		t.Errorf("TestCreateRoundWithBye got unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestCreateRoundWithBye there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateRoundTaken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	// раунд уже создан параллельной итерацией
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE tournaments SET current_round").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	pqConn = db
+	Tournaments = &TournamentObject{}
+
+	err = Tournaments.CreateRound(1, 2, []*tournamentPairing{{Bot1: 11, Bot2: 12}})
+	if errors.Cause(err) != utils.ErrTaken {
+		t.Errorf("TestCreateRoundTaken got unexpected error: %v, expected: %v", err, utils.ErrTaken)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestCreateRoundTaken there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAddParticipantRegistrationClosed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	// турнир стартовал раньше, чем вставка дождалась блокировки
+	mock.ExpectExec("INSERT INTO tournament_participants").
+		WithArgs(1, 11, 2, "registration").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	pqConn = db
+	Tournaments = &TournamentObject{}
+
+	err = Tournaments.AddParticipant(&TournamentParticipantModel{TournamentID: 1, BotID: 11, AuthorID: 2})
+	if errors.Cause(err) != utils.ErrInvalid {
+		t.Errorf("TestAddParticipantRegistrationClosed got unexpected error: %v, expected: %v", err, utils.ErrInvalid)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestAddParticipantRegistrationClosed there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStartCountsLockedParticipants(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM tournaments t WHERE t.id = (.+) FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"format", "rounds", "status"}).
+			AddRow("round_robin", 0, "registration"))
+	mock.ExpectQuery("SELECT count").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+	mock.ExpectExec("UPDATE tournaments SET status").
+		WithArgs(1, "running", 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE tournament_participants p SET seed").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectCommit()
+
+	pqConn = db
+	Tournaments = &TournamentObject{}
+
+	rounds, err := Tournaments.Start(1)
+	if err != nil {
+		t.Errorf("TestStartCountsLockedParticipants got unexpected error: %v", err)
+	}
+	if rounds != 3 {
+		t.Errorf("TestStartCountsLockedParticipants got rounds %d, expected 3", rounds)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestStartCountsLockedParticipants there were unfulfilled expectations: %s", err)
+	}
+}
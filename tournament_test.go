@@ -0,0 +1,116 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestRoundRobinPairingsEveryoneMeets(t *testing.T) {
+	seeded := []int64{1, 2, 3, 4, 5}
+	rounds := tournamentRounds(tournamentRoundRobin, int64(len(seeded)), 0)
+
+	met := make(map[[2]int64]int)
+	byes := make(map[int64]int)
+	for round := int64(1); round <= rounds; round++ {
+		for _, p := range roundRobinPairings(seeded, round) {
+			if p.Bot2 == 0 {
+				byes[p.Bot1]++
+				continue
+			}
+			met[[2]int64{p.Bot1, p.Bot2}]++
+			met[[2]int64{p.Bot2, p.Bot1}]++
+		}
+	}
+
+	for _, a := range seeded {
+		if byes[a] != 1 {
+			t.Errorf("TestRoundRobinPairingsEveryoneMeets bot %d got %d byes, expected 1", a, byes[a])
+		}
+		for _, b := range seeded {
+			if a != b && met[[2]int64{a, b}] != 1 {
+				t.Errorf("TestRoundRobinPairingsEveryoneMeets bots %d and %d met %d times", a, b, met[[2]int64{a, b}])
+			}
+		}
+	}
+}
+
+func TestEliminationPairingsSeeding(t *testing.T) {
+	// 6 ботов в сетке на 8: посевы 1 и 2 проходят первый раунд без игры
+	seeded := []int64{11, 12, 13, 14, 15, 16}
+	pairings := eliminationPairings(seeded, nil)
+
+	expected := []*tournamentPairing{
+		{Position: 0, Bot1: 11},
+		{Position: 1, Bot1: 14, Bot2: 15},
+		{Position: 2, Bot1: 12},
+		{Position: 3, Bot1: 13, Bot2: 16},
+	}
+	if !reflect.DeepEqual(pairings, expected) {
+		t.Errorf("TestEliminationPairingsSeeding got unexpected pairings: %v", pairings)
+	}
+
+	previous := []*TournamentMatchModel{
+		{Position: 1, Winner: sql.NullInt64{Int64: 15, Valid: true}},
+		{Position: 0, Winner: sql.NullInt64{Int64: 11, Valid: true}},
+		{Position: 3, Winner: sql.NullInt64{Int64: 13, Valid: true}},
+		{Position: 2, Winner: sql.NullInt64{Int64: 12, Valid: true}},
+	}
+	next := eliminationPairings(seeded, previous)
+	expected = []*tournamentPairing{
+		{Position: 0, Bot1: 11, Bot2: 15},
+		{Position: 1, Bot1: 12, Bot2: 13},
+	}
+	if !reflect.DeepEqual(next, expected) {
+		t.Errorf("TestEliminationPairingsSeeding got unexpected next round: %v", next)
+	}
+}
+
+func TestSwissPairingsAvoidsRematch(t *testing.T) {
+	standings := []*TournamentParticipantModel{
+		{BotID: 1, Points: 1}, {BotID: 2, Points: 1}, {BotID: 3}, {BotID: 4}, {BotID: 5},
+	}
+	matches := []*TournamentMatchModel{
+		{Bot1: 1, Bot2: sql.NullInt64{Int64: 2, Valid: true}},
+		{Bot1: 5},
+	}
+
+	pairings := swissPairings(standings, matches)
+	expected := []*tournamentPairing{
+		{Position: 0, Bot1: 4},
+		{Position: 1, Bot1: 1, Bot2: 3},
+		{Position: 2, Bot1: 2, Bot2: 5},
+	}
+	if !reflect.DeepEqual(pairings, expected) {
+		t.Errorf("TestSwissPairingsAvoidsRematch got unexpected pairings: %v", pairings)
+	}
+}
+
+func TestTournamentMatchWinnerEliminationDraw(t *testing.T) {
+	tm := &TournamentMatchModel{Bot1: 15, Bot2: sql.NullInt64{Int64: 11, Valid: true}}
+	seeds := map[int64]int64{11: 1, 15: 5}
+
+	winner, eliminated := tournamentMatchWinner(tournamentSingleElimination, tm, 0, seeds)
+	if winner != 11 || eliminated != 15 {
+		t.Errorf("TestTournamentMatchWinnerEliminationDraw got winner %d, eliminated %d", winner, eliminated)
+	}
+
+	winner, eliminated = tournamentMatchWinner(tournamentSwiss, tm, 0, seeds)
+	if winner != 0 || eliminated != 0 {
+		t.Errorf("TestTournamentMatchWinnerEliminationDraw swiss draw got winner %d, eliminated %d", winner, eliminated)
+	}
+}
+
+func TestNextTournamentRoundSkipsUnseeded(t *testing.T) {
+	tournament := &TournamentModel{Format: tournamentRoundRobin, Rounds: 1}
+	participants := []*TournamentParticipantModel{
+		{BotID: 12, Seed: 2},
+		{BotID: 13},
+		{BotID: 11, Seed: 1},
+	}
+
+	pairings := nextTournamentRound(tournament, participants, nil)
+	if len(pairings) != 1 || pairings[0].Bot1+pairings[0].Bot2 != 23 {
+		t.Errorf("TestNextTournamentRoundSkipsUnseeded got pairings %+v, expected 11 vs 12", pairings)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"math"
+)
+
+// trueSkillDrawProbability вероятность ничьей между равными ботами по умолчанию
+const trueSkillDrawProbability = 0.1
+
+// trueSkillSystem рейтинг в духе TrueSkill для двух игроков: Score -- мю, Deviation -- сигма.
+// В отличие от Elo и Glicko-2 явно учитывает вероятность ничьей, поэтому подходит
+// для игр, где ничьи частые (например, pong)
+type trueSkillSystem struct {
+	mu    float64
+	sigma float64
+	// beta разброс результата одного матча при равном мастерстве
+	beta float64
+	// tau рост неуверенности за рейтинговый период
+	tau float64
+	// drawMargin разница в результатах, которая считается ничьей
+	drawMargin float64
+}
+
+func newTrueSkillSystem(mu, sigma, drawProbability float64) *trueSkillSystem {
+	beta := sigma / 2
+	return &trueSkillSystem{
+		mu:         mu,
+		sigma:      sigma,
+		beta:       beta,
+		tau:        sigma / 100,
+		drawMargin: normInv((drawProbability+1)/2) * math.Sqrt2 * beta,
+	}
+}
+
+func (ts *trueSkillSystem) Initial() Rating {
+	return Rating{Score: ts.mu, Deviation: ts.sigma}
+}
+
+func (ts *trueSkillSystem) Rate(r1, r2 Rating, winner int) (Rating, Rating) {
+	if winner != 0 && winner != 1 && winner != 2 {
+		return r1, r2
+	}
+
+	// победитель всегда первый
+	if winner == 2 {
+		r2, r1 = ts.Rate(r2, r1, 1)
+		return r1, r2
+	}
+
+	sigma1Sq := r1.Deviation*r1.Deviation + ts.tau*ts.tau
+	sigma2Sq := r2.Deviation*r2.Deviation + ts.tau*ts.tau
+	c := math.Sqrt(2*ts.beta*ts.beta + sigma1Sq + sigma2Sq)
+	t := (r1.Score - r2.Score) / c
+	eps := ts.drawMargin / c
+
+	var v, w float64
+	if winner == 0 {
+		v, w = trueSkillDraw(t, eps)
+	} else {
+		v, w = trueSkillWin(t, eps)
+	}
+
+	r1.Score += sigma1Sq / c * v
+	r2.Score -= sigma2Sq / c * v
+	r1.Deviation = math.Sqrt(sigma1Sq * math.Max(1-sigma1Sq/(c*c)*w, 0.0001))
+	r2.Deviation = math.Sqrt(sigma2Sq * math.Max(1-sigma2Sq/(c*c)*w, 0.0001))
+
+	return r1, r2
+}
+
+func (ts *trueSkillSystem) Idle(r Rating) Rating {
+	r.Deviation = math.Min(math.Sqrt(r.Deviation*r.Deviation+ts.tau*ts.tau), ts.sigma)
+	return r
+}
+
+// trueSkillWin поправки среднего и дисперсии для победы
+func trueSkillWin(t, eps float64) (float64, float64) {
+	x := t - eps
+	denom := normCDF(x)
+	if denom < 1e-300 {
+		// победа вопреки всему: предел v ~ -x
+		return -x, 1
+	}
+
+	v := normPDF(x) / denom
+	return v, v * (v + x)
+}
+
+// trueSkillDraw поправки среднего и дисперсии для ничьей
+func trueSkillDraw(t, eps float64) (float64, float64) {
+	denom := normCDF(eps-t) - normCDF(-eps-t)
+	if denom < 1e-300 {
+		if t < 0 {
+			return -t - eps, 1
+		}
+		return -t + eps, 1
+	}
+
+	v := (normPDF(-eps-t) - normPDF(eps-t)) / denom
+	w := v*v + ((eps-t)*normPDF(eps-t)+(eps+t)*normPDF(eps+t))/denom
+	return v, w
+}
+
+func normPDF(x float64) float64 {
+	return math.Exp(-x*x/2) / math.Sqrt(2*math.Pi)
+}
+
+func normCDF(x float64) float64 {
+	return math.Erfc(-x/math.Sqrt2) / 2
+}
+
+func normInv(p float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2*p-1)
+}
@@ -17,11 +17,6 @@ type BotUpload struct {
 	Language Lang   `json:"lang"`
 }
 
-var availableLanguages = map[Lang]struct{}{
-	// JS - JavaScript
-	"JS": {},
-}
-
 // Validate проверка полей входящего бота, на соответствие требованиям
 func (bu *BotUpload) Validate() error {
 	if _, ok := availableLanguages[bu.Language]; !ok {
@@ -33,6 +28,95 @@ func (bu *BotUpload) Validate() error {
 	return nil
 }
 
+// BotVersionUpload структура от front для загрузки новой версии кода бота
+type BotVersionUpload struct {
+	Code     string `json:"code"`
+	Language Lang   `json:"lang"`
+}
+
+// Validate проверка полей новой версии, на соответствие требованиям
+func (bvu *BotVersionUpload) Validate() error {
+	if _, ok := availableLanguages[bvu.Language]; !ok {
+		return &utils.ValidationError{
+			"lang": utils.ErrInvalid.Error(),
+		}
+	}
+
+	return nil
+}
+
+// BotRollback структура от front для отката бота на одну из версий
+type BotRollback struct {
+	Version int64 `json:"version"`
+}
+
+// BotUpdate структура от front для изменения состояния бота
+type BotUpdate struct {
+	IsActive *bool `json:"is_active"`
+}
+
+// SeasonClose структура для закрытия сезона игры
+type SeasonClose struct {
+	GameSlug string `json:"game_slug"`
+	// CarryOver доля отрыва от среднего рейтинга, которая переходит в новый сезон
+	CarryOver *float64 `json:"carry_over"`
+}
+
+// Validate проверка параметров закрытия сезона
+func (sc *SeasonClose) Validate() error {
+	if sc.GameSlug == "" {
+		return &utils.ValidationError{
+			"game_slug": utils.ErrInvalid.Error(),
+		}
+	}
+	if sc.CarryOver != nil && (*sc.CarryOver < 0 || *sc.CarryOver > 1) {
+		return &utils.ValidationError{
+			"carry_over": utils.ErrInvalid.Error(),
+		}
+	}
+
+	return nil
+}
+
+// TournamentCreate структура от front для создания турнира
+type TournamentCreate struct {
+	GameSlug string `json:"game_slug"`
+	Title    string `json:"title"`
+	Format   string `json:"format"`
+	// Rounds число раундов швейцарской системы, 0 -- по числу участников
+	Rounds int64 `json:"rounds"`
+}
+
+// Validate проверка полей нового турнира
+func (tc *TournamentCreate) Validate() error {
+	switch tc.Format {
+	case tournamentRoundRobin, tournamentSwiss, tournamentSingleElimination:
+	default:
+		return &utils.ValidationError{
+			"format": utils.ErrInvalid.Error(),
+		}
+	}
+
+	if tc.Title == "" {
+		return &utils.ValidationError{
+			"title": utils.ErrInvalid.Error(),
+		}
+	}
+
+	if tc.Rounds < 0 || (tc.Rounds > 0 && tc.Format != tournamentSwiss) {
+		return &utils.ValidationError{
+			"rounds": utils.ErrInvalid.Error(),
+		}
+	}
+
+	return nil
+}
+
+// TournamentRegister структура от front для регистрации бота на турнир
+type TournamentRegister struct {
+	BotID int64 `json:"bot_id"`
+}
+
 // AuthorInfo информация об автора бота
 type AuthorInfo struct {
 	ID        int64  `json:"id"`
@@ -48,7 +132,18 @@ type Bot struct {
 	GameSlug   string      `json:"game_slug"`
 	IsActive   bool        `json:"is_active"`
 	IsVerified bool        `json:"is_verified"`
+	IsArchived bool        `json:"is_archived"`
 	Score      int64       `json:"score"`
+	// ScoreDeviation отклонение рейтинга, ScoreInterval -- 95% доверительный интервал
+	ScoreDeviation int64    `json:"score_deviation"`
+	ScoreInterval  [2]int64 `json:"score_interval"`
+	Version        int64    `json:"version"`
+	GamesPlayed    int64    `json:"games_played"`
+	Wins           int64    `json:"wins"`
+	Losses         int64    `json:"losses"`
+	Draws          int64    `json:"draws"`
+	// Rank место в итоговой таблице, только для закрытых сезонов
+	Rank int64 `json:"rank,omitempty"`
 }
 
 // BotFull полная информация о боте
@@ -56,6 +151,100 @@ type BotFull struct {
 	Bot
 	Code     string `json:"code"`
 	Language Lang   `json:"lang"`
+	// JobID задача первого матча проверки
+	JobID          int64 `json:"job_id,omitempty"`
+	VerificationID int64 `json:"verification_id,omitempty"`
+}
+
+// BotVersion информация о версии кода бота
+type BotVersion struct {
+	Version    int64     `json:"version"`
+	Language   Lang      `json:"lang"`
+	IsVerified bool      `json:"is_verified"`
+	IsActive   bool      `json:"is_active"`
+	Created    time.Time `json:"created"`
+	Code       string    `json:"code,omitempty"`
+	// JobID задача первого матча проверки
+	JobID          int64 `json:"job_id,omitempty"`
+	VerificationID int64 `json:"verification_id,omitempty"`
+}
+
+// Season информация о сезоне игры
+type Season struct {
+	GameSlug  string     `json:"game_slug"`
+	Number    int64      `json:"number"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+}
+
+// Tournament информация о турнире
+type Tournament struct {
+	ID           int64     `json:"id"`
+	GameSlug     string    `json:"game_slug"`
+	OrganizerID  int64     `json:"organizer_id"`
+	Title        string    `json:"title"`
+	Format       string    `json:"format"`
+	Rounds       int64     `json:"rounds"`
+	CurrentRound int64     `json:"current_round"`
+	Status       string    `json:"status"`
+	Created      time.Time `json:"created"`
+}
+
+// TournamentStanding строка турнирной таблицы
+type TournamentStanding struct {
+	BotID      int64   `json:"bot_id"`
+	AuthorID   int64   `json:"author_id"`
+	Seed       int64   `json:"seed"`
+	Points     float64 `json:"points"`
+	Wins       int64   `json:"wins"`
+	Losses     int64   `json:"losses"`
+	Draws      int64   `json:"draws"`
+	Eliminated bool    `json:"eliminated"`
+}
+
+// TournamentMatch пара в сетке турнира; без bot2_id -- проход без игры
+type TournamentMatch struct {
+	Round    int64  `json:"round"`
+	Position int64  `json:"position"`
+	Bot1ID   int64  `json:"bot1_id"`
+	Bot2ID   int64  `json:"bot2_id,omitempty"`
+	MatchID  int64  `json:"match_id,omitempty"`
+	WinnerID int64  `json:"winner_id,omitempty"`
+	Status   string `json:"status"`
+}
+
+// TournamentFull турнир с таблицей и сеткой
+type TournamentFull struct {
+	Tournament
+	Standings []*TournamentStanding `json:"standings"`
+	Matches   []*TournamentMatch    `json:"matches"`
+}
+
+// RatingPoint точка истории рейтинга бота
+type RatingPoint struct {
+	Time           time.Time `json:"time"`
+	Score          int64     `json:"score"`
+	ScoreDeviation int64     `json:"score_deviation"`
+	Version        int64     `json:"version"`
+	Reason         string    `json:"reason"`
+	MatchID        int64     `json:"match_id,omitempty"`
+}
+
+// Job состояние задачи тестерам
+type Job struct {
+	ID                int64     `json:"id"`
+	Type              string    `json:"type"`
+	GameSlug          string    `json:"game_slug"`
+	Bot1ID            int64     `json:"bot1_id"`
+	Version1          int64     `json:"version1"`
+	Bot2ID            int64     `json:"bot2_id,omitempty"`
+	TournamentMatchID int64     `json:"tournament_match_id,omitempty"`
+	Status            string    `json:"status"`
+	Attempts          int64     `json:"attempts"`
+	CorrelationID     string    `json:"correlation_id"`
+	Error             string    `json:"error,omitempty"`
+	Created           time.Time `json:"created"`
+	Updated           time.Time `json:"updated"`
 }
 
 // BotStatusMessage обновление статуса бота, например: прошел проверку
@@ -70,6 +259,7 @@ type BotStatusMessage struct {
 // BotStatus новый статус бота
 type BotStatus struct {
 	BotID     int64  `json:"bot_id"`
+	Version   int64  `json:"version"`
 	NewStatus string `json:"new_status"`
 }
 
@@ -82,10 +272,33 @@ type MatchInfo struct {
 	Author2   *AuthorInfo `json:"author_2"`
 	Bot1ID    int64       `json:"bot1_id"`
 	Bot2ID    int64       `json:"bot2_id"`
+	Version1  int64       `json:"bot1_version"`
+	Version2  int64       `json:"bot2_version"`
+	Archived1 bool        `json:"bot1_archived"`
+	Archived2 bool        `json:"bot2_archived"`
 	NewScore1 int64       `json:"new_score1"`
 	NewScore2 int64       `json:"new_score2"`
-	Diff1     int64       `json:"diff1"`
-	Diff2     int64       `json:"diff2"`
+	// NewDeviation* отклонение рейтинга после матча
+	NewDeviation1 int64 `json:"new_deviation1"`
+	NewDeviation2 int64 `json:"new_deviation2"`
+	Diff1         int64 `json:"diff1"`
+	Diff2         int64 `json:"diff2"`
+	// Participants все игроки по порядку; поля *1, *2 -- первые два из них
+	Participants []*MatchParticipant `json:"participants,omitempty"`
+}
+
+// MatchParticipant игрок матча
+type MatchParticipant struct {
+	Position int64       `json:"position"`
+	Author   *AuthorInfo `json:"author"`
+	BotID    int64       `json:"bot_id"`
+	Version  int64       `json:"bot_version"`
+	Archived bool        `json:"bot_archived"`
+	// Placement место в матче, 1 -- лучшее; нет, если матч не состоялся
+	Placement    int64 `json:"placement,omitempty"`
+	NewScore     int64 `json:"new_score,omitempty"`
+	NewDeviation int64 `json:"new_deviation,omitempty"`
+	Diff         int64 `json:"diff"`
 }
 
 // Replay повтор матча для плеера
@@ -116,7 +329,48 @@ type NotifyMatchMessage struct {
 // NotifyVerifyMessage сообщение для сервиса нотификации о прохождении проверки
 type NotifyVerifyMessage struct {
 	BotID    int64  `json:"bot_id"`
+	Version  int64  `json:"version"`
 	GameSlug string `json:"game_slug"`
 	MatchID  int64  `json:"match_id"`
-	Veryfied bool   `json:"veryfied"`
+	// VerificationID отчёт о проверке со всеми её матчами
+	VerificationID int64 `json:"verification_id"`
+	Veryfied       bool  `json:"veryfied"`
+}
+
+// SimilarityReport пара подозрительно похожих ботов разных авторов
+type SimilarityReport struct {
+	ID          int64       `json:"id"`
+	GameSlug    string      `json:"game_slug"`
+	BotID       int64       `json:"bot_id"`
+	Author      *AuthorInfo `json:"author"`
+	OtherBotID  int64       `json:"other_bot_id"`
+	OtherAuthor *AuthorInfo `json:"other_author"`
+	Similarity  float64     `json:"similarity"`
+	Created     time.Time   `json:"created"`
+}
+
+// Verification отчёт о проверке версии бота
+type Verification struct {
+	ID           int64                `json:"id"`
+	BotID        int64                `json:"bot_id"`
+	Version      int64                `json:"version"`
+	GameSlug     string               `json:"game_slug"`
+	Status       string               `json:"status"`
+	MinNonLosses int64                `json:"min_non_losses"`
+	AllowErrors  bool                 `json:"allow_errors"`
+	Matches      []*VerificationMatch `json:"matches"`
+	Created      time.Time            `json:"created"`
+	Finished     *time.Time           `json:"finished,omitempty"`
+}
+
+// VerificationMatch матч из набора проверки; Outcome -- исход для проверяемого бота
+type VerificationMatch struct {
+	Position int64  `json:"position"`
+	Opponent string `json:"opponent"`
+	Side     int64  `json:"side"`
+	Seed     *int64 `json:"seed,omitempty"`
+	Outcome  string `json:"outcome"`
+	MatchID  int64  `json:"match_id,omitempty"`
+	JobID    int64  `json:"job_id,omitempty"`
+	Error    string `json:"error,omitempty"`
 }
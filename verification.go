@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/HotCodeGroup/warscript-utils/models"
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// systemOpponent имя системного бота игры в наборе проверки
+	systemOpponent = "system"
+	// verificationMatchAttempts сколько раз матч проверки отправляется тестерам, если они
+	// не смогли его сыграть. После этого матч считается несыгранным и проверка проваливается
+	verificationMatchAttempts = 3
+)
+
+// ReferenceBot эталонный бот для проверки. Без кода -- системный бот игры
+type ReferenceBot struct {
+	Name string `json:"name"`
+	Code string `json:"code"`
+	Lang Lang   `json:"lang"`
+}
+
+// VerificationConfig набор матчей, который проходит каждая новая версия бота:
+// все эталонные боты на всех сидах, при BothSides -- за обе стороны
+type VerificationConfig struct {
+	// Opponents эталонные боты; по умолчанию только системный бот игры
+	Opponents []*ReferenceBot `json:"opponents"`
+	// BothSides играть и первым, и вторым игроком
+	BothSides bool `json:"both_sides"`
+	// Seeds сиды матчей; по умолчанию один матч без сида
+	Seeds []int64 `json:"seeds"`
+	// MinNonLosses сколько матчей нужно не проиграть; по умолчанию один
+	MinNonLosses *int64 `json:"min_non_losses"`
+	// AllowErrors засчитывать ли матчи с ошибками исполнения бота
+	AllowErrors bool `json:"allow_errors"`
+}
+
+// defaultVerification проверка для игр без своих настроек: как и раньше,
+// достаточно не проиграть одному матчу с системным ботом
+var defaultVerification = &VerificationConfig{AllowErrors: true}
+
+// plannedMatches сколько матчей в наборе проверки
+func (c *VerificationConfig) plannedMatches() int64 {
+	opponents, seeds, sides := len(c.Opponents), len(c.Seeds), 1
+	if opponents == 0 {
+		opponents = 1
+	}
+	if seeds == 0 {
+		seeds = 1
+	}
+	if c.BothSides {
+		sides = 2
+	}
+
+	return int64(opponents * seeds * sides)
+}
+
+// validate проверка, которую можно пройти: нужных матчей не больше, чем в наборе
+func (c *VerificationConfig) validate() error {
+	if c.MinNonLosses == nil {
+		return nil
+	}
+	if planned := c.plannedMatches(); *c.MinNonLosses < 0 || *c.MinNonLosses > planned {
+		return errors.Errorf("min_non_losses %d is out of range for %d matches", *c.MinNonLosses, planned)
+	}
+
+	return nil
+}
+
+// verificationConfigFor набор проверки, выбранный для игры
+func verificationConfigFor(gameSlug string) *VerificationConfig {
+	if games != nil {
+		if game, ok := games.Get(gameSlug); ok && game.Verification != nil {
+			return game.Verification
+		}
+	}
+
+	return defaultVerification
+}
+
+// planVerification проверка версии бота с матчами по набору config и соперники для них
+func planVerification(config *VerificationConfig, systemBot string) (*VerificationModel, []*TestPlayer) {
+	opponents := config.Opponents
+	if len(opponents) == 0 {
+		opponents = []*ReferenceBot{{Name: systemOpponent}}
+	}
+	seeds := make([]sql.NullInt64, 0, len(config.Seeds))
+	for _, seed := range config.Seeds {
+		seeds = append(seeds, sql.NullInt64{Int64: seed, Valid: true})
+	}
+	if len(seeds) == 0 {
+		seeds = append(seeds, sql.NullInt64{})
+	}
+	sides := []int64{1}
+	if config.BothSides {
+		sides = append(sides, 2)
+	}
+
+	v := &VerificationModel{
+		MinNonLosses: 1,
+		AllowErrors:  config.AllowErrors,
+	}
+	if config.MinNonLosses != nil {
+		v.MinNonLosses = *config.MinNonLosses
+	}
+
+	players := make([]*TestPlayer, 0, len(opponents)*len(seeds)*len(sides))
+	for _, opponent := range opponents {
+		player := &TestPlayer{Code: opponent.Code, Lang: opponent.Lang}
+		if player.Code == "" {
+			player.Code = systemBot
+		}
+		if player.Lang == "" {
+			player.Lang = systemBotLanguage
+		}
+
+		for _, seed := range seeds {
+			for _, side := range sides {
+				v.Matches = append(v.Matches, &VerificationMatchModel{
+					Position: int64(len(v.Matches) + 1),
+					Opponent: opponent.Name,
+					Side:     side,
+					Seed:     seed,
+				})
+				players = append(players, player)
+			}
+		}
+	}
+
+	return v, players
+}
+
+// verificationTask задача тестерам для матча проверки
+func verificationTask(gameSlug string, bot, opponent *TestPlayer, m *VerificationMatchModel) *TestTask {
+	task := newTestTask(gameSlug, bot, opponent)
+	if m.Side == 2 {
+		task = newTestTask(gameSlug, opponent, bot)
+	}
+	if m.Seed.Valid {
+		seed := m.Seed.Int64
+		task.Seed = &seed
+	}
+
+	return task
+}
+
+// startVerification запуск проверки версии бота: каждый матч набора -- отдельная задача
+// тестерам. Возвращает проверку и задачу её первого матча
+func startVerification(v *VerificationModel, bot *TestPlayer, systemBot string) (*VerificationModel, int64, error) {
+	plan, opponents := planVerification(verificationConfigFor(v.GameSlug), systemBot)
+	plan.BotID, plan.Version, plan.AuthorID, plan.GameSlug = v.BotID, v.Version, v.AuthorID, v.GameSlug
+	if err := Verifications.Create(plan); err != nil {
+		return nil, 0, errors.Wrap(err, "can not create verification")
+	}
+
+	var firstJobID int64
+	for i, m := range plan.Matches {
+		task := verificationTask(plan.GameSlug, bot, opponents[i], m)
+		jobID, err := runVerificationMatch(plan, m, task, 1)
+		if err != nil {
+			logger.Error(errors.Wrap(err, "can not call verify rpc"))
+			finishVerificationMatch(plan, m, verificationError, sql.NullInt64{}, err.Error(), h.broadcast)
+			continue
+		}
+		if firstJobID == 0 {
+			firstJobID = jobID
+		}
+	}
+
+	return plan, firstJobID, nil
+}
+
+// runVerificationMatch отправка матча проверки тестерам отдельной задачей, attempt -- номер попытки
+func runVerificationMatch(v *VerificationModel, m *VerificationMatchModel, task *TestTask, attempt int) (int64, error) {
+	job := &JobModel{
+		Type:     jobVerify,
+		GameSlug: v.GameSlug,
+		Bot1:     v.BotID,
+		Version1: v.Version,
+		Author1:  v.AuthorID,
+		Attempts: int64(attempt),
+	}
+	events, err := startJob(job, task)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = Verifications.SetMatchJob(v.ID, m.Position, job.ID); err != nil {
+		logger.Error(errors.Wrap(err, "can not set verification match job"))
+	}
+	go processVerificationMatch(v, m, task, attempt, h.broadcast, events)
+
+	return job.ID, nil
+}
+
+// matchOutcome исход матча для бота, игравшего за side
+func matchOutcome(winner int, side int64) string {
+	switch {
+	case winner == 0:
+		return verificationDraw
+	case winner == int(side):
+		return verificationWin
+	case winner == 1 || winner == 2:
+		return verificationLoss
+	}
+
+	return verificationError
+}
+
+// processVerificationMatch обработка ответа тестеров на матч проверки.
+// Матч сохраняется так, будто проверяемый бот играл первым: результат,
+// ошибка и логи берутся с его стороны. Если тестеры не смогли сыграть матч,
+// он отправляется заново, пока не кончатся попытки, а потом записывается несыгранным
+func processVerificationMatch(v *VerificationModel, m *VerificationMatchModel, task *TestTask, attempt int,
+	broadcast chan<- *BotStatusMessage, events <-chan *TesterStatusQueue) {
+	logger := logger.WithFields(logrus.Fields{
+		"bot_id":          v.BotID,
+		"version":         v.Version,
+		"verification_id": v.ID,
+		"position":        m.Position,
+		"attempt":         attempt,
+		"method":          "processVerificationMatch",
+	})
+
+	for event := range events {
+		logger.Infof("Processing [%s]", event.Type)
+		switch event.Type {
+		case "status":
+			continue
+		case "result":
+			res := &TesterStatusResult{}
+			if err := json.Unmarshal(event.Body, res); err != nil {
+				logger.Error(errors.Wrap(err, "can not unmarshal result status body"))
+				continue
+			}
+
+			botErr, botLog := res.playerError(0), res.playerLog(0)
+			outcome := matchOutcome(res.Winner, m.Side)
+			result := res.Winner
+			if m.Side == 2 {
+				botErr, botLog = res.playerError(1), res.playerLog(1)
+				if result == 1 || result == 2 {
+					result = 3 - result
+				}
+			}
+
+			match := &MatchModel{
+				Info:     res.Info,
+				States:   res.States,
+				Result:   result,
+				GameSlug: v.GameSlug,
+				Bot1:     v.BotID,
+				Error1:   sql.NullString{String: botErr, Valid: botErr != ""},
+				Author1:  v.AuthorID,
+				Log1:     botLog,
+				Version1: v.Version,
+			}
+			if err := Matches.Create(match); err != nil {
+				logger.Error(errors.Wrap(err, "can not save match"))
+				continue
+			}
+			broadcastVerificationMatch(logger, v, match, broadcast)
+
+			finishVerificationMatch(v, m, outcome, sql.NullInt64{Int64: match.ID, Valid: true}, botErr, broadcast)
+		case "error", "timeout":
+			res := &TesterStatusError{}
+			if err := json.Unmarshal(event.Body, res); err != nil {
+				logger.Error(errors.Wrap(err, "can not unmarshal result status body"))
+				continue
+			}
+
+			if attempt >= verificationMatchAttempts {
+				logger.Errorf("testers failed the match %d times: %s", attempt, res.Error)
+				finishVerificationMatch(v, m, verificationError, sql.NullInt64{}, res.Error, broadcast)
+				continue
+			}
+			logger.Warnf("testers failed the match, retrying: %s", res.Error)
+			if _, err := runVerificationMatch(v, m, task, attempt+1); err != nil {
+				logger.Error(errors.Wrap(err, "can not call verify rpc"))
+				finishVerificationMatch(v, m, verificationError, sql.NullInt64{}, err.Error(), broadcast)
+			}
+		default:
+			logger.Error(errors.New("can not process unknown status type"))
+		}
+	}
+}
+
+func broadcastVerificationMatch(logger *logrus.Entry, v *VerificationModel, m *MatchModel,
+	broadcast chan<- *BotStatusMessage) {
+	authorInfo, err := authGPRC.GetUserByID(context.Background(), &models.UserID{ID: v.AuthorID})
+	if err != nil {
+		logger.Error(errors.Wrap(err, "can not get user info"))
+		return
+	}
+
+	body, err := json.Marshal(&MatchInfo{
+		ID:       m.ID,
+		Result:   m.Result,
+		GameSlug: m.GameSlug,
+		Author1: &AuthorInfo{
+			ID:        authorInfo.ID,
+			Username:  authorInfo.Username,
+			PhotoUUID: authorInfo.PhotoUUID,
+			Active:    authorInfo.Active,
+		},
+		Bot1ID:   v.BotID,
+		Version1: v.Version,
+	})
+	if err != nil {
+		logger.Error(errors.Wrap(err, "can marshal match info"))
+		return
+	}
+
+	broadcast <- &BotStatusMessage{
+		AuthorID: v.AuthorID,
+		GameSlug: v.GameSlug,
+		Body:     body,
+		Type:     "match",
+	}
+}
+
+// finishVerificationMatch запись исхода матча проверки; последний нужный
+// для итога матч выставляет версии бота статус проверки и уведомляет автора
+func finishVerificationMatch(v *VerificationModel, m *VerificationMatchModel, outcome string,
+	matchID sql.NullInt64, errText string, broadcast chan<- *BotStatusMessage) {
+	logger := logger.WithFields(logrus.Fields{
+		"bot_id":          v.BotID,
+		"version":         v.Version,
+		"verification_id": v.ID,
+		"method":          "finishVerificationMatch",
+	})
+
+	finished, done, err := Verifications.FinishMatch(v.ID, m.Position, outcome, matchID, errText)
+	if err != nil {
+		logger.Error(errors.Wrap(err, "can not save verification match outcome"))
+		return
+	}
+	if !done {
+		return
+	}
+	logger.Infof("verification is %s", finished.Status)
+
+	passed := finished.Status == verificationPassed
+	initial := Rating{}
+	if passed {
+		// очки выдаются только при первой проверке, новая версия их сохраняет
+		initial = ratingSystemFor(v.GameSlug).Initial()
+	}
+	if err = Bots.SetVersionVerified(v.BotID, v.Version, passed, initial); err != nil {
+		if errors.Cause(err) != utils.ErrTaken {
+			logger.Error(errors.Wrap(err, "can update bot verified status"))
+			return
+		}
+
+		// версия не может стать кодом бота, автор узнает, что она не проверена
+		logger.Warn(errors.Wrap(err, "can not activate verified version"))
+		passed = false
+	}
+	if passed {
+		// код версии стал кодом бота -- сравниваем его заново
+		if bot, err := Bots.GetBotByID(v.BotID); err != nil {
+			logger.Error(errors.Wrap(err, "can not get bot for similarity check"))
+		} else {
+			go checkSimilarity(bot)
+		}
+	}
+
+	newStatus := "Not Verifyed\n"
+	if passed {
+		newStatus = "Verifyed\n"
+	}
+	body, _ := json.Marshal(&BotStatus{
+		BotID:     v.BotID,
+		Version:   v.Version,
+		NewStatus: newStatus,
+	})
+	broadcast <- &BotStatusMessage{
+		AuthorID: v.AuthorID,
+		GameSlug: v.GameSlug,
+		Body:     body,
+		Type:     "verify",
+	}
+
+	notifyBody, err := json.Marshal(&NotifyVerifyMessage{
+		BotID:          v.BotID,
+		Version:        v.Version,
+		GameSlug:       v.GameSlug,
+		MatchID:        matchID.Int64,
+		VerificationID: v.ID,
+		Veryfied:       passed,
+	})
+	if err != nil {
+		logger.Error(errors.Wrap(err, "can not marshal notify body"))
+		return
+	}
+
+	_, err = notifyGRPC.SendNotify(context.Background(), &models.Message{
+		Type: "verify",
+		User: v.AuthorID,
+		Game: v.GameSlug,
+		Body: notifyBody,
+	})
+	if err != nil {
+		logger.Error(errors.Wrap(err, "can send notify to author"))
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+func newVerification(v *VerificationModel) *Verification {
+	verification := &Verification{
+		ID:           v.ID,
+		BotID:        v.BotID,
+		Version:      v.Version,
+		GameSlug:     v.GameSlug,
+		Status:       v.Status,
+		MinNonLosses: v.MinNonLosses,
+		AllowErrors:  v.AllowErrors,
+		Matches:      make([]*VerificationMatch, len(v.Matches)),
+		Created:      v.Created,
+	}
+	if v.Finished.Valid {
+		finished := v.Finished.Time
+		verification.Finished = &finished
+	}
+
+	for i, m := range v.Matches {
+		verification.Matches[i] = &VerificationMatch{
+			Position: m.Position,
+			Opponent: m.Opponent,
+			Side:     m.Side,
+			Outcome:  m.Outcome,
+			MatchID:  m.MatchID.Int64,
+			JobID:    m.JobID.Int64,
+			Error:    m.Error.String,
+		}
+		if m.Seed.Valid {
+			seed := m.Seed.Int64
+			verification.Matches[i].Seed = &seed
+		}
+	}
+
+	return verification
+}
+
+// GetVerification отчёт о проверке версии бота со всеми матчами набора
+func GetVerification(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger(r, logger, "GetVerification")
+	errWriter := utils.NewErrorResponseWriter(w, logger)
+
+	verificationID, err := strconv.ParseInt(mux.Vars(r)["verification_id"], 10, 64)
+	if err != nil {
+		errWriter.WriteWarn(http.StatusNotFound, errors.Wrap(err, "wrong format verification_id"))
+		return
+	}
+
+	verification, err := Verifications.GetVerificationByID(verificationID)
+	if err != nil {
+		if errors.Cause(err) == utils.ErrNotExists {
+			errWriter.WriteWarn(http.StatusNotFound, errors.Wrap(err, "verification not exists"))
+		} else {
+			errWriter.WriteError(http.StatusInternalServerError, errors.Wrap(err, "get verification method error"))
+		}
+		return
+	}
+
+	utils.WriteApplicationJSON(w, http.StatusOK, newVerification(verification))
+}
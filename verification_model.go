@@ -0,0 +1,302 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/HotCodeGroup/warscript-utils/utils"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const (
+	verificationRunning = "running"
+	verificationPassed  = "passed"
+	verificationFailed  = "failed"
+
+	// исходы матча проверки для проверяемого бота
+	verificationPending = "pending"
+	verificationWin     = "win"
+	verificationDraw    = "draw"
+	verificationLoss    = "loss"
+	// verificationError матч не удалось сыграть: тестеры не справились за все попытки
+	// или вернули результат, по которому нельзя понять исход
+	verificationError = "error"
+)
+
+// VerificationAccessObject DAO for Verification model
+type VerificationAccessObject interface {
+	Create(v *VerificationModel) error
+	SetMatchJob(verificationID, position, jobID int64) error
+	FinishMatch(verificationID, position int64, outcome string,
+		matchID sql.NullInt64, errText string) (*VerificationModel, bool, error)
+	GetVerificationByID(verificationID int64) (*VerificationModel, error)
+	GetVerificationByJob(jobID int64) (*VerificationModel, *VerificationMatchModel, error)
+}
+
+// VerificationObject implementation of VerificationAccessObject
+type VerificationObject struct{}
+
+// Verifications объект для обращения с моделью verification
+var Verifications VerificationAccessObject
+
+func init() {
+	Verifications = &VerificationObject{}
+}
+
+// VerificationModel model for verifications table.
+// Критерии прохождения сохраняются вместе с проверкой, чтобы смена настроек
+// игры не меняла правила для уже идущих проверок
+type VerificationModel struct {
+	ID           int64
+	BotID        int64
+	Version      int64
+	AuthorID     int64
+	GameSlug     string
+	Status       string
+	MinNonLosses int64
+	AllowErrors  bool
+	Created      time.Time
+	Finished     pq.NullTime
+
+	Matches []*VerificationMatchModel
+}
+
+// VerificationMatchModel model for verification_matches table
+type VerificationMatchModel struct {
+	VerificationID int64
+	// Position номер матча в наборе, с 1
+	Position int64
+	// Opponent имя эталонного бота
+	Opponent string
+	// Side за какого игрока задачи играет проверяемый бот: 1 или 2
+	Side    int64
+	Seed    sql.NullInt64
+	JobID   sql.NullInt64
+	MatchID sql.NullInt64
+	Outcome string
+	// Error ошибка исполнения проверяемого бота
+	Error sql.NullString
+}
+
+// verdict итог проверки по уже сыгранным матчам. Пока исход не ясен -- running;
+// провал становится ясен раньше, чем сыграны все матчи. Ошибкой бота считается только
+// ошибка исполнения в сыгранном матче. Несыгранный матч проваливает проверку всегда:
+// версия, которую не удалось проверить, не становится проверенной
+func (v *VerificationModel) verdict() string {
+	var nonLosses, pending, errs, unplayable int64
+	for _, m := range v.Matches {
+		switch m.Outcome {
+		case verificationPending:
+			pending++
+		case verificationWin, verificationDraw:
+			nonLosses++
+		case verificationError:
+			unplayable++
+		}
+		if m.Error.Valid && m.Outcome != verificationPending && m.Outcome != verificationError {
+			errs++
+		}
+	}
+
+	if unplayable > 0 {
+		return verificationFailed
+	}
+	if errs > 0 && !v.AllowErrors {
+		return verificationFailed
+	}
+	if nonLosses+pending < v.MinNonLosses {
+		return verificationFailed
+	}
+	if pending > 0 {
+		return verificationRunning
+	}
+
+	return verificationPassed
+}
+
+const verificationFields = `v.id, v.bot_id, v.version, v.author_id, v.game_slug, v.status,
+	v.min_non_losses, v.allow_errors, v.created, v.finished`
+
+const verificationMatchFields = `m.verification_id, m.position, m.opponent, m.side, m.seed,
+	m.job_id, m.match_id, m.outcome, m.error`
+
+func scanVerification(row rowScanner) (*VerificationModel, error) {
+	v := &VerificationModel{}
+	err := row.Scan(&v.ID, &v.BotID, &v.Version, &v.AuthorID, &v.GameSlug, &v.Status,
+		&v.MinNonLosses, &v.AllowErrors, &v.Created, &v.Finished)
+
+	return v, err
+}
+
+func scanVerificationMatch(row rowScanner) (*VerificationMatchModel, error) {
+	m := &VerificationMatchModel{}
+	err := row.Scan(&m.VerificationID, &m.Position, &m.Opponent, &m.Side, &m.Seed,
+		&m.JobID, &m.MatchID, &m.Outcome, &m.Error)
+
+	return m, err
+}
+
+// queryer соединение или транзакция
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func getVerificationMatches(q queryer, verificationID int64) ([]*VerificationMatchModel, error) {
+	rows, err := q.Query(`SELECT `+verificationMatchFields+` FROM verification_matches m
+		WHERE m.verification_id = $1 ORDER BY m.position;`, verificationID)
+	if err != nil {
+		return nil, errors.Wrapf(utils.ErrInternal, "get verification matches error: %v", err)
+	}
+	defer rows.Close()
+
+	matches := make([]*VerificationMatchModel, 0)
+	for rows.Next() {
+		m, err := scanVerificationMatch(rows)
+		if err != nil {
+			return nil, errors.Wrapf(utils.ErrInternal, "get verification matches scan error: %v", err)
+		}
+		matches = append(matches, m)
+	}
+
+	return matches, nil
+}
+
+// Create создание проверки вместе с набором её матчей
+func (o *VerificationObject) Create(v *VerificationModel) error {
+	tx, err := pqConn.Begin()
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not open verification create transaction: %s", err.Error())
+	}
+	//nolint: errcheck
+	defer tx.Rollback()
+
+	v.Status = verificationRunning
+	row := tx.QueryRow(`INSERT INTO verifications (bot_id, version, author_id, game_slug, status,
+		min_non_losses, allow_errors) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created;`,
+		v.BotID, v.Version, v.AuthorID, v.GameSlug, v.Status, v.MinNonLosses, v.AllowErrors)
+	if err = row.Scan(&v.ID, &v.Created); err != nil {
+		return errors.Wrapf(utils.ErrInternal, "create verification row error: %v", err)
+	}
+
+	for _, m := range v.Matches {
+		m.VerificationID, m.Outcome = v.ID, verificationPending
+		_, err = tx.Exec(`INSERT INTO verification_matches (verification_id, position, opponent, side, seed, outcome)
+			VALUES ($1, $2, $3, $4, $5, $6);`, m.VerificationID, m.Position, m.Opponent, m.Side, m.Seed, m.Outcome)
+		if err != nil {
+			return errors.Wrapf(utils.ErrInternal, "create verification match row error: %v", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not commit verification create transaction: %v", err)
+	}
+
+	return nil
+}
+
+// SetMatchJob привязка задачи тестерам к матчу проверки
+func (o *VerificationObject) SetMatchJob(verificationID, position, jobID int64) error {
+	_, err := pqConn.Exec(`UPDATE verification_matches SET job_id = $3
+		WHERE verification_id = $1 AND position = $2;`, verificationID, position, jobID)
+	if err != nil {
+		return errors.Wrapf(utils.ErrInternal, "can not set verification match job: %v", err)
+	}
+
+	return nil
+}
+
+// FinishMatch запись исхода матча проверки. Если после него итог проверки стал ясен,
+// проверка завершается; второй результат возвращает true только тому вызову,
+// который её завершил. Повторный исход того же матча игнорируется
+func (o *VerificationObject) FinishMatch(verificationID, position int64, outcome string,
+	matchID sql.NullInt64, errText string) (*VerificationModel, bool, error) {
+	tx, err := pqConn.Begin()
+	if err != nil {
+		return nil, false, errors.Wrapf(utils.ErrInternal, "can not open verification match transaction: %s", err.Error())
+	}
+	//nolint: errcheck
+	defer tx.Rollback()
+
+	row := tx.QueryRow(`SELECT `+verificationFields+` FROM verifications v
+		WHERE v.id = $1 FOR UPDATE;`, verificationID)
+	v, err := scanVerification(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, errors.Wrapf(utils.ErrNotExists, "verification does not exist: %v", err)
+		}
+
+		return nil, false, errors.Wrapf(utils.ErrInternal, "can not get verification: %v", err)
+	}
+
+	_, err = tx.Exec(`UPDATE verification_matches SET outcome = $3, match_id = $4, error = $5
+		WHERE verification_id = $1 AND position = $2 AND outcome = $6;`, verificationID, position,
+		outcome, matchID, sql.NullString{String: errText, Valid: errText != ""}, verificationPending)
+	if err != nil {
+		return nil, false, errors.Wrapf(utils.ErrInternal, "can not update verification match: %v", err)
+	}
+
+	if v.Matches, err = getVerificationMatches(tx, verificationID); err != nil {
+		return nil, false, err
+	}
+
+	finished := false
+	if v.Status == verificationRunning {
+		if status := v.verdict(); status != verificationRunning {
+			row = tx.QueryRow(`UPDATE verifications SET status = $2, finished = now()
+				WHERE id = $1 RETURNING finished;`, verificationID, status)
+			if err = row.Scan(&v.Finished); err != nil {
+				return nil, false, errors.Wrapf(utils.ErrInternal, "can not finish verification: %v", err)
+			}
+			v.Status, finished = status, true
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, false, errors.Wrapf(utils.ErrInternal, "can not commit verification match transaction: %v", err)
+	}
+
+	return v, finished, nil
+}
+
+// GetVerificationByID получение проверки со всеми её матчами
+func (o *VerificationObject) GetVerificationByID(verificationID int64) (*VerificationModel, error) {
+	row := pqConn.QueryRow(`SELECT `+verificationFields+` FROM verifications v WHERE v.id = $1;`, verificationID)
+	v, err := scanVerification(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.Wrapf(utils.ErrNotExists, "verification with this id does not exist: %v", err)
+		}
+
+		return nil, errors.Wrapf(utils.ErrInternal, "can not get verification by id: %v", err)
+	}
+
+	if v.Matches, err = getVerificationMatches(pqConn, verificationID); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// GetVerificationByJob проверка и её матч, который играется задачей jobID
+func (o *VerificationObject) GetVerificationByJob(jobID int64) (*VerificationModel, *VerificationMatchModel, error) {
+	row := pqConn.QueryRow(`SELECT `+verificationMatchFields+` FROM verification_matches m
+		WHERE m.job_id = $1;`, jobID)
+	m, err := scanVerificationMatch(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, errors.Wrapf(utils.ErrNotExists, "no verification match for job: %v", err)
+		}
+
+		return nil, nil, errors.Wrapf(utils.ErrInternal, "can not get verification match by job: %v", err)
+	}
+
+	v, err := o.GetVerificationByID(m.VerificationID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return v, m, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var (
+	verificationColumns = []string{"id", "bot_id", "version", "author_id", "game_slug", "status",
+		"min_non_losses", "allow_errors", "created", "finished"}
+	verificationMatchColumns = []string{"verification_id", "position", "opponent", "side", "seed",
+		"job_id", "match_id", "outcome", "error"}
+)
+
+func TestFinishMatchCompletesVerification(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(verificationColumns).
+			AddRow(1, 2, 3, 4, "pong", verificationRunning, 1, false, now, nil))
+	mock.ExpectExec("UPDATE verification_matches").
+		WithArgs(1, 2, verificationWin, 10, nil, verificationPending).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(verificationMatchColumns).
+			AddRow(1, 1, "system", 1, nil, 5, 9, verificationLoss, nil).
+			AddRow(1, 2, "system", 2, nil, 6, 10, verificationWin, nil))
+	mock.ExpectQuery("UPDATE verifications").
+		WithArgs(1, verificationPassed).
+		WillReturnRows(sqlmock.NewRows([]string{"finished"}).AddRow(now))
+	mock.ExpectCommit()
+
+	pqConn = db
+	Verifications = &VerificationObject{}
+
+	v, finished, err := Verifications.FinishMatch(1, 2, verificationWin, sql.NullInt64{Int64: 10, Valid: true}, "")
+	if err != nil {
+		t.Fatalf("TestFinishMatchCompletesVerification got unexpected error: %v", err)
+	}
+	if !finished || v.Status != verificationPassed || len(v.Matches) != 2 {
+		t.Errorf("TestFinishMatchCompletesVerification got unexpected result: %v, %+v", finished, v)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestFinishMatchCompletesVerification there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFinishMatchAlreadyFinished(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(verificationColumns).
+			AddRow(1, 2, 3, 4, "pong", verificationFailed, 1, false, now, now))
+	mock.ExpectExec("UPDATE verification_matches").
+		WithArgs(1, 2, verificationWin, 10, nil, verificationPending).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(verificationMatchColumns).
+			AddRow(1, 1, "system", 1, nil, 5, 9, verificationError, "timeout").
+			AddRow(1, 2, "system", 2, nil, 6, 10, verificationWin, nil))
+	mock.ExpectCommit()
+
+	pqConn = db
+	Verifications = &VerificationObject{}
+
+	// итог уже подведён, поздний матч только записывается
+	v, finished, err := Verifications.FinishMatch(1, 2, verificationWin, sql.NullInt64{Int64: 10, Valid: true}, "")
+	if err != nil || finished || v.Status != verificationFailed {
+		t.Errorf("TestFinishMatchAlreadyFinished got unexpected result: %v, %+v, %v", finished, v, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("TestFinishMatchAlreadyFinished there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestPlanVerificationDefault(t *testing.T) {
+	v, players := planVerification(defaultVerification, "system code")
+	if len(v.Matches) != 1 || len(players) != 1 {
+		t.Fatalf("TestPlanVerificationDefault got %d matches, expected 1", len(v.Matches))
+	}
+
+	m := v.Matches[0]
+	if m.Opponent != systemOpponent || m.Side != 1 || m.Seed.Valid || players[0].Code != "system code" {
+		t.Errorf("TestPlanVerificationDefault got unexpected match: %+v, %+v", m, players[0])
+	}
+	if v.MinNonLosses != 1 || !v.AllowErrors {
+		t.Errorf("TestPlanVerificationDefault got unexpected criteria: %+v", v)
+	}
+}
+
+func TestPlanVerificationSuite(t *testing.T) {
+	minNonLosses := int64(5)
+	v, players := planVerification(&VerificationConfig{
+		Opponents: []*ReferenceBot{
+			{Name: systemOpponent},
+			{Name: "greedy", Code: "greedy code", Lang: "PY"},
+		},
+		BothSides:    true,
+		Seeds:        []int64{1, 2},
+		MinNonLosses: &minNonLosses,
+	}, "system code")
+	if len(v.Matches) != 8 || len(players) != 8 {
+		t.Fatalf("TestPlanVerificationSuite got %d matches, expected 8", len(v.Matches))
+	}
+
+	last := v.Matches[7]
+	if last.Position != 8 || last.Opponent != "greedy" || last.Side != 2 || last.Seed.Int64 != 2 {
+		t.Errorf("TestPlanVerificationSuite got unexpected last match: %+v", last)
+	}
+	if players[7].Lang != "PY" || players[0].Lang != systemBotLanguage {
+		t.Errorf("TestPlanVerificationSuite got unexpected opponents: %+v, %+v", players[0], players[7])
+	}
+
+	task := verificationTask("pong", &TestPlayer{Code: "bot"}, players[7], last)
+	if task.Code2 != "bot" || task.Code1 != "greedy code" || task.Seed == nil || *task.Seed != 2 {
+		t.Errorf("TestPlanVerificationSuite got unexpected task: %+v", task)
+	}
+}
+
+func TestVerificationConfigValidate(t *testing.T) {
+	minNonLosses := int64(3)
+	config := &VerificationConfig{Seeds: []int64{1, 2}, MinNonLosses: &minNonLosses}
+	if err := config.validate(); err == nil {
+		t.Errorf("TestVerificationConfigValidate accepted %d non-losses of 2 matches", minNonLosses)
+	}
+
+	config.BothSides = true
+	if err := config.validate(); err != nil {
+		t.Errorf("TestVerificationConfigValidate got unexpected error: %v", err)
+	}
+}
+
+func TestMatchOutcome(t *testing.T) {
+	cases := []struct {
+		winner int
+		side   int64
+		want   string
+	}{
+		{1, 1, verificationWin},
+		{2, 1, verificationLoss},
+		{2, 2, verificationWin},
+		{1, 2, verificationLoss},
+		{0, 2, verificationDraw},
+		{3, 1, verificationError},
+	}
+
+	for _, c := range cases {
+		if got := matchOutcome(c.winner, c.side); got != c.want {
+			t.Errorf("TestMatchOutcome(%d, %d) got %s, expected %s", c.winner, c.side, got, c.want)
+		}
+	}
+}
+
+func TestVerificationVerdict(t *testing.T) {
+	match := func(outcome, err string) *VerificationMatchModel {
+		return &VerificationMatchModel{Outcome: outcome, Error: sql.NullString{String: err, Valid: err != ""}}
+	}
+
+	v := &VerificationModel{MinNonLosses: 2, Matches: []*VerificationMatchModel{
+		match(verificationWin, ""), match(verificationPending, ""), match(verificationPending, ""),
+	}}
+	if got := v.verdict(); got != verificationRunning {
+		t.Errorf("TestVerificationVerdict got %s with pending matches", got)
+	}
+
+	// одного поражения мало для провала, двух -- достаточно
+	v.Matches[1].Outcome = verificationLoss
+	if got := v.verdict(); got != verificationRunning {
+		t.Errorf("TestVerificationVerdict got %s, expected running", got)
+	}
+	v.Matches[2].Outcome = verificationLoss
+	if got := v.verdict(); got != verificationFailed {
+		t.Errorf("TestVerificationVerdict got %s, expected failed", got)
+	}
+
+	v.Matches[2].Outcome = verificationDraw
+	if got := v.verdict(); got != verificationPassed {
+		t.Errorf("TestVerificationVerdict got %s, expected passed", got)
+	}
+
+	// ошибка исполнения проваливает проверку, если ошибки не разрешены
+	v.Matches[2].Error = sql.NullString{String: "ReferenceError", Valid: true}
+	if got := v.verdict(); got != verificationFailed {
+		t.Errorf("TestVerificationVerdict got %s with runtime error", got)
+	}
+	v.AllowErrors = true
+	if got := v.verdict(); got != verificationPassed {
+		t.Errorf("TestVerificationVerdict got %s with allowed runtime error", got)
+	}
+
+	// матч, который тестеры так и не сыграли, проваливает проверку, даже если ошибки разрешены
+	v.Matches[2] = match(verificationError, "tester timeout")
+	v.Matches[1].Outcome = verificationWin
+	if got := v.verdict(); got != verificationFailed {
+		t.Errorf("TestVerificationVerdict got %s with unplayable match", got)
+	}
+}
@@ -1,22 +1,69 @@
 package main
 
 import (
-	"context"
-	"database/sql"
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
 
-	"github.com/HotCodeGroup/warscript-utils/models"
-	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/streadway/amqp"
 
 	"github.com/sirupsen/logrus"
 )
 
 const (
-	testerQueueName = "tester_rpc_queue"
+	// очереди тестеров объявляются с x-max-priority. Старые очереди без приоритетов
+	// (tester_rpc_queue и другие) брокер не даст объявить заново с другими аргументами,
+	// поэтому у очередей с приоритетами свои имена
+	testerQueueName = "tester_rpc_priority_queue"
+	// mixedTesterQueueName очередь тестеров со всеми рантаймами, для матчей между языками
+	mixedTesterQueueName = "tester_rpc_priority_queue_mixed"
+	// systemBotLanguage язык системных ботов из сервиса игр
+	systemBotLanguage Lang = "JS"
+
+	// testerTaskTimeout сколько ждём ответа тестера на одну попытку
+	testerTaskTimeout = 2 * time.Minute
+	// testerIdleTimeout сколько ждём следующего ответа тестера, который уже взял задачу:
+	// если тестер упал посреди матча, результата не будет
+	testerIdleTimeout = 10 * time.Minute
+	// testerMaxAttempts сколько раз публикуется задача, прежде чем уйти в dead letter
+	testerMaxAttempts = 3
+	// testerTaskTTL сколько задача живёт в очереди тестеров: все попытки вместе
+	testerTaskTTL = testerMaxAttempts * testerTaskTimeout
+	// deadLetterQueueName задачи, на которые тестеры так и не ответили
+	deadLetterQueueName = "tester_rpc_queue_dead"
+
+	// приоритеты задач в очередях тестеров: проверка нового кода идёт раньше
+	// матчей, запрошенных пользователями, а те -- раньше фоновых рейтинговых
+	testerPriorityLadder uint8 = 1
+	testerPriorityUser   uint8 = 5
+	testerPriorityVerify uint8 = 9
+	// testerMaxPriority x-max-priority очередей тестеров
+	testerMaxPriority = testerPriorityVerify
 )
 
+var (
+	testerRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tester_task_retries_total",
+		Help: "Number of tester tasks republished after a timeout",
+	}, []string{"queue"})
+	testerDeadLetters = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tester_task_dead_letters_total",
+		Help: "Number of tester tasks moved to the dead letter queue",
+	}, []string{"queue"})
+	testerWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tester_task_wait_seconds",
+		Help:    "Time from publishing a tester task to the first tester answer",
+		Buckets: []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"queue", "priority"})
+)
+
+func init() {
+	prometheus.MustRegister(testerRetries, testerDeadLetters, testerWait)
+}
+
 // TesterStatusQueue сообщение полученное из очереди задач
 type TesterStatusQueue struct {
 	Type string          `json:"type"`
@@ -28,12 +75,15 @@ type TesterStatusUpdate struct {
 	NewStatus string `json:"new_status"`
 }
 
-// TesterStatusError ошибка полученная из очереди задач
+// TesterStatusError ошибка полученная из очереди задач.
+// С тем же телом приходит событие timeout, если тестеры так и не ответили
 type TesterStatusError struct {
 	Error string `json:"error"`
 }
 
-// TesterStatusResult результат матча полученный из очереди задач
+// TesterStatusResult результат матча полученный из очереди задач.
+// Матч на двоих описывают Winner и поля *1, *2; матч на нескольких игроков --
+// Placements, Errors и Logs в порядке игроков задачи
 type TesterStatusResult struct {
 	Info   json.RawMessage `json:"info"`
 	States json.RawMessage `json:"states"`
@@ -42,17 +92,177 @@ type TesterStatusResult struct {
 	Error2 string          `json:"error_2"`
 	Logs1  json.RawMessage `json:"logs_1"`
 	Logs2  json.RawMessage `json:"logs_2"`
+
+	// Placements места игроков: 1 -- лучший, одинаковые места -- ничья между ними
+	Placements []int             `json:"placements"`
+	Errors     []string          `json:"errors"`
+	Logs       []json.RawMessage `json:"logs"`
+}
+
+// placements места n игроков. Старые тестеры для матча на двоих присылают только Winner
+func (res *TesterStatusResult) placements(n int) ([]int, bool) {
+	if len(res.Placements) == n {
+		for _, p := range res.Placements {
+			if p < 1 || p > n {
+				return nil, false
+			}
+		}
+		return res.Placements, true
+	}
+	if n != 2 {
+		return nil, false
+	}
+
+	switch res.Winner {
+	case 0:
+		return []int{1, 1}, true
+	case 1:
+		return []int{1, 2}, true
+	case 2:
+		return []int{2, 1}, true
+	}
+
+	return nil, false
+}
+
+// playerError ошибка игрока i (с 0)
+func (res *TesterStatusResult) playerError(i int) string {
+	if i < len(res.Errors) {
+		return res.Errors[i]
+	}
+
+	switch i {
+	case 0:
+		return res.Error1
+	case 1:
+		return res.Error2
+	}
+
+	return ""
+}
+
+// playerLog лог игрока i (с 0)
+func (res *TesterStatusResult) playerLog(i int) json.RawMessage {
+	if i < len(res.Logs) {
+		return res.Logs[i]
+	}
+
+	switch i {
+	case 0:
+		return res.Logs1
+	case 1:
+		return res.Logs2
+	}
+
+	return nil
 }
 
-// TestTask представление задачи на проверку, которое кладётся в очередь задач
+// TestPlayer игрок матча в задаче тестерам
+type TestPlayer struct {
+	Code string `json:"code"`
+	Lang Lang   `json:"lang"`
+}
+
+// TestTask представление задачи на проверку, которое кладётся в очередь задач.
+// Игроки могут быть написаны на разных языках. Players -- все игроки по порядку;
+// первые два продублированы в Code1, Code2 для тестеров, которые умеют только матчи на двоих
 type TestTask struct {
-	Code1    string `json:"code1"`
-	Code2    string `json:"code2"`
-	GameSlug string `json:"game_slug"`
-	Language Lang   `json:"lang"`
+	Code1    string        `json:"code1"`
+	Lang1    Lang          `json:"lang1"`
+	Code2    string        `json:"code2"`
+	Lang2    Lang          `json:"lang2"`
+	Players  []*TestPlayer `json:"players,omitempty"`
+	GameSlug string        `json:"game_slug"`
+	// Seed сид матча для воспроизводимых проверок; без него тестер выбирает сам
+	Seed *int64 `json:"seed,omitempty"`
+}
+
+func newTestTask(gameSlug string, players ...*TestPlayer) *TestTask {
+	task := &TestTask{
+		Players:  players,
+		GameSlug: gameSlug,
+	}
+	if len(players) > 0 {
+		task.Code1, task.Lang1 = players[0].Code, players[0].Lang
+	}
+	if len(players) > 1 {
+		task.Code2, task.Lang2 = players[1].Code, players[1].Lang
+	}
+
+	return task
+}
+
+// botPlayer игрок задачи из текущей версии бота
+func botPlayer(bot *BotModel) *TestPlayer {
+	return &TestPlayer{Code: bot.Code, Lang: Lang(bot.Language)}
+}
+
+// langs языки всех игроков задачи
+func (t *TestTask) langs() []Lang {
+	if len(t.Players) == 0 {
+		return []Lang{t.Lang1, t.Lang2}
+	}
+
+	langs := make([]Lang, len(t.Players))
+	for i, p := range t.Players {
+		langs[i] = p.Lang
+	}
+
+	return langs
 }
 
-func sendForVerifyRPC(task *TestTask) (<-chan *TesterStatusQueue, error) {
+// testerQueues все очереди тестеров: по рантаймам и общая
+func testerQueues() []string {
+	seen := map[string]bool{mixedTesterQueueName: true}
+	queues := []string{mixedTesterQueueName}
+	for _, lang := range availableLanguages {
+		if !seen[lang.Queue] {
+			seen[lang.Queue] = true
+			queues = append(queues, lang.Queue)
+		}
+	}
+
+	return queues
+}
+
+// declareTesterQueues объявление очередей тестеров с поддержкой приоритетов.
+// Тестеры должны объявлять их с тем же x-max-priority. Если очередь уже создана
+// без приоритетов (например, очередь языка из consul указывает на старое имя),
+// брокер отвечает PRECONDITION_FAILED и закрывает канал: без приоритетов
+// сервис не запускается, очередь нужно переименовать или пересоздать
+func declareTesterQueues(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return errors.Wrap(err, "can not open channel to declare tester queues")
+	}
+	//nolint: errcheck
+	defer ch.Close()
+
+	for _, queueName := range testerQueues() {
+		_, err = ch.QueueDeclare(
+			queueName,
+			true,
+			false,
+			false,
+			false,
+			amqp.Table{"x-max-priority": int32(testerMaxPriority)},
+		)
+		if err != nil {
+			return errors.Wrapf(err, "can not declare %s with priorities", queueName)
+		}
+	}
+
+	return nil
+}
+
+// sendForVerifyRPC отправка задачи тестерам. corrID -- correlation id задачи,
+// при возобновлении после рестарта используется тот же, что был записан в jobs
+func sendForVerifyRPC(task *TestTask, corrID string, priority uint8) (<-chan *TesterStatusQueue, error) {
+	queueName, err := testerQueue(task.langs()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not route task to tester")
+	}
+
 	respQ, err := rabbitChannel.QueueDeclare(
 		"", // пакет amqp сам сгенерит
 		false,
@@ -65,10 +275,9 @@ func sendForVerifyRPC(task *TestTask) (<-chan *TesterStatusQueue, error) {
 		return nil, errors.Wrap(err, "can not create queue for responses")
 	}
 
-	requestUUID := uuid.New().String()
 	resps, err := rabbitChannel.Consume(
 		respQ.Name,
-		requestUUID,
+		corrID,
 		true,
 		false,
 		false,
@@ -84,241 +293,208 @@ func sendForVerifyRPC(task *TestTask) (<-chan *TesterStatusQueue, error) {
 		return nil, errors.Wrap(err, "can not marshal bot info")
 	}
 
-	err = rabbitChannel.Publish(
-		"",
-		testerQueueName,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType:   "application/json",
-			CorrelationId: requestUUID,
-			ReplyTo:       respQ.Name,
-			Body:          body,
-		},
-	)
-	if err != nil {
-		return nil, errors.Wrap(err, "can not publish a message")
+	if err = publishTask(queueName, corrID, respQ.Name, body, priority); err != nil {
+		return nil, err
 	}
+	published := time.Now()
+	wait := testerWait.WithLabelValues(queueName, strconv.Itoa(int(priority)))
 
 	events := make(chan *TesterStatusQueue)
-	go func(in <-chan amqp.Delivery, out chan<- *TesterStatusQueue, corrID string) {
-		for resp := range in {
-			if corrID != resp.CorrelationId {
-				continue
+	logger := logger.WithFields(logrus.Fields{
+		"method":         "sendForVerifyRPC goroutine",
+		"correlation_id": corrID,
+	})
+	watch := &testerTaskWatch{
+		timeout:     testerTaskTimeout,
+		idle:        testerIdleTimeout,
+		maxAttempts: testerMaxAttempts,
+		taken: func() {
+			// ожидание в очереди считается от первой публикации
+			wait.Observe(time.Since(published).Seconds())
+		},
+		republish: func(attempt int) {
+			testerRetries.WithLabelValues(queueName).Inc()
+			logger.Warnf("tester did not answer in %s, attempt %d", testerTaskTimeout, attempt)
+			if err := publishTask(queueName, corrID, respQ.Name, body, priority); err != nil {
+				logger.Error(errors.Wrap(err, "can not republish task"))
 			}
-
-			testerResp := &TesterStatusQueue{}
-			err := json.Unmarshal(resp.Body, testerResp)
-			if err != nil {
-				logger.WithField("method", "sendForVerifyRPC goroutine").Error(errors.Wrap(err, "unmarshal tester response error"))
-				continue
+		},
+		giveUp: func(attempts int) {
+			logger.Errorf("tester did not answer after %d attempts, task is dead-lettered", attempts)
+			if err := deadLetterTask(queueName, corrID, body, attempts); err != nil {
+				logger.Error(errors.Wrap(err, "can not dead-letter task"))
 			}
-			out <- testerResp
-
-			if testerResp.Type == "result" || testerResp.Type == "error" {
-				// отцепились от очереди -- она удалилась
-				err = rabbitChannel.Cancel(
-					corrID,
-					false,
-				)
-				if err != nil {
-					logger.WithField("method", "sendForVerifyRPC goroutine").Error(errors.Wrap(err, "queue cancel error"))
-				}
+		},
+		cancel: func() {
+			// отцепились от очереди -- она удалилась
+			if err := rabbitChannel.Cancel(corrID, false); err != nil {
+				logger.Error(errors.Wrap(err, "queue cancel error"))
 			}
-		}
-
-		close(out)
-
-	}(resps, events, requestUUID)
+		},
+		logger: logger,
+	}
+	go watch.run(corrID, resps, events)
 
 	return events, nil
 }
 
-func processVerifyingStatus(botID, authorID int64, gameSlug string,
-	broadcast chan<- *BotStatusMessage, events <-chan *TesterStatusQueue) {
-
-	logger := logger.WithFields(logrus.Fields{
-		"bot_id": botID,
-		"method": "processVerifyingStatus",
-	})
-
-	status := ""
-	for event := range events {
-		logger.Infof("Processing [%s]", event.Type)
-		switch event.Type {
-		case "status":
-			continue
-		case "result":
-			res := &TesterStatusResult{}
-			err := json.Unmarshal(event.Body, res)
-			if err != nil {
-				logger.Error(errors.Wrap(err, "can not unmarshal result status body"))
-				continue
-			}
-
-			newStatus := "Not Verifyed\n"
-			if res.Winner == 1 {
-				newStatus = "Verifyed\n"
-			}
-
-			body, _ := json.Marshal(&BotStatus{
-				BotID:     botID,
-				NewStatus: newStatus,
-			})
-
-			broadcast <- &BotStatusMessage{
-				AuthorID: authorID,
-				GameSlug: gameSlug,
-				Body:     body,
-				Type:     "verify",
-			}
-
-			var diff int64
-			if res.Winner == 1 || res.Winner == 0 {
-				err = Bots.SetBotVerifiedByID(botID, true)
-				if err != nil {
-					logger.Error(errors.Wrap(err, "can update bot verified status"))
-					continue
-				}
-
-				err = Bots.SetBotScoreByID(botID, 400)
-				if err != nil {
-					logger.Error(errors.Wrap(err, "can update bot verified status"))
-					continue
-				}
-
-				diff = 400
-			}
+// testerTaskWatch ожидание ответов тестеров на одну задачу. Пока задачу никто
+// не взял, она публикуется заново каждые timeout, а после maxAttempts попыток
+// вместо ответа приходит событие timeout. Первый ответ тестера означает,
+// что задачу взяли: дальше матч может идти сколько угодно долго, пока тестер
+// отвечает хотя бы раз в idle. Замолчавший тестер тоже заканчивает задачу событием timeout
+type testerTaskWatch struct {
+	timeout     time.Duration
+	idle        time.Duration
+	maxAttempts int
+
+	// taken первый ответ тестера
+	taken func()
+	// republish повторная публикация, attempt -- номер новой попытки
+	republish func(attempt int)
+	// giveUp тестеры не взяли задачу ни с одной попытки
+	giveUp func(attempts int)
+	// cancel ответы по задаче больше не нужны
+	cancel func()
+
+	logger *logrus.Entry
+}
 
-			m := &MatchModel{
-				Info:     res.Info,
-				States:   res.States,
-				Result:   res.Winner,
-				GameSlug: gameSlug,
-				Bot1:     botID,
-				Error1:   sql.NullString{String: res.Error1, Valid: res.Error1 != ""},
-				Author1:  authorID,
-				Log1:     res.Logs1,
-				Diff1:    diff,
+func (w *testerTaskWatch) run(corrID string, in <-chan amqp.Delivery, out chan<- *TesterStatusQueue) {
+	defer close(out)
+
+	attempt, answered := 1, false
+	deadline := time.NewTimer(w.timeout)
+	defer deadline.Stop()
+	for {
+		select {
+		case resp, ok := <-in:
+			if !ok {
+				return
 			}
-			err = Matches.Create(m)
-			if err != nil {
-				logger.Error(errors.Wrap(err, "can not save match"))
+			if corrID != resp.CorrelationId {
 				continue
 			}
 
-			authorInfo, err := authGPRC.GetUserByID(context.Background(), &models.UserID{ID: authorID})
-			if err != nil {
-				logger.Error(errors.Wrap(err, "can not get user info"))
-				continue
+			if !deadline.Stop() {
+				<-deadline.C
 			}
-			ai1 := &AuthorInfo{
-				ID:        authorInfo.ID,
-				Username:  authorInfo.Username,
-				PhotoUUID: authorInfo.PhotoUUID,
-				Active:    authorInfo.Active,
+			deadline.Reset(w.idle)
+			if !answered {
+				answered = true
+				w.taken()
 			}
 
-			bodyBroadcast, err := json.Marshal(&MatchInfo{
-				ID:        m.ID,
-				Result:    m.Result,
-				GameSlug:  m.GameSlug,
-				Author1:   ai1,
-				Bot1ID:    botID,
-				NewScore1: diff,
-				Diff1:     diff,
-			})
+			testerResp := &TesterStatusQueue{}
+			err := json.Unmarshal(resp.Body, testerResp)
 			if err != nil {
-				logger.Error(errors.Wrap(err, "can marshal match info"))
+				w.logger.Error(errors.Wrap(err, "unmarshal tester response error"))
 				continue
 			}
+			out <- testerResp
 
-			broadcast <- &BotStatusMessage{
-				AuthorID: authorID,
-				GameSlug: gameSlug,
-				Body:     bodyBroadcast,
-				Type:     "match",
+			if testerResp.Type == "result" || testerResp.Type == "error" {
+				w.finish(in)
+				return
 			}
-
-			body1, err := json.Marshal(&NotifyVerifyMessage{
-				BotID:    botID,
-				GameSlug: gameSlug,
-				MatchID:  m.ID,
-				Veryfied: res.Winner == 1 || res.Winner == 0,
-			})
-			if err != nil {
-				logger.Error(errors.Wrap(err, "can not marshal body user1"))
-				continue
+		case <-deadline.C:
+			if answered {
+				w.logger.Errorf("tester stopped answering for %s", w.idle)
+				w.finish(in)
+				w.emitTimeout(out, fmt.Sprintf("tester timeout: no answer for %s after the task was taken", w.idle))
+				return
 			}
 
-			_, err = notifyGRPC.SendNotify(context.Background(), &models.Message{
-				Type: "verify",
-				User: authorID,
-				Game: gameSlug,
-				Body: body1,
-			})
-			if err != nil {
-				logger.Error(errors.Wrap(err, "can send notify to user1"))
+			if attempt < w.maxAttempts {
+				// тот же correlation id: ответ любой из попыток будет принят
+				attempt++
+				w.republish(attempt)
+				deadline.Reset(w.timeout)
 				continue
 			}
 
-			status = newStatus
-		case "error":
-			res := &TesterStatusError{}
-			err := json.Unmarshal(event.Body, res)
-			if err != nil {
-				logger.Error(errors.Wrap(err, "can not unmarshal result status body"))
-				continue
-			}
+			w.giveUp(attempt)
+			w.finish(in)
+			w.emitTimeout(out, fmt.Sprintf("tester timeout: no answer after %d attempts", attempt))
+			return
+		}
+	}
+}
 
-			newStatus := "Not Verifyed. Error!\n"
-			err = Bots.SetBotVerifiedByID(botID, false)
-			if err != nil {
-				logger.Error(errors.Wrap(err, "can update bot active status"))
-				continue
-			}
+// emitTimeout событие timeout вместо ответа тестеров
+func (w *testerTaskWatch) emitTimeout(out chan<- *TesterStatusQueue, reason string) {
+	timeoutBody, _ := json.Marshal(&TesterStatusError{Error: reason})
+	out <- &TesterStatusQueue{Type: "timeout", Body: timeoutBody}
+}
 
-			m := &MatchModel{
-				Result:   3, // код: ошибка
-				GameSlug: gameSlug,
-				Bot1:     botID,
-				Author1:  authorID,
-				Diff1:    0,
-				Error:    sql.NullString{String: res.Error, Valid: true},
-			}
-			err = Matches.Create(m)
-			if err != nil {
-				logger.Error(errors.Wrap(err, "can not save match"))
-				continue
-			}
+// finish отписка от ответов; поздние ответы и копии повторных попыток уже никому не нужны
+func (w *testerTaskWatch) finish(in <-chan amqp.Delivery) {
+	w.cancel()
+	go func() {
+		for range in {
+		}
+	}()
+}
 
-			body1, err := json.Marshal(&NotifyVerifyMessage{
-				BotID:    botID,
-				GameSlug: gameSlug,
-				MatchID:  m.ID,
-				Veryfied: false,
-			})
-			if err != nil {
-				logger.Error(errors.Wrap(err, "can not marshal body user1"))
-				continue
-			}
+// publishTask публикация задачи тестерам. Копии, которые никто не взял, пропадают
+// из очереди, когда истекают все попытки: дольше ответа на задачу никто не ждёт
+func publishTask(queueName, corrID, replyTo string, body []byte, priority uint8) error {
+	err := rabbitChannel.Publish(
+		"",
+		queueName,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:   "application/json",
+			CorrelationId: corrID,
+			ReplyTo:       replyTo,
+			Expiration:    strconv.FormatInt(int64(testerTaskTTL/time.Millisecond), 10),
+			Priority:      priority,
+			Body:          body,
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "can not publish a message")
+	}
 
-			_, err = notifyGRPC.SendNotify(context.Background(), &models.Message{
-				Type: "verify",
-				User: authorID,
-				Game: gameSlug,
-				Body: body1,
-			})
-			if err != nil {
-				logger.Error(errors.Wrap(err, "can send notify to user1"))
-				continue
-			}
+	return nil
+}
 
-			status = newStatus
-		default:
-			logger.Error(errors.New("can not process unknown status type"))
-		}
+// deadLetterTask задача, на которую тестеры так и не ответили, откладывается
+// в отдельную очередь для разбора
+func deadLetterTask(queueName, corrID string, body []byte, attempts int) error {
+	_, err := rabbitChannel.QueueDeclare(
+		deadLetterQueueName,
+		true, // переживает перезапуск брокера
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return errors.Wrap(err, "can not declare dead letter queue")
+	}
 
-		logger.Infof("Processing [%s]: new status: %s", event.Type, status)
+	err = rabbitChannel.Publish(
+		"",
+		deadLetterQueueName,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:   "application/json",
+			CorrelationId: corrID,
+			DeliveryMode:  amqp.Persistent,
+			Headers: amqp.Table{
+				"x-original-queue": queueName,
+				"x-attempts":       int32(attempts),
+			},
+			Body: body,
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "can not publish a dead letter")
 	}
+	testerDeadLetters.WithLabelValues(queueName).Inc()
+
+	return nil
 }
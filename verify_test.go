@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+func newTestWatch(timeout time.Duration) (*testerTaskWatch, *[]int, *int) {
+	republished, gaveUp := make([]int, 0), 0
+	return &testerTaskWatch{
+		timeout:     timeout,
+		idle:        100 * timeout,
+		maxAttempts: 3,
+		taken:       func() {},
+		republish:   func(attempt int) { republished = append(republished, attempt) },
+		giveUp:      func(int) { gaveUp++ },
+		cancel:      func() {},
+		logger:      logrus.NewEntry(logrus.New()),
+	}, &republished, &gaveUp
+}
+
+func TestTesterTaskWatchLongMatch(t *testing.T) {
+	watch, republished, gaveUp := newTestWatch(10 * time.Millisecond)
+	in := make(chan amqp.Delivery)
+	out := make(chan *TesterStatusQueue)
+	go watch.run("corr", in, out)
+
+	in <- amqp.Delivery{CorrelationId: "corr", Body: []byte(`{"type":"status","body":{}}`)}
+	if event := <-out; event.Type != "status" {
+		t.Fatalf("TestTesterTaskWatchLongMatch got %s, expected status", event.Type)
+	}
+
+	// матч идёт дольше нескольких таймаутов попытки
+	time.Sleep(50 * time.Millisecond)
+	in <- amqp.Delivery{CorrelationId: "other", Body: []byte(`{"type":"result","body":{}}`)}
+	in <- amqp.Delivery{CorrelationId: "corr", Body: []byte(`{"type":"result","body":{}}`)}
+	if event := <-out; event.Type != "result" {
+		t.Errorf("TestTesterTaskWatchLongMatch got %s, expected result", event.Type)
+	}
+	if _, ok := <-out; ok {
+		t.Errorf("TestTesterTaskWatchLongMatch events are not closed after result")
+	}
+	close(in)
+
+	if len(*republished) != 0 || *gaveUp != 0 {
+		t.Errorf("TestTesterTaskWatchLongMatch taken task was republished %v, gave up %d times",
+			*republished, *gaveUp)
+	}
+}
+
+func TestTesterTaskWatchTimeout(t *testing.T) {
+	watch, republished, gaveUp := newTestWatch(time.Millisecond)
+	in := make(chan amqp.Delivery)
+	out := make(chan *TesterStatusQueue)
+	go watch.run("corr", in, out)
+
+	if event := <-out; event.Type != "timeout" {
+		t.Errorf("TestTesterTaskWatchTimeout got %s, expected timeout", event.Type)
+	}
+	if _, ok := <-out; ok {
+		t.Errorf("TestTesterTaskWatchTimeout events are not closed after timeout")
+	}
+
+	// поздний ответ никого не блокирует
+	in <- amqp.Delivery{CorrelationId: "corr", Body: []byte(`{"type":"result","body":{}}`)}
+	close(in)
+
+	if len(*republished) != 2 || (*republished)[0] != 2 || (*republished)[1] != 3 {
+		t.Errorf("TestTesterTaskWatchTimeout got republished attempts %v, expected [2 3]", *republished)
+	}
+	if *gaveUp != 1 {
+		t.Errorf("TestTesterTaskWatchTimeout gave up %d times, expected 1", *gaveUp)
+	}
+}
+
+func TestTesterTaskWatchTesterGone(t *testing.T) {
+	watch, republished, gaveUp := newTestWatch(time.Millisecond)
+	in := make(chan amqp.Delivery)
+	out := make(chan *TesterStatusQueue)
+	go watch.run("corr", in, out)
+
+	in <- amqp.Delivery{CorrelationId: "corr", Body: []byte(`{"type":"status","body":{}}`)}
+	if event := <-out; event.Type != "status" {
+		t.Fatalf("TestTesterTaskWatchTesterGone got %s, expected status", event.Type)
+	}
+
+	// тестер взял задачу и замолчал
+	if event := <-out; event.Type != "timeout" {
+		t.Errorf("TestTesterTaskWatchTesterGone got %s, expected timeout", event.Type)
+	}
+	if _, ok := <-out; ok {
+		t.Errorf("TestTesterTaskWatchTesterGone events are not closed after timeout")
+	}
+	close(in)
+
+	if len(*republished) != 0 || *gaveUp != 0 {
+		t.Errorf("TestTesterTaskWatchTesterGone taken task was republished %v, gave up %d times",
+			*republished, *gaveUp)
+	}
+}